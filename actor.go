@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// command is an action to be performed on a job by its actor
+type command struct {
+	action Action
+	exec   func(status string) error // Run with the job status instead of performing an action
+	reply  chan error
+}
+
+// stepResult is the result of a step of the job
+type stepResult struct {
+	done bool
+	err  error
+}
+
+// statusChange describes a transition of a job
+type statusChange struct {
+	status   string
+	err      error     // Error which caused the transition if any
+	retryAt  time.Time // Earliest time a retried job can be started again
+	progress Progress  // Progress of the job at the transition
+	cleanErr error     // Error of the rollback of a stopped job
+}
+
+// jobActor is the single owner of a job. Every operation on the job is
+// executed by the actor goroutine, except its steps which run on their own
+// goroutine while the actor waits for them, so the job state is never used
+// by two goroutines at once. The actor keeps answering the commands during
+// a step: actions interrupt the step through its context and are performed
+// once it returned. The details of the job are published after every step
+// and transition, so they are read without waiting for the actor.
+// The actor enforces the state machine defined in state.go
+// and exits once the job reaches a terminal status
+type jobActor struct {
+	job        jobs.Job
+	status     string
+	policy     *RetryPolicy
+	attempts   int // Number of failed attempts
+	commands   chan command
+	done       chan struct{}
+	onStatus   func(change statusChange) // Called by the actor on every status change of the job
+	onProgress func(progress Progress)   // Called by the actor when the job made progress
+	tracker    progressTracker
+	reported   int // Units done last reported to onProgress
+	logger     *jobLogger
+
+	mu       sync.RWMutex
+	snapshot map[string]interface{} // Details of the job along with its status, never modified once published
+
+	// The context of the job is derived from stopCtx, which is cancelled
+	// as soon as the job is asked to stop, and bounded by the deadline
+	// of the job and its timeout once started.
+	// Only stopCtx and cancelStop are used outside of the actor goroutine
+	stopCtx    context.Context
+	cancelStop context.CancelFunc
+	ctx        context.Context
+	cancel     context.CancelFunc
+	bound      string // Bound of the context, timeout or deadline
+	timeout    time.Duration
+	deadline   time.Time
+	startedAt  time.Time
+
+	// Spans of the job, children of the span which submitted it held by trace.
+	// queued and running are open while the job has the status
+	tracer  trace.Tracer
+	trace   context.Context
+	jobID   string
+	jobType string
+	queued  trace.Span
+	running trace.Span
+}
+
+func newJobActor(job jobs.Job, record *JobRecord, tracer trace.Tracer, logger *jobLogger, onStatus func(change statusChange), onProgress func(progress Progress)) *jobActor {
+	actor := &jobActor{
+		job:        job,
+		status:     record.Status,
+		policy:     record.Retry,
+		attempts:   len(record.Attempts),
+		commands:   make(chan command),
+		done:       make(chan struct{}),
+		onStatus:   onStatus,
+		onProgress: onProgress,
+		reported:   job.Progress().Done,
+		logger:     logger,
+		tracer:     tracer,
+		trace:      contextWithTraceparent(context.Background(), record.TraceParent),
+		jobID:      record.JobID.String(),
+		jobType:    record.Type,
+	}
+	actor.stopCtx, actor.cancelStop = context.WithCancel(context.Background())
+	if record.Timeout != "" {
+		actor.timeout, _ = time.ParseDuration(record.Timeout)
+	}
+	if record.Deadline != nil {
+		actor.deadline = *record.Deadline
+	}
+	if record.StartedAt != nil {
+		actor.startedAt = *record.StartedAt
+	}
+	actor.resetContext()
+	if actor.status == Queued {
+		// Queued again after a restart
+		_, actor.queued = actor.startSpan("job.queue_wait")
+	}
+	actor.publish()
+	return actor
+}
+
+// run starts the actor goroutine
+func (actor *jobActor) run() {
+	go actor.loop()
+}
+
+// resetContext derives the context of the job from the stop context,
+// bounded by the earliest of its deadline and the end of its timeout
+func (actor *jobActor) resetContext() {
+	if actor.cancel != nil {
+		actor.cancel()
+	}
+	expiry, bound := actor.deadline, "deadline"
+	if actor.timeout > 0 && !actor.startedAt.IsZero() {
+		if end := actor.startedAt.Add(actor.timeout); expiry.IsZero() || end.Before(expiry) {
+			expiry, bound = end, "timeout"
+		}
+	}
+	if expiry.IsZero() {
+		actor.ctx, actor.cancel = context.WithCancel(actor.stopCtx)
+		return
+	}
+	actor.bound = bound
+	actor.ctx, actor.cancel = context.WithDeadline(actor.stopCtx, expiry)
+}
+
+func (actor *jobActor) loop() {
+	defer close(actor.done)
+	defer actor.cancelStop()
+	for !isTerminal(actor.status) {
+		if actor.ctx.Err() == context.DeadlineExceeded {
+			actor.transition(timeout, statusChange{err: fmt.Errorf("Job exceeded its %s", actor.bound)})
+			continue
+		}
+		if actor.status == Running && actor.ctx.Err() == nil {
+			actor.step()
+			continue
+		}
+		// Once cancelled by a stop, the job only waits for the stop command
+		var expired <-chan struct{}
+		if actor.ctx.Err() == nil {
+			expired = actor.ctx.Done()
+		}
+		select {
+		case cmd := <-actor.commands:
+			actor.handle(cmd)
+		case <-expired:
+		}
+	}
+}
+
+// handle answers the command from the actor goroutine
+func (actor *jobActor) handle(cmd command) {
+	if cmd.exec != nil {
+		cmd.reply <- cmd.exec(actor.status)
+		return
+	}
+	cmd.reply <- actor.transition(cmd.action, statusChange{})
+}
+
+// step processes a single unit of work of the running job on its own goroutine,
+// while the actor answers the commands. A failed job is queued again if its
+// retry policy allows it
+func (actor *jobActor) step() {
+	ctx, interrupt := context.WithCancel(actor.ctx)
+	defer interrupt()
+	stepCtx := ctx
+	if actor.running != nil {
+		stepCtx = trace.ContextWithSpan(ctx, actor.running)
+	}
+	results := make(chan stepResult, 1)
+	go func() {
+		done, err := actor.job.Step(stepCtx)
+		results <- stepResult{done, err}
+	}()
+	var pending []command
+	var result stepResult
+	for waiting := true; waiting; {
+		select {
+		case result = <-results:
+			waiting = false
+		case cmd := <-actor.commands:
+			if cmd.exec != nil {
+				// No transition happens until the step returned
+				cmd.reply <- cmd.exec(actor.status)
+				continue
+			}
+			if _, err := nextStatus(actor.status, cmd.action); err != nil {
+				cmd.reply <- err
+				continue
+			}
+			interrupt()
+			pending = append(pending, cmd)
+		}
+	}
+	actor.finishStep(result, ctx.Err() != nil)
+	for _, cmd := range pending {
+		actor.handle(cmd)
+	}
+}
+
+// finishStep handles the result of a step, interrupted is true if the step
+// was interrupted by an action, a stop or a timeout
+func (actor *jobActor) finishStep(result stepResult, interrupted bool) {
+	progress := actor.job.Progress()
+	actor.tracker.observe(time.Now(), progress.Done)
+	if progress.Done != actor.reported {
+		actor.reported = progress.Done
+		actor.onProgress(actor.tracker.complete(progress, true, time.Now()))
+	}
+	actor.publish()
+	err := result.err
+	if err != nil && interrupted {
+		// Handled by the loop or the pending actions
+		return
+	}
+	if err != nil {
+		actor.attempts++
+		actor.logger.Error("Job failed", "attempt", actor.attempts, "error", err)
+		if delay, ok := actor.policy.retryDelay(actor.attempts, err); ok {
+			actor.transition(retry, statusChange{err: err, retryAt: time.Now().Add(delay)})
+			return
+		}
+		actor.transition(fail, statusChange{err: err})
+	} else if result.done {
+		actor.transition(complete, statusChange{})
+	}
+}
+
+// transition performs the action on the job if the state machine allows it,
+// change holds the details of the transition besides the new status
+func (actor *jobActor) transition(action Action, change statusChange) error {
+	next, err := nextStatus(actor.status, action)
+	if err != nil {
+		return err
+	}
+	if err = actor.hook(action, &change); err != nil {
+		if action == start {
+			// The scheduler dropped the job from its queue, it would be left queued
+			actor.transition(fail, statusChange{err: err})
+		}
+		return err
+	}
+	if action == start && actor.startedAt.IsZero() {
+		// The timeout counts from the first start of the job
+		actor.startedAt = time.Now()
+		actor.resetContext()
+	}
+	if next == Running {
+		actor.tracker.reset()
+		actor.tracker.observe(time.Now(), actor.job.Progress().Done)
+	}
+	from := actor.status
+	actor.status = next
+	change.status = next
+	change.progress = actor.progress()
+	actor.traceTransition(from, change)
+	actor.logger.Info("Status changed", "from", from, "to", next)
+	actor.publish()
+	actor.onStatus(change)
+	if change.cleanErr != nil {
+		return change.cleanErr
+	}
+	return nil
+}
+
+// hook calls the method of the job implementing the action.
+// A stopped job which fails to clean is still stopped, the error is
+// part of the change and returned once the transition is saved
+func (actor *jobActor) hook(action Action, change *statusChange) error {
+	switch action {
+	case start:
+		return actor.job.Start()
+	case halt:
+		return actor.job.Halt()
+	case resume:
+		return actor.job.Resume()
+	case stop:
+		if err := actor.job.Stop(); err != nil {
+			return err
+		}
+		_, span := actor.startSpan("job.clean")
+		if err := actor.job.Clean(); err != nil {
+			actor.logger.Error("Failed to clean the stopped job", "error", err)
+			change.cleanErr = &cleanError{err}
+			failSpan(span, err)
+		}
+		span.End()
+	case timeout:
+		// The job times out even if it fails to stop
+		if err := actor.job.Stop(); err != nil {
+			actor.logger.Warn("Failed to stop the timed out job", "error", err)
+		}
+	}
+	return nil
+}
+
+// startSpan starts a span of the job, child of the span of its run if it is running
+func (actor *jobActor) startSpan(name string) (context.Context, trace.Span) {
+	parent := actor.trace
+	if actor.running != nil {
+		parent = trace.ContextWithSpan(parent, actor.running)
+	}
+	return actor.tracer.Start(parent, name, trace.WithAttributes(
+		attribute.String("job.id", actor.jobID),
+		attribute.String("job.type", actor.jobType),
+	))
+}
+
+// traceTransition ends the span of the status the job left, the wait in
+// the queue or its run, and starts the span of its new status
+func (actor *jobActor) traceTransition(from string, change statusChange) {
+	if from == Queued && actor.queued != nil {
+		actor.queued.End()
+		actor.queued = nil
+	}
+	if from == Running && actor.running != nil {
+		if change.err != nil {
+			failSpan(actor.running, change.err)
+		}
+		actor.running.SetAttributes(attribute.String("job.status", change.status))
+		actor.running.End()
+		actor.running = nil
+	}
+	switch change.status {
+	case Queued:
+		_, actor.queued = actor.startSpan("job.queue_wait")
+	case Running:
+		_, actor.running = actor.startSpan("job.run")
+		actor.running.SetAttributes(attribute.Int("job.attempt", actor.attempts+1))
+	}
+}
+
+// publish saves the details of the job, from the actor goroutine
+func (actor *jobActor) publish() {
+	details := actor.job.Details()
+	details["status"] = actor.status
+	details["progress"] = actor.progress()
+	actor.mu.Lock()
+	actor.snapshot = details
+	actor.mu.Unlock()
+}
+
+func (actor *jobActor) progress() Progress {
+	return actor.tracker.complete(actor.job.Progress(), actor.status == Running, time.Now())
+}
+
+// send passes the command to the actor and waits for its result.
+// Once the actor has exited the job is no longer modified,
+// so the command is answered directly from its final state
+func (actor *jobActor) send(cmd command) error {
+	cmd.reply = make(chan error, 1)
+	select {
+	case actor.commands <- cmd:
+		return <-cmd.reply
+	case <-actor.done:
+	}
+	if cmd.exec != nil {
+		return cmd.exec(actor.status)
+	}
+	_, err := nextStatus(actor.status, cmd.action)
+	return err
+}
+
+// perform executes the action on the job from the actor goroutine.
+// Stopping a job first cancels its context to interrupt its processing,
+// if the stop then fails the job stays idle until stopped again
+func (actor *jobActor) perform(action Action) error {
+	if action == stop {
+		actor.cancelStop()
+	}
+	return actor.send(command{action: action})
+}
+
+// exec runs fn with the status of the job from the actor goroutine,
+// so that no transition of the job happens while fn is running.
+// fn must not use the job itself
+func (actor *jobActor) exec(fn func(status string) error) error {
+	return actor.send(command{exec: fn})
+}
+
+// fetchDetails returns the last published details of the job along with its status,
+// the caller owns the returned map
+func (actor *jobActor) fetchDetails() map[string]interface{} {
+	actor.mu.RLock()
+	defer actor.mu.RUnlock()
+	details := make(map[string]interface{}, len(actor.snapshot))
+	for key, value := range actor.snapshot {
+		details[key] = value
+	}
+	return details
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// slowJob is a job whose steps take a while, its state is plain
+// so that the race detector reports any concurrent use
+type slowJob struct {
+	stepTime time.Duration
+	steps    int
+	started  chan struct{} // Receives a value when a step starts
+}
+
+func (job *slowJob) Step(ctx context.Context) (bool, error) {
+	select {
+	case job.started <- struct{}{}:
+	default:
+	}
+	if err := jobs.Sleep(ctx, job.stepTime); err != nil {
+		return false, err
+	}
+	job.steps++
+	return false, nil
+}
+
+func (job *slowJob) Start() error  { return nil }
+func (job *slowJob) Halt() error   { return nil }
+func (job *slowJob) Resume() error { return nil }
+func (job *slowJob) Stop() error   { return nil }
+func (job *slowJob) Clean() error  { return nil }
+
+func (job *slowJob) Details() map[string]interface{} {
+	return map[string]interface{}{"steps": job.steps}
+}
+
+func (job *slowJob) Progress() jobs.Progress {
+	return jobs.Progress{Done: job.steps}
+}
+
+func newTestActor(t *testing.T, job jobs.Job) *jobActor {
+	record := &JobRecord{JobID: uuid.New(), Type: "Slow", Status: Queued}
+	logger := newJobLogs(newMemoryStore(), false).logger(record.JobID, record.Type)
+	actor := newJobActor(job, record, trace.NewNoopTracerProvider().Tracer(serviceName), logger, func(change statusChange) {}, func(progress Progress) {})
+	actor.run()
+	return actor
+}
+
+func TestActorAnswersDuringStep(t *testing.T) {
+	job := &slowJob{stepTime: time.Minute, started: make(chan struct{}, 1)}
+	actor := newTestActor(t, job)
+	if err := actor.perform(start); err != nil {
+		t.Fatal(err)
+	}
+	<-job.started
+
+	begin := time.Now()
+	if status := actor.fetchDetails()["status"]; status != Running {
+		t.Errorf("status = %v, want %s", status, Running)
+	}
+	if err := actor.exec(func(status string) error { return nil }); err != nil {
+		t.Errorf("exec = %v", err)
+	}
+	if err := actor.perform(resume); err == nil {
+		t.Error("resume of a running job succeeded")
+	}
+	if err := actor.perform(halt); err != nil {
+		t.Fatalf("halt = %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Errorf("commands took %s, want them answered during the step", elapsed)
+	}
+	if status := actor.fetchDetails()["status"]; status != Halted {
+		t.Errorf("status = %v, want %s", status, Halted)
+	}
+	if err := actor.perform(stop); err != nil {
+		t.Fatalf("stop = %v", err)
+	}
+	<-actor.done
+}
+
+func TestActorConcurrentCommands(t *testing.T) {
+	job := &slowJob{stepTime: time.Millisecond, started: make(chan struct{}, 1)}
+	actor := newTestActor(t, job)
+
+	var wg sync.WaitGroup
+	end := time.Now().Add(500 * time.Millisecond)
+	for _, action := range []Action{start, halt, resume, start, halt} {
+		wg.Add(1)
+		go func(action Action) {
+			defer wg.Done()
+			for time.Now().Before(end) {
+				actor.perform(action)
+			}
+		}(action)
+	}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(end) {
+				details := actor.fetchDetails()
+				details["type"] = "Slow"
+				actor.exec(func(status string) error { return nil })
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := actor.perform(stop); err != nil {
+		t.Fatalf("stop = %v", err)
+	}
+	select {
+	case <-actor.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("actor didn't exit once stopped")
+	}
+	if status := actor.fetchDetails()["status"]; status != Stopped {
+		t.Errorf("status = %v, want %s", status, Stopped)
+	}
+	if err := actor.perform(resume); err == nil {
+		t.Error("resume of a stopped job succeeded")
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+// artifactStore is where the jobs save their artifacts, set from the flags
+var artifactStore jobs.ArtifactStore = newLocalArtifactStore("artifacts")
+
+// newArtifactStore returns the store of the location, either a local
+// directory or an S3 bucket like s3://bucket/prefix
+func newArtifactStore(location string, s3Endpoint string, s3Region string) (jobs.ArtifactStore, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return newLocalArtifactStore(location), nil
+	}
+	bucket := strings.TrimPrefix(location, "s3://")
+	prefix := ""
+	if i := strings.Index(bucket, "/"); i >= 0 {
+		bucket, prefix = bucket[:i], strings.Trim(bucket[i+1:], "/")
+	}
+	if bucket == "" {
+		return nil, errors.New("Invalid artifact store: " + location)
+	}
+	endpoint, err := url.Parse(s3Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, errors.New("Invalid S3 endpoint: " + s3Endpoint)
+	}
+	return &s3ArtifactStore{
+		// Downloads are streamed, only the wait for the responses is bounded
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: time.Minute,
+		}},
+		endpoint:     endpoint,
+		region:       s3Region,
+		bucket:       bucket,
+		prefix:       prefix,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}, nil
+}
+
+// checksum returns the size and the checksum of the content,
+// which is read from its current offset
+func checksum(content io.Reader) (int64, string, error) {
+	hash := sha256.New()
+	size, err := io.Copy(hash, content)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// localArtifactStore keeps the artifacts in a directory per job
+type localArtifactStore struct {
+	dir string
+}
+
+func newLocalArtifactStore(dir string) *localArtifactStore {
+	return &localArtifactStore{dir}
+}
+
+func (store *localArtifactStore) path(jobID uuid.UUID, name string) string {
+	return filepath.Join(store.dir, jobID.String(), filepath.Base(name))
+}
+
+func (store *localArtifactStore) Put(jobID uuid.UUID, name string, contentType string, content io.ReadSeeker) (*jobs.Artifact, error) {
+	path := store.path(jobID, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// The content is written aside and renamed so that
+	// an artifact is never read half written
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), content)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &jobs.Artifact{
+		Name:        name,
+		Size:        size,
+		Checksum:    "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		ContentType: contentType,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (store *localArtifactStore) Open(jobID uuid.UUID, artifact *jobs.Artifact) (io.ReadSeeker, io.Closer, error) {
+	file, err := os.Open(store.path(jobID, artifact.Name))
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file, nil
+}
+
+func (store *localArtifactStore) Remove(jobID uuid.UUID, name string) error {
+	if err := os.Remove(store.path(jobID, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// s3ArtifactStore keeps the artifacts in a bucket of an S3 compatible
+// service, under the prefix/jobID/name keys. Requests are signed with
+// AWS Signature Version 4 and use path style URLs, which S3 compatible
+// services like MinIO support
+type s3ArtifactStore struct {
+	client       *http.Client
+	endpoint     *url.URL
+	region       string
+	bucket       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string // Token of temporary credentials, e.g. from an IAM role, sent if not empty
+}
+
+// emptyHash is the SHA256 of an empty payload
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (store *s3ArtifactStore) key(jobID uuid.UUID, name string) string {
+	key := jobID.String() + "/" + name
+	if store.prefix != "" {
+		key = store.prefix + "/" + key
+	}
+	return key
+}
+
+func (store *s3ArtifactStore) Put(jobID uuid.UUID, name string, contentType string, content io.ReadSeeker) (*jobs.Artifact, error) {
+	// The payload is hashed before being sent, as part of the signature
+	size, sum, err := checksum(content)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	req, err := store.request(http.MethodPut, store.key(jobID, name), content, sum)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("Content-Type", contentType)
+	res, err := store.do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	return &jobs.Artifact{
+		Name:        name,
+		Size:        size,
+		Checksum:    "sha256:" + sum,
+		ContentType: contentType,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (store *s3ArtifactStore) Open(jobID uuid.UUID, artifact *jobs.Artifact) (io.ReadSeeker, io.Closer, error) {
+	object := &s3Object{store: store, key: store.key(jobID, artifact.Name), size: artifact.Size}
+	return object, object, nil
+}
+
+func (store *s3ArtifactStore) Remove(jobID uuid.UUID, name string) error {
+	req, err := store.request(http.MethodDelete, store.key(jobID, name), nil, emptyHash)
+	if err != nil {
+		return err
+	}
+	res, err := store.do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// request creates a request on the key of the bucket, signed for the payload hash
+func (store *s3ArtifactStore) request(method string, key string, body io.Reader, payloadHash string) (*http.Request, error) {
+	target := strings.TrimSuffix(store.endpoint.String(), "/") + "/" + uriEncode(store.bucket) + "/" + uriEncode(key)
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if store.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", store.sessionToken)
+	}
+	return req, nil
+}
+
+// do signs and sends the request, responses without a 2xx status are errors
+func (store *s3ArtifactStore) do(req *http.Request) (*http.Response, error) {
+	store.sign(req, time.Now().UTC())
+	res, err := store.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s responded %d: %s", req.Method, req.URL.Path, res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return res, nil
+}
+
+// sign adds the AWS Signature Version 4 of the request to its headers
+func (store *s3ArtifactStore) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": req.Header.Get("X-Amz-Content-Sha256"),
+		"x-amz-date":           amzDate,
+	}
+	if rangeHeader := req.Header.Get("Range"); rangeHeader != "" {
+		headers = append(headers, "range")
+		values["range"] = rangeHeader
+	}
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = token
+	}
+	sort.Strings(headers)
+	canonicalHeaders := ""
+	for _, header := range headers {
+		canonicalHeaders += header + ":" + values[header] + "\n"
+	}
+	signedHeaders := strings.Join(headers, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // No query
+		canonicalHeaders,
+		signedHeaders,
+		values["x-amz-content-sha256"],
+	}, "\n")
+
+	scope := day + "/" + store.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+store.secretKey), day)
+	key = hmacSHA256(key, store.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+store.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode escapes every byte of the path but the unreserved
+// characters and the slashes, as expected by the signature
+func uriEncode(path string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(path) {
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' ||
+			b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+// s3Object reads an object with range requests, starting
+// a new request from the current offset after every seek
+type s3Object struct {
+	store  *s3ArtifactStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (object *s3Object) Read(p []byte) (int, error) {
+	if object.offset >= object.size {
+		return 0, io.EOF
+	}
+	if object.body == nil {
+		req, err := object.store.request(http.MethodGet, object.key, nil, emptyHash)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(object.offset, 10)+"-")
+		res, err := object.store.do(req)
+		if err != nil {
+			return 0, err
+		}
+		object.body = res.Body
+	}
+	n, err := object.body.Read(p)
+	object.offset += int64(n)
+	if err == io.EOF && object.offset < object.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (object *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += object.offset
+	case io.SeekEnd:
+		offset += object.size
+	}
+	if offset < 0 {
+		return 0, errors.New("Invalid offset")
+	}
+	if offset != object.offset {
+		object.Close()
+		object.offset = offset
+	}
+	return offset, nil
+}
+
+func (object *s3Object) Close() error {
+	if object.body == nil {
+		return nil
+	}
+	err := object.body.Close()
+	object.body = nil
+	return err
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Roles of the API users, every role is granted the permissions of the previous ones
+const (
+	Viewer    string = "viewer"    // Reads the jobs, schedules, events and artifacts
+	Submitter string = "submitter" // Submits jobs and schedules, controls its own jobs
+	Operator  string = "operator"  // Controls every job, manages the webhooks and the API keys
+)
+
+var roleRanks = map[string]int{Viewer: 1, Submitter: 2, Operator: 3}
+
+// defaultTenant is the tenant of the credentials which don't name one,
+// and of the jobs, schedules and webhooks created before tenants
+const defaultTenant = "default"
+
+// principalKey is the key of the principal in the context of a request
+const principalKey = "principal"
+
+// jwtLeeway is the clock skew tolerated when validating the tokens
+const jwtLeeway = time.Minute
+
+// Principal is the authenticated user of a request,
+// which only sees the jobs of its tenant
+type Principal struct {
+	Subject string `json:"subject" example:"alice"`
+	Role    string `json:"role" example:"submitter"`
+	Tenant  string `json:"tenant" example:"acme"`
+}
+
+// has returns true if the role of the principal grants the permissions of the role
+func (principal *Principal) has(role string) bool {
+	return roleRanks[principal.Role] >= roleRanks[role]
+}
+
+// canControl returns true if the principal can act on a job or schedule of the owner,
+// operators can act on any of them while submitters only on their own
+func (principal *Principal) canControl(owner string) bool {
+	return principal.has(Operator) || principal.has(Submitter) && principal.Subject == owner
+}
+
+// sees returns true if a job, schedule, webhook or API key of the tenant
+// is visible to the principal, which only sees those of its tenant
+func (principal *Principal) sees(tenant string) bool {
+	return principal.Tenant == tenantOf(tenant)
+}
+
+// tenantOf returns the tenant of a record, the records
+// created before tenants belong to the default tenant
+func tenantOf(tenant string) string {
+	if tenant == "" {
+		return defaultTenant
+	}
+	return tenant
+}
+
+// principalOf returns the principal set by the authentication middleware
+func principalOf(c *gin.Context) *Principal {
+	return c.MustGet(principalKey).(*Principal)
+}
+
+// APIKeyRequest represents the request to create an API key
+// Owner is the user the key authenticates as, the owner of the jobs it submits.
+// It is the operator creating the key, who is the owner if it is empty
+// The key belongs to the tenant of the operator creating it
+type APIKeyRequest struct {
+	Owner string `json:"owner" example:"alice"`
+	Role  string `json:"role" example:"submitter"`
+}
+
+// APIKey is an API key, only its hash is kept
+type APIKey struct {
+	KeyID     uuid.UUID `json:"keyID" example:"0f8d3c1a-7b2e-4f5d-9a6c-2e1b8d7f4a3c"`
+	Owner     string    `json:"owner" example:"alice"`
+	Role      string    `json:"role" example:"submitter"`
+	Tenant    string    `json:"tenant" example:"acme"`
+	Hash      string    `json:"hash,omitempty"` // SHA256 of the key, never returned by the API
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// public returns the key without its hash
+func (key *APIKey) public() APIKey {
+	public := *key
+	public.Hash = ""
+	return public
+}
+
+// newAPIKey creates an API key of the tenant along with its secret value,
+// which is returned once and never stored
+func newAPIKey(request *APIKeyRequest, tenant string) (*APIKey, string, error) {
+	if request.Owner == "" {
+		return nil, "", errors.New("Invalid API key owner")
+	}
+	if _, ok := roleRanks[request.Role]; !ok {
+		return nil, "", errors.New("Invalid role, expected one of: viewer, submitter, operator")
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+	return &APIKey{
+		KeyID:     uuid.New(),
+		Owner:     request.Owner,
+		Role:      request.Role,
+		Tenant:    tenant,
+		Hash:      hashAPIKey(secret),
+		CreatedAt: time.Now(),
+	}, secret, nil
+}
+
+// hashAPIKey returns the hash the key is stored as. The keys are random,
+// a fast hash is enough to prevent recovering them from the store
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticator identifies the user of the requests, either from an API key
+// or from a JWT signed by one of the keys of the JWKS file
+type authenticator struct {
+	store       APIKeyStore
+	keySet      *jose.JSONWebKeySet // Keys verifying the tokens, tokens are rejected if nil
+	issuer      string              // Expected issuer of the tokens if not empty
+	audience    string              // Expected audience of the tokens if not empty
+	roleClaim   string              // Claim holding the role of the user
+	tenantClaim string              // Claim holding the tenant of the user, required
+	disabled    bool                // Every request is made by an anonymous operator of the default tenant
+}
+
+func newAuthenticator(store APIKeyStore, jwksPath string, issuer string, audience string, roleClaim string, tenantClaim string) (*authenticator, error) {
+	auth := &authenticator{
+		store:       store,
+		issuer:      issuer,
+		audience:    audience,
+		roleClaim:   roleClaim,
+		tenantClaim: tenantClaim,
+	}
+	if jwksPath == "" {
+		return auth, nil
+	}
+	buf, err := ioutil.ReadFile(jwksPath)
+	if err != nil {
+		return nil, errors.New("Failed to read the JWKS file: " + err.Error())
+	}
+	auth.keySet = &jose.JSONWebKeySet{}
+	if err = json.Unmarshal(buf, auth.keySet); err != nil {
+		return nil, errors.New("Failed to parse the JWKS file: " + err.Error())
+	}
+	if len(auth.keySet.Keys) == 0 {
+		return nil, errors.New("No key in the JWKS file: " + jwksPath)
+	}
+	return auth, nil
+}
+
+// revoke deletes the API key if it belongs to the tenant of the principal,
+// the keys of other tenants are reported as not found
+func (auth *authenticator) revoke(keyID uuid.UUID, principal *Principal) error {
+	keys, err := auth.store.listAPIKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.KeyID == keyID && principal.sees(key.Tenant) {
+			return auth.store.deleteAPIKey(keyID)
+		}
+	}
+	return errAPIKeyNotFound
+}
+
+// authenticate is the middleware setting the principal of the requests,
+// requests without valid credentials are rejected
+func (auth *authenticator) authenticate(c *gin.Context) {
+	if auth.disabled {
+		c.Set(principalKey, &Principal{Role: Operator, Tenant: defaultTenant})
+		return
+	}
+	principal, err := auth.identify(c.Request)
+	if err != nil {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, httpError{
+			"",
+			err.Error(),
+		})
+		return
+	}
+	c.Set(principalKey, principal)
+}
+
+// requireRole returns the middleware rejecting the principals without the role
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !principalOf(c).has(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, httpError{
+				"",
+				"Not allowed, requires the " + role + " role",
+			})
+		}
+	}
+}
+
+// logRequest formats the request log lines like the default gin logger,
+// with the access_token query parameter redacted so that no credentials are logged.
+// The query is parsed as by the handlers, so that an escaped name is redacted too
+func logRequest(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor, methodColor, resetColor = param.StatusCodeColor(), param.MethodColor(), param.ResetColor()
+	}
+	path := param.Request.URL.Path
+	if query := param.Request.URL.RawQuery; query != "" {
+		values := param.Request.URL.Query()
+		if _, ok := values["access_token"]; ok {
+			values.Set("access_token", "REDACTED")
+			query = values.Encode()
+		}
+		path += "?" + query
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		path,
+		param.ErrorMessage,
+	)
+}
+
+// identify returns the principal of the credentials of the request,
+// given in the X-API-Key or Authorization headers. The access_token
+// query parameter is accepted for the clients which can't set headers,
+// such as the browser EventSource and WebSocket APIs
+func (auth *authenticator) identify(req *http.Request) (*Principal, error) {
+	credentials := req.Header.Get("X-API-Key")
+	if credentials == "" {
+		credentials = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	}
+	if credentials == "" {
+		credentials = req.URL.Query().Get("access_token")
+	}
+	if credentials == "" {
+		return nil, errors.New("Missing credentials")
+	}
+	// API keys never contain dots, while a JWT is made of three parts
+	if strings.Count(credentials, ".") == 2 {
+		return auth.verifyToken(credentials)
+	}
+	key, err := auth.store.getAPIKey(hashAPIKey(credentials))
+	if err == errAPIKeyNotFound {
+		return nil, errors.New("Invalid API key")
+	} else if err != nil {
+		log.Println("Failed to fetch the API key: ", err.Error())
+		return nil, errors.New("Failed to verify the API key")
+	}
+	return &Principal{key.Owner, key.Role, tenantOf(key.Tenant)}, nil
+}
+
+// verifyToken returns the principal of a JWT, its subject along with the role
+// of the role claim and the tenant of the tenant claim.
+// The token must be signed by a key of the JWKS and expire
+func (auth *authenticator) verifyToken(raw string) (*Principal, error) {
+	invalid := errors.New("Invalid token")
+	if auth.keySet == nil {
+		return nil, invalid
+	}
+	token, err := jwt.ParseSigned(raw)
+	if err != nil || len(token.Headers) == 0 {
+		return nil, invalid
+	}
+	keys := auth.keySet.Keys
+	if kid := token.Headers[0].KeyID; kid != "" {
+		keys = auth.keySet.Key(kid)
+	}
+	var claims jwt.Claims
+	var custom map[string]interface{}
+	verified := false
+	for _, key := range keys {
+		// Symmetric keys have no public key and aren't accepted
+		public := key.Public()
+		if public.Key == nil {
+			continue
+		}
+		if err = token.Claims(public.Key, &claims, &custom); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, invalid
+	}
+	if claims.Expiry == nil || claims.Subject == "" {
+		return nil, errors.New("Invalid token, exp and sub are required")
+	}
+	expected := jwt.Expected{Issuer: auth.issuer, Time: time.Now()}
+	if auth.audience != "" {
+		expected.Audience = jwt.Audience{auth.audience}
+	}
+	if err = claims.ValidateWithLeeway(expected, jwtLeeway); err != nil {
+		return nil, errors.New("Invalid token: " + err.Error())
+	}
+	role := tokenRole(custom[auth.roleClaim])
+	if role == "" {
+		return nil, errors.New("Invalid token, no role in the " + auth.roleClaim + " claim")
+	}
+	// A token without a tenant would fall in the default tenant,
+	// whose operators see the shares of every tenant
+	tenant, _ := custom[auth.tenantClaim].(string)
+	if tenant == "" {
+		return nil, errors.New("Invalid token, no tenant in the " + auth.tenantClaim + " claim")
+	}
+	return &Principal{claims.Subject, role, tenant}, nil
+}
+
+// tokenRole returns the role of a role claim, either a role
+// or a list of roles of which the highest is kept
+func tokenRole(claim interface{}) string {
+	roles := []interface{}{claim}
+	if list, ok := claim.([]interface{}); ok {
+		roles = list
+	}
+	role := ""
+	for _, value := range roles {
+		if name, ok := value.(string); ok && roleRanks[name] > roleRanks[role] {
+			role = name
+		}
+	}
+	return role
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// testToken signs the claims with the key, whose ID is set as kid
+func testToken(t *testing.T, alg jose.SignatureAlgorithm, key jose.JSONWebKey, claims jwt.Claims, custom map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := jwt.Signed(signer).Claims(claims).Claims(custom).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestVerifyToken(t *testing.T) {
+	newKey := func(kid string) jose.JSONWebKey {
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return jose.JSONWebKey{Key: private, KeyID: kid, Algorithm: string(jose.ES256)}
+	}
+	signing, other := newKey("k1"), newKey("k2")
+	shared := jose.JSONWebKey{Key: []byte("0123456789abcdef0123456789abcdef"), KeyID: "shared", Algorithm: string(jose.HS256)}
+	auth := &authenticator{
+		keySet:      &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{signing.Public(), shared}},
+		issuer:      "https://auth.example.com",
+		audience:    "jobs",
+		roleClaim:   "role",
+		tenantClaim: "tenant",
+	}
+	now := time.Now()
+	claims := func(change func(claims *jwt.Claims)) jwt.Claims {
+		claims := jwt.Claims{
+			Subject:  "alice",
+			Issuer:   "https://auth.example.com",
+			Audience: jwt.Audience{"jobs"},
+			Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+		}
+		if change != nil {
+			change(&claims)
+		}
+		return claims
+	}
+	submitter := map[string]interface{}{"role": Submitter, "tenant": "acme"}
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"k1"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice","iss":"https://auth.example.com","aud":"jobs","exp":4102444800,"role":"operator"}`)) + "."
+	tests := []struct {
+		name  string
+		token string
+		want  *Principal // Nil if invalid
+		err   string
+	}{
+		{"valid", testToken(t, jose.ES256, signing, claims(nil), submitter), &Principal{"alice", Submitter, "acme"}, ""},
+		{"default tenant", testToken(t, jose.ES256, signing, claims(nil), map[string]interface{}{"role": Viewer, "tenant": defaultTenant}), &Principal{"alice", Viewer, defaultTenant}, ""},
+		{"highest role of a list", testToken(t, jose.ES256, signing, claims(nil), map[string]interface{}{"role": []interface{}{Viewer, Operator, "admin"}, "tenant": "acme"}), &Principal{"alice", Operator, "acme"}, ""},
+		{"expired within the leeway", testToken(t, jose.ES256, signing, claims(func(c *jwt.Claims) { c.Expiry = jwt.NewNumericDate(now.Add(-30 * time.Second)) }), submitter), &Principal{"alice", Submitter, "acme"}, ""},
+		{"expired", testToken(t, jose.ES256, signing, claims(func(c *jwt.Claims) { c.Expiry = jwt.NewNumericDate(now.Add(-2 * time.Minute)) }), submitter), nil,
+			"Invalid token: square/go-jose/jwt: validation failed, token is expired (exp)"},
+		{"not yet valid", testToken(t, jose.ES256, signing, claims(func(c *jwt.Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(2 * time.Minute)) }), submitter), nil,
+			"Invalid token: square/go-jose/jwt: validation failed, token not valid yet (nbf)"},
+		{"wrong issuer", testToken(t, jose.ES256, signing, claims(func(c *jwt.Claims) { c.Issuer = "https://evil.example.com" }), submitter), nil,
+			"Invalid token: square/go-jose/jwt: validation failed, invalid issuer claim (iss)"},
+		{"wrong audience", testToken(t, jose.ES256, signing, claims(func(c *jwt.Claims) { c.Audience = jwt.Audience{"billing"} }), submitter), nil,
+			"Invalid token: square/go-jose/jwt: validation failed, invalid audience claim (aud)"},
+		{"no expiry", testToken(t, jose.ES256, signing, claims(func(c *jwt.Claims) { c.Expiry = nil }), submitter), nil,
+			"Invalid token, exp and sub are required"},
+		{"no subject", testToken(t, jose.ES256, signing, claims(func(c *jwt.Claims) { c.Subject = "" }), submitter), nil,
+			"Invalid token, exp and sub are required"},
+		{"no role", testToken(t, jose.ES256, signing, claims(nil), map[string]interface{}{"role": "admin"}), nil,
+			"Invalid token, no role in the role claim"},
+		{"no tenant", testToken(t, jose.ES256, signing, claims(nil), map[string]interface{}{"role": Operator}), nil,
+			"Invalid token, no tenant in the tenant claim"},
+		{"empty tenant", testToken(t, jose.ES256, signing, claims(nil), map[string]interface{}{"role": Operator, "tenant": ""}), nil,
+			"Invalid token, no tenant in the tenant claim"},
+		{"tenant not a string", testToken(t, jose.ES256, signing, claims(nil), map[string]interface{}{"role": Operator, "tenant": 1}), nil,
+			"Invalid token, no tenant in the tenant claim"},
+		{"unknown kid", testToken(t, jose.ES256, other, claims(nil), submitter), nil, "Invalid token"},
+		{"signed by another key", testToken(t, jose.ES256, jose.JSONWebKey{Key: other.Key, KeyID: "k1"}, claims(nil), submitter), nil, "Invalid token"},
+		{"HS256 with a key of the JWKS", testToken(t, jose.HS256, shared, claims(nil), submitter), nil, "Invalid token"},
+		{"HS256 with the public key", testToken(t, jose.HS256, jose.JSONWebKey{Key: []byte(signing.Public().Key.(*ecdsa.PublicKey).X.String()), KeyID: "k1"}, claims(nil), submitter), nil, "Invalid token"},
+		{"alg none", none, nil, "Invalid token"},
+		{"not a token", "a.b.c", nil, "Invalid token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := auth.verifyToken(test.token)
+			if test.want != nil {
+				if err != nil || !reflect.DeepEqual(principal, test.want) {
+					t.Errorf("verifyToken = %+v, %v, want %+v", principal, err, test.want)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.err {
+				t.Errorf("verifyToken = %+v, %v, want %s", principal, err, test.err)
+			}
+		})
+	}
+	// Tokens are rejected without a JWKS
+	if _, err := (&authenticator{roleClaim: "role"}).verifyToken(tests[0].token); err == nil {
+		t.Error("token accepted without a JWKS")
+	}
+}
+
+func TestIdentifyAPIKey(t *testing.T) {
+	store := newMemoryStore()
+	key, secret, err := newAPIKey(&APIKeyRequest{Owner: "alice", Role: Submitter}, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.saveAPIKey(key); err != nil {
+		t.Fatal(err)
+	}
+	if key.Hash == secret || key.Hash != hashAPIKey(secret) || strings.Contains(key.Hash, secret) {
+		t.Fatalf("API key stored as %s, want the hash of the secret", key.Hash)
+	}
+	auth := &authenticator{store: store}
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		query  string
+		err    string // Empty if alice is identified
+	}{
+		{"X-API-Key header", "X-API-Key", secret, "", ""},
+		{"bearer", "Authorization", "Bearer " + secret, "", ""},
+		{"query", "", "", "access_token=" + secret, ""},
+		{"escaped query", "", "", "access%5Ftoken=" + secret, ""},
+		{"hash of the key", "X-API-Key", key.Hash, "", "Invalid API key"},
+		{"unknown key", "X-API-Key", "unknown", "", "Invalid API key"},
+		{"missing", "", "", "", "Missing credentials"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/jobs?"+test.query, nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		principal, err := auth.identify(req)
+		if test.err == "" && (err != nil || !reflect.DeepEqual(principal, &Principal{"alice", Submitter, "acme"})) ||
+			test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: identify = %+v, %v, want %q", test.name, principal, err, test.err)
+		}
+	}
+}
+
+// TestCreateAPIKey checks that the keys created by an operator
+// authenticate as the operator, never as another user
+func TestCreateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStore()
+	auth := &authenticator{store: store}
+	r := gin.New()
+	r.POST("/api-keys", func(c *gin.Context) {
+		c.Set(principalKey, &Principal{"olga", Operator, "acme"})
+	}, auth.createAPIKey)
+	tests := []struct {
+		body  string
+		code  int
+		owner string // Owner of the key created, if any
+	}{
+		{`{"role": "submitter"}`, http.StatusOK, "olga"},
+		{`{"owner": "olga", "role": "operator"}`, http.StatusOK, "olga"},
+		{`{"owner": "alice", "role": "submitter"}`, http.StatusForbidden, ""},
+		{`{"owner": "alice", "role": "viewer"}`, http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(test.body)))
+		if w.Code != test.code {
+			t.Errorf("POST /api-keys %s = %d, want %d: %s", test.body, w.Code, test.code, w.Body.String())
+			continue
+		}
+		if test.owner == "" {
+			continue
+		}
+		var res apiKeyResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+		req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+		req.Header.Set("X-API-Key", res.Key)
+		principal, err := auth.identify(req)
+		if err != nil || principal.Subject != test.owner || principal.Tenant != "acme" {
+			t.Errorf("key created by %s = %+v, %v, want a key of %s in acme", test.body, principal, err, test.owner)
+		}
+	}
+	keys, err := store.listAPIKeys()
+	if err != nil || len(keys) != 2 {
+		t.Errorf("keys = %v, %v, want the two keys of olga", keys, err)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	tests := []struct {
+		principal  Principal
+		role       string
+		has        bool
+		owner      string
+		canControl bool
+	}{
+		{Principal{"vic", Viewer, defaultTenant}, Viewer, true, "vic", false},
+		{Principal{"vic", Viewer, defaultTenant}, Submitter, false, "alice", false},
+		{Principal{"alice", Submitter, defaultTenant}, Submitter, true, "alice", true},
+		{Principal{"alice", Submitter, defaultTenant}, Operator, false, "bob", false},
+		{Principal{"olga", Operator, defaultTenant}, Operator, true, "bob", true},
+		{Principal{"olga", Operator, defaultTenant}, Viewer, true, "olga", true},
+		{Principal{"eve", "admin", defaultTenant}, Viewer, false, "eve", false},
+	}
+	for _, test := range tests {
+		if has := test.principal.has(test.role); has != test.has {
+			t.Errorf("%s has %s = %v, want %v", test.principal.Role, test.role, has, test.has)
+		}
+		if can := test.principal.canControl(test.owner); can != test.canControl {
+			t.Errorf("%s %s can control the jobs of %s = %v, want %v", test.principal.Role, test.principal.Subject, test.owner, can, test.canControl)
+		}
+	}
+}
+
+// TestRoleRoutes checks the permissions of the roles on the routes
+// submitting and controlling the jobs
+func TestRoleRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager := newTestManager(t, newMemoryStore(), 0)
+	principals := map[string]*Principal{
+		"vic":   {"vic", Viewer, defaultTenant},
+		"alice": {"alice", Submitter, defaultTenant},
+		"bob":   {"bob", Submitter, defaultTenant},
+		"olga":  {"olga", Operator, defaultTenant},
+	}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(principalKey, principals[c.GetHeader("X-User")])
+	})
+	r.GET("/details/:jobID", requireRole(Viewer), manager.detailsJob)
+	r.POST("/submit", requireRole(Submitter), manager.submitJob)
+	r.GET("/stop/:jobID", requireRole(Submitter), manager.stopJob)
+	tests := []struct {
+		user   string
+		method string
+		path   string // {job} is replaced by the ID of a job of alice
+		code   int
+	}{
+		{"vic", http.MethodGet, "/details/{job}", http.StatusOK},
+		{"vic", http.MethodPost, "/submit", http.StatusForbidden},
+		{"vic", http.MethodGet, "/stop/{job}", http.StatusForbidden},
+		{"alice", http.MethodPost, "/submit", http.StatusOK},
+		{"alice", http.MethodGet, "/stop/{job}", http.StatusOK},
+		{"bob", http.MethodGet, "/details/{job}", http.StatusOK},
+		{"bob", http.MethodGet, "/stop/{job}", http.StatusForbidden},
+		{"olga", http.MethodGet, "/stop/{job}", http.StatusOK},
+	}
+	for _, test := range tests {
+		record := newJobRecord(uuid.New(), &JobRequest{Type: simple.Name}, "alice", defaultTenant)
+		job, err := buildSubmittedJob(record, manager.checkpointer(record.JobID), manager.logs.logger(record.JobID, record.Type))
+		if err == nil {
+			err = manager.queueJob(record, job)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := strings.Replace(test.path, "{job}", record.JobID.String(), 1)
+		req := httptest.NewRequest(test.method, path, strings.NewReader(`{"Type": "Simple"}`))
+		req.Header.Set("X-User", test.user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s %s %s = %d, want %d: %s", test.user, test.method, test.path, w.Code, test.code, w.Body.String())
+		}
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	tests := []struct {
+		query string
+		path  string
+	}{
+		{"", "/events"},
+		{"job=1", "/events?job=1"},
+		{"access_token=secret", "/events?access_token=REDACTED"},
+		{"job=1&access_token=secret", "/events?access_token=REDACTED&job=1"},
+		{"access%5Ftoken=secret", "/events?access_token=REDACTED"},
+		{"%61ccess_token=secret&access_token=other", "/events?access_token=REDACTED"},
+		{"my_access_token=1", "/events?my_access_token=1"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/events?"+test.query, nil)
+		line := logRequest(gin.LogFormatterParams{Request: req, Method: http.MethodGet, StatusCode: http.StatusOK})
+		if !strings.Contains(line, " "+test.path+"\n") || strings.Contains(line, "secret") || strings.Contains(line, "other") {
+			t.Errorf("logRequest(%q) = %q, want the path %s", test.query, line, test.path)
+		}
+	}
+}
@@ -1,16 +1,18 @@
 package main
 
-// Different status for Jobs
+import "github.com/psinghal20/atlan-assignment/jobs"
+
+// Different status for Jobs, see state.go for the transitions between them
 const (
 	Submitted string = "Submitted"
+	Queued    string = "Queued"
 	Running   string = "Running"
 	Halted    string = "Halted"
+	Completed string = "Completed"
+	Failed    string = "Failed"
+	Stopped   string = "Stopped"
+	TimedOut  string = "TimedOut"
 )
 
-// Types of Jobs
-const (
-	Simple string = "Simple"
-	Export string = "Export"
-)
-
-const timeLayout = "2006-Jan-02"
+// timeLayout is the layout of the days given as job arguments
+const timeLayout = jobs.DayLayout
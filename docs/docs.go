@@ -1,6 +1,6 @@
 // GENERATED BY THE COMMAND ABOVE; DO NOT EDIT
 // This file was generated by swaggo/swag at
-// 2019-10-22 20:33:00.252355678 +0530 IST m=+0.049144674
+// 2026-10-17 18:32:53.77187825 +0000 UTC m=+0.109612926
 
 package docs
 
@@ -26,8 +26,16 @@ var doc = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/details/{jobID}": {
+        "/api-keys": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Job processing backend API for Atlan Collect",
                 "consumes": [
                     "application/json"
@@ -35,26 +43,86 @@ var doc = `{
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Fetch details about a submitted job",
-                "operationId": "details-job",
+                "summary": "List the API keys of the tenant, without their value",
+                "operationId": "list-api-keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiKeysResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nThe key is only returned in the response, the server keeps its hash\nThe key belongs to the tenant of the caller and authenticates as the caller, a key of another owner is refused",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create an API key",
+                "operationId": "create-api-key",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Job ID",
-                        "name": "jobID",
-                        "in": "path",
-                        "required": true
+                        "description": "Owner and role of the key",
+                        "name": "apiKeyRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/main.APIKeyRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.httpResponse"
+                            "$ref": "#/definitions/main.apiKeyResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/main.httpError"
                         }
@@ -68,8 +136,16 @@ var doc = `{
                 }
             }
         },
-        "/halt/{jobID}": {
-            "get": {
+        "/api-keys/{keyID}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Job processing backend API for Atlan Collect",
                 "consumes": [
                     "application/json"
@@ -77,13 +153,13 @@ var doc = `{
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Halt a running job",
-                "operationId": "halt-job",
+                "summary": "Revoke an API key",
+                "operationId": "delete-api-key",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Job ID",
-                        "name": "jobID",
+                        "description": "API key ID",
+                        "name": "keyID",
                         "in": "path",
                         "required": true
                     }
@@ -95,6 +171,18 @@ var doc = `{
                             "$ref": "#/definitions/main.httpResponse"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -110,8 +198,16 @@ var doc = `{
                 }
             }
         },
-        "/resume/{jobID}": {
+        "/details/{jobID}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Job processing backend API for Atlan Collect",
                 "consumes": [
                     "application/json"
@@ -119,8 +215,8 @@ var doc = `{
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Resume a pause/halted job",
-                "operationId": "resume-job",
+                "summary": "Fetch details about a submitted job",
+                "operationId": "details-job",
                 "parameters": [
                     {
                         "type": "string",
@@ -137,6 +233,12 @@ var doc = `{
                             "$ref": "#/definitions/main.httpResponse"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -152,8 +254,109 @@ var doc = `{
                 }
             }
         },
-        "/stop/{jobID}": {
+        "/events": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nOnly the events following the connection are sent, unless the stream resumes after the event given in the Last-Event-ID header",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "summary": "Stream the status and progress changes of every job as Server-Sent Events",
+                "operationId": "stream-events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of the last event received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Event"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/events/{jobID}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nOnly the events following the connection are sent, unless the stream resumes after the event given in the Last-Event-ID header",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "summary": "Stream the status and progress changes of a job as Server-Sent Events",
+                "operationId": "stream-job-events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the last event received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Event"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/halt/{jobID}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Job processing backend API for Atlan Collect",
                 "consumes": [
                     "application/json"
@@ -161,8 +364,8 @@ var doc = `{
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Stop a  job",
-                "operationId": "stop-job",
+                "summary": "Halt a running job",
+                "operationId": "halt-job",
                 "parameters": [
                     {
                         "type": "string",
@@ -179,6 +382,18 @@ var doc = `{
                             "$ref": "#/definitions/main.httpResponse"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -194,8 +409,16 @@ var doc = `{
                 }
             }
         },
-        "/submit": {
-            "post": {
+        "/job-types": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Job processing backend API for Atlan Collect",
                 "consumes": [
                     "application/json"
@@ -203,24 +426,107 @@ var doc = `{
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Submit a job for processing",
-                "operationId": "submit-job",
-                "parameters": [
-                    {
-                        "description": "Submit a job",
-                        "name": "jobRequest",
-                        "in": "body",
-                        "required": true,
+                "summary": "List the job types along with the JSON Schema of their args",
+                "operationId": "job-types",
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.JobRequest"
+                            "$ref": "#/definitions/main.jobTypesResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
                         }
                     }
+                }
+            }
+        },
+        "/jobs": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List the submitted jobs",
+                "operationId": "list-jobs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Filter by job type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by job status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by owner, the user who submitted the job",
+                        "name": "owner",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only jobs submitted at or after the time (RFC3339)",
+                        "name": "submitted_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only jobs submitted before the time (RFC3339)",
+                        "name": "submitted_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "description": "Filter by label as key:value, can be repeated",
+                        "name": "label",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort by submitted_at, status or type, prefix with - for descending order",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of jobs per page, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the page returned as next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.httpResponse"
+                            "$ref": "#/definitions/main.jobsResponse"
                         }
                     },
                     "400": {
@@ -229,6 +535,12 @@ var doc = `{
                             "$ref": "#/definitions/main.httpError"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -237,10 +549,1459 @@ var doc = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "main.JobRequest": {
+        },
+        "/jobs/{jobID}/artifacts/{name}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nRange requests are supported to download a part of the artifact or resume a download",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "Download an artifact produced by a job",
+                "operationId": "download-artifact",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the artifact",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte ranges, e.g. bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Content of the artifact",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "206": {
+                        "description": "Requested ranges of the artifact",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "416": {
+                        "description": "Requested Range Not Satisfiable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Fetch the webhook deliveries of the transitions of a job",
+                "operationId": "job-deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.deliveriesResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{jobID}/logs": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nWith follow=true the lines are streamed as log events until the job ends, resuming after the line given in the Last-Event-ID header",
+                "produces": [
+                    "application/json",
+                    "text/event-stream"
+                ],
+                "summary": "Fetch the log lines of a job, or follow them as Server-Sent Events",
+                "operationId": "job-logs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Minimum level of the lines, debug, info, warn or error",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only return the lines following this sequence number",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Stream the lines until the job ends",
+                        "name": "follow",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sequence number of the last line received when following",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.logsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "description": "Job processing backend API for Atlan Collect",
+                "produces": [
+                    "text/plain"
+                ],
+                "summary": "Fetch the metrics of the jobs and of the HTTP API in the Prometheus text format",
+                "operationId": "metrics",
+                "responses": {
+                    "200": {
+                        "description": "Metrics in the Prometheus text exposition format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/priority/{jobID}": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Change the priority of a queued or halted job",
+                "operationId": "priority-job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New priority of the job",
+                        "name": "priorityRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/main.PriorityRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/queue": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nThe queue only lists the jobs of the tenant of the caller",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Fetch the state of the job queue and workers",
+                "operationId": "queue-stats",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.QueueStats"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/resume/{jobID}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nThe job is queued again unless its tenant reached its quota of queued jobs",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Resume a pause/halted job",
+                "operationId": "resume-job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/scheduler": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nOperators of the default tenant see every tenant with running or queued jobs, other users only their tenant",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Fetch the share of the workers of the tenants",
+                "operationId": "scheduler-stats",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.SchedulerStats"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List the recurring job schedules",
+                "operationId": "list-schedules",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.schedulesResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create a recurring job schedule",
+                "operationId": "create-schedule",
+                "parameters": [
+                    {
+                        "description": "Schedule a recurring job",
+                        "name": "scheduleRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/main.ScheduleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Schedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.validationError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/{scheduleID}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Fetch a recurring job schedule along with its runs",
+                "operationId": "get-schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "scheduleID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Schedule"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete a recurring job schedule, jobs already created are kept",
+                "operationId": "delete-schedule",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "scheduleID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.scheduleResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/stop/{jobID}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nThe job is stopped even if it fails to roll back its changes, the error is then returned as clean_error in the details",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Stop a  job",
+                "operationId": "stop-job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/submit": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nThe job is rejected if the tenant of the caller reached its quota of queued jobs",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Submit a job for processing",
+                "operationId": "submit-job",
+                "parameters": [
+                    {
+                        "description": "Submit a job",
+                        "name": "jobRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/main.JobRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.validationError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List the webhooks subscribed to the job transitions of the tenant",
+                "operationId": "list-webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.webhooksResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Subscribe a webhook to the transitions of every job of the tenant",
+                "operationId": "create-webhook",
+                "parameters": [
+                    {
+                        "description": "Subscribe a webhook",
+                        "name": "webhookRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "$ref": "#/definitions/main.WebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhookID}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete a webhook, its pending deliveries fail",
+                "operationId": "delete-webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.webhookResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Job processing backend API for Atlan Collect\nClients send ControlMessage frames and receive ControlFrame frames",
+                "summary": "Open a WebSocket control channel to subscribe to and control jobs",
+                "operationId": "control-socket",
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/main.ControlFrame"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.httpError"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "jobs.ArgsSchema": {
+            "type": "object",
+            "properties": {
+                "additionalProperties": {
+                    "type": "boolean"
+                },
+                "properties": {
+                    "type": "object"
+                },
+                "required": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "type": {
+                    "type": "string",
+                    "example": "object"
+                }
+            }
+        },
+        "jobs.FieldError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "Does not match format 'day'"
+                },
+                "field": {
+                    "type": "string",
+                    "example": "args.from_date"
+                }
+            }
+        },
+        "jobs.Type": {
+            "type": "object",
+            "properties": {
+                "args": {
+                    "description": "JSON Schema of the arguments of the job",
+                    "type": "object",
+                    "$ref": "#/definitions/jobs.ArgsSchema"
+                },
+                "description": {
+                    "type": "string",
+                    "example": "Exports the data of every day between from_date and to_date"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Export"
+                }
+            }
+        },
+        "main.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "hash": {
+                    "description": "SHA256 of the key, never returned by the API",
+                    "type": "string"
+                },
+                "keyID": {
+                    "type": "string",
+                    "example": "0f8d3c1a-7b2e-4f5d-9a6c-2e1b8d7f4a3c"
+                },
+                "owner": {
+                    "type": "string",
+                    "example": "alice"
+                },
+                "role": {
+                    "type": "string",
+                    "example": "submitter"
+                },
+                "tenant": {
+                    "type": "string",
+                    "example": "acme"
+                }
+            }
+        },
+        "main.APIKeyRequest": {
+            "type": "object",
+            "properties": {
+                "owner": {
+                    "type": "string",
+                    "example": "alice"
+                },
+                "role": {
+                    "type": "string",
+                    "example": "submitter"
+                }
+            }
+        },
+        "main.ControlFrame": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "object",
+                    "$ref": "#/definitions/main.Event"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "1"
+                },
+                "jobID": {
+                    "type": "string",
+                    "example": "55e75f6c-24f8-49b5-9e62-a268db7370e9"
+                },
+                "log": {
+                    "type": "object",
+                    "$ref": "#/definitions/main.LogEntry"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "ack"
+                }
+            }
+        },
+        "main.Delivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.DeliveryAttempt"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "deliveryID": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                },
+                "webhookID": {
+                    "description": "Nil for the callback URL of the job",
+                    "type": "string"
+                }
+            }
+        },
+        "main.DeliveryAttempt": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.Event": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "jobID": {
+                    "type": "string",
+                    "example": "55e75f6c-24f8-49b5-9e62-a268db7370e9"
+                },
+                "progress": {
+                    "type": "object",
+                    "$ref": "#/definitions/main.Progress"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "Running"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "status"
+                }
+            }
+        },
+        "main.JobRequest": {
+            "type": "object",
+            "properties": {
+                "Type": {
+                    "type": "string",
+                    "example": "Simple"
+                },
+                "args": {
+                    "type": "object"
+                },
+                "callback_url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/jobs"
+                },
+                "deadline": {
+                    "type": "string",
+                    "example": "2021-01-02T15:04:05Z"
+                },
+                "labels": {
+                    "type": "object"
+                },
+                "priority": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "retry": {
+                    "type": "object",
+                    "$ref": "#/definitions/main.RetryPolicy"
+                },
+                "timeout": {
+                    "type": "string",
+                    "example": "30m"
+                }
+            }
+        },
+        "main.LogEntry": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "fields": {
+                    "type": "object"
+                },
+                "level": {
+                    "type": "string",
+                    "example": "info"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "Exporting data"
+                },
+                "seq": {
+                    "type": "integer",
+                    "example": 12
+                }
+            }
+        },
+        "main.PriorityRequest": {
+            "type": "object",
+            "properties": {
+                "priority": {
+                    "type": "integer",
+                    "example": 10
+                }
+            }
+        },
+        "main.Progress": {
+            "type": "object",
+            "properties": {
+                "current": {
+                    "description": "Item being processed",
+                    "type": "string",
+                    "example": "2020-Jan-14"
+                },
+                "done": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "eta": {
+                    "description": "Estimated completion time",
+                    "type": "string"
+                },
+                "percentage": {
+                    "type": "number",
+                    "example": 40
+                },
+                "throughput": {
+                    "description": "Units done per second",
+                    "type": "number",
+                    "example": 0.98
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 30
+                }
+            }
+        },
+        "main.QueueStats": {
+            "type": "object",
+            "properties": {
+                "queue": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "queued": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "running": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "tenant": {
+                    "type": "string",
+                    "example": "acme"
+                },
+                "tenant_queued": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "tenant_quota": {
+                    "type": "object",
+                    "$ref": "#/definitions/main.TenantQuota"
+                },
+                "tenant_running": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "type_limits": {
+                    "type": "object"
+                },
+                "type_queued": {
+                    "type": "object"
+                },
+                "type_running": {
+                    "type": "object"
+                },
+                "workers": {
+                    "type": "integer",
+                    "example": 4
+                }
+            }
+        },
+        "main.RetryPolicy": {
+            "type": "object",
+            "properties": {
+                "backoff": {
+                    "type": "string",
+                    "example": "1s"
+                },
+                "jitter": {
+                    "type": "number",
+                    "example": 0.1
+                },
+                "max_attempts": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "max_backoff": {
+                    "type": "string",
+                    "example": "5m"
+                },
+                "multiplier": {
+                    "type": "number",
+                    "example": 2
+                },
+                "retry_on": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "transient"
+                    ]
+                }
+            }
+        },
+        "main.Schedule": {
+            "type": "object",
+            "properties": {
+                "Type": {
+                    "type": "string",
+                    "example": "Simple"
+                },
+                "args": {
+                    "type": "object"
+                },
+                "callback_url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/jobs"
+                },
+                "catch_up": {
+                    "type": "string",
+                    "example": "latest"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "cron": {
+                    "type": "string",
+                    "example": "0 2 * * *"
+                },
+                "deadline": {
+                    "type": "string",
+                    "example": "2021-01-02T15:04:05Z"
+                },
+                "labels": {
+                    "type": "object"
+                },
+                "last_tick": {
+                    "description": "Latest tick handled, run or skipped",
+                    "type": "string"
+                },
+                "owner": {
+                    "description": "User who created the schedule, owner of its jobs",
+                    "type": "string",
+                    "example": "alice"
+                },
+                "priority": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "retry": {
+                    "type": "object",
+                    "$ref": "#/definitions/main.RetryPolicy"
+                },
+                "runs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.ScheduleRun"
+                    }
+                },
+                "scheduleID": {
+                    "type": "string",
+                    "example": "9e3e9c1c-2d2a-4a3f-8b9a-3c1f0d7e6a51"
+                },
+                "tenant": {
+                    "description": "Tenant of the user, tenant of its jobs",
+                    "type": "string",
+                    "example": "acme"
+                },
+                "timeout": {
+                    "type": "string",
+                    "example": "30m"
+                }
+            }
+        },
+        "main.ScheduleRequest": {
             "type": "object",
             "properties": {
                 "Type": {
@@ -249,6 +2010,224 @@ var doc = `{
                 },
                 "args": {
                     "type": "object"
+                },
+                "callback_url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/jobs"
+                },
+                "catch_up": {
+                    "type": "string",
+                    "example": "latest"
+                },
+                "cron": {
+                    "type": "string",
+                    "example": "0 2 * * *"
+                },
+                "deadline": {
+                    "type": "string",
+                    "example": "2021-01-02T15:04:05Z"
+                },
+                "labels": {
+                    "type": "object"
+                },
+                "priority": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "retry": {
+                    "type": "object",
+                    "$ref": "#/definitions/main.RetryPolicy"
+                },
+                "timeout": {
+                    "type": "string",
+                    "example": "30m"
+                }
+            }
+        },
+        "main.ScheduleRun": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "jobID": {
+                    "type": "string"
+                },
+                "tick": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.SchedulerStats": {
+            "type": "object",
+            "properties": {
+                "fair_share": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "fair_share_types": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "queued": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "running": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "tenants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.TenantShare"
+                    }
+                },
+                "workers": {
+                    "type": "integer",
+                    "example": 4
+                }
+            }
+        },
+        "main.TenantQuota": {
+            "type": "object",
+            "properties": {
+                "max_queued": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "max_running": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "main.TenantShare": {
+            "type": "object",
+            "properties": {
+                "fair_share": {
+                    "type": "number",
+                    "example": 0.5
+                },
+                "queue_position": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "queued": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "running": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "share": {
+                    "type": "number",
+                    "example": 0.25
+                },
+                "tenant": {
+                    "type": "string",
+                    "example": "acme"
+                },
+                "weight": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "main.Webhook": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "s3cr3t"
+                },
+                "statuses": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "Completed",
+                        "Failed"
+                    ]
+                },
+                "tenant": {
+                    "type": "string",
+                    "example": "acme"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/jobs"
+                },
+                "webhookID": {
+                    "type": "string",
+                    "example": "3f1c2b9e-6a0d-4c55-9d2e-8b7a1f4e5c6d"
+                }
+            }
+        },
+        "main.WebhookRequest": {
+            "type": "object",
+            "properties": {
+                "secret": {
+                    "type": "string",
+                    "example": "s3cr3t"
+                },
+                "statuses": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "Completed",
+                        "Failed"
+                    ]
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/jobs"
+                }
+            }
+        },
+        "main.apiKeyResponse": {
+            "type": "object",
+            "properties": {
+                "key": {
+                    "type": "string",
+                    "example": "q2Vh1b8sYk9mZp3xTn7wLr0aJc5dFe4gHi6uKo2yXs8"
+                },
+                "keyID": {
+                    "type": "string",
+                    "example": "0f8d3c1a-7b2e-4f5d-9a6c-2e1b8d7f4a3c"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "Success"
+                }
+            }
+        },
+        "main.apiKeysResponse": {
+            "type": "object",
+            "properties": {
+                "api_keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.APIKey"
+                    }
+                }
+            }
+        },
+        "main.deliveriesResponse": {
+            "type": "object",
+            "properties": {
+                "deliveries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Delivery"
+                    }
                 }
             }
         },
@@ -280,6 +2259,127 @@ var doc = `{
                     "example": "Success"
                 }
             }
+        },
+        "main.jobSummary": {
+            "type": "object",
+            "additionalProperties": {
+                "type": "object"
+            }
+        },
+        "main.jobTypesResponse": {
+            "type": "object",
+            "properties": {
+                "job_types": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/jobs.Type"
+                    }
+                }
+            }
+        },
+        "main.jobsResponse": {
+            "type": "object",
+            "properties": {
+                "jobs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.jobSummary"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string",
+                    "example": "MjAxOS0xMC0yMlQxNTowNDowNS4wMDAwMDAwMDAAZTNiMGM0NDI"
+                }
+            }
+        },
+        "main.logsResponse": {
+            "type": "object",
+            "properties": {
+                "logs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.LogEntry"
+                    }
+                }
+            }
+        },
+        "main.scheduleResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "Success"
+                },
+                "scheduleID": {
+                    "type": "string",
+                    "example": "9e3e9c1c-2d2a-4a3f-8b9a-3c1f0d7e6a51"
+                }
+            }
+        },
+        "main.schedulesResponse": {
+            "type": "object",
+            "properties": {
+                "schedules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Schedule"
+                    }
+                }
+            }
+        },
+        "main.validationError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "Invalid args"
+                },
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/jobs.FieldError"
+                    }
+                },
+                "jobID": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.webhookResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "Success"
+                },
+                "webhookID": {
+                    "type": "string",
+                    "example": "3f1c2b9e-6a0d-4c55-9d2e-8b7a1f4e5c6d"
+                }
+            }
+        },
+        "main.webhooksResponse": {
+            "type": "object",
+            "properties": {
+                "webhooks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Webhook"
+                    }
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
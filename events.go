@@ -0,0 +1,130 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of the job events
+const (
+	StatusEvent   string = "status"   // Job changed its status
+	ProgressEvent string = "progress" // Job made progress
+)
+
+const (
+	eventHistory     = 1000             // Number of events kept to resume the streams
+	subscriberBuffer = 64               // Number of events a subscriber can lag behind
+	sseHeartbeat     = 15 * time.Second // Delay between the comments keeping the event streams open
+)
+
+// Event is a change of a job published on the event bus
+type Event struct {
+	ID       uint64    `json:"id" example:"42"`
+	Type     string    `json:"type" example:"status"`
+	JobID    uuid.UUID `json:"jobID" example:"55e75f6c-24f8-49b5-9e62-a268db7370e9"`
+	At       time.Time `json:"at"`
+	Status   string    `json:"status" example:"Running"`
+	Error    string    `json:"error,omitempty"`
+	Progress *Progress `json:"progress,omitempty"`
+	Tenant   string    `json:"-"` // Tenant of the job, events are only delivered within it
+}
+
+// subscription receives the events of a job, or of every job
+// of the tenant if jobID is nil
+type subscription struct {
+	jobID  uuid.UUID
+	tenant string
+	after  uint64 // ID of the last event published before the subscription
+	events chan Event
+}
+
+func (sub *subscription) match(event Event) bool {
+	return sub.tenant == event.Tenant && (sub.jobID == uuid.Nil || sub.jobID == event.JobID)
+}
+
+// eventBus delivers the job events to its subscribers and keeps
+// the latest ones so that a subscriber can resume after the last event it got.
+// A subscriber which doesn't keep up is dropped, its channel is closed
+type eventBus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	subscribers map[*subscription]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		history:     []Event{},
+		subscribers: make(map[*subscription]struct{}),
+	}
+}
+
+// publish assigns the next ID to the event and delivers it
+func (bus *eventBus) publish(event Event) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.lastID++
+	event.ID = bus.lastID
+	event.At = time.Now()
+	bus.history = append(bus.history, event)
+	if len(bus.history) > eventHistory {
+		bus.history = bus.history[len(bus.history)-eventHistory:]
+	}
+	for sub := range bus.subscribers {
+		if !sub.match(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(bus.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// subscribe returns the subscription delivering the events of the job
+// of the tenant published from now on, or of every job of the tenant if
+// jobID is nil. No kept event is delivered, see resume
+func (bus *eventBus) subscribe(jobID uuid.UUID, tenant string) *subscription {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	return bus.add(jobID, tenant)
+}
+
+// resume returns the kept events of the job of the tenant published after lastID,
+// along with the subscription delivering the following ones.
+// Every kept event is returned if lastID is unknown, e.g. after a restart
+func (bus *eventBus) resume(jobID uuid.UUID, tenant string, lastID uint64) ([]Event, *subscription) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if lastID > bus.lastID {
+		lastID = 0
+	}
+	sub := bus.add(jobID, tenant)
+	missed := []Event{}
+	for _, event := range bus.history {
+		if event.ID > lastID && sub.match(event) {
+			missed = append(missed, event)
+		}
+	}
+	return missed, sub
+}
+
+// add registers a new subscription, bus.mu must be held
+func (bus *eventBus) add(jobID uuid.UUID, tenant string) *subscription {
+	sub := &subscription{jobID: jobID, tenant: tenant, after: bus.lastID, events: make(chan Event, subscriberBuffer)}
+	bus.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (bus *eventBus) unsubscribe(sub *subscription) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if _, ok := bus.subscribers[sub]; ok {
+		delete(bus.subscribers, sub)
+		close(sub.events)
+	}
+}
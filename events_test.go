@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// eventIDs returns the IDs of the events as a list
+func eventIDs(events []Event) string {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, strconv.FormatUint(event.ID, 10))
+	}
+	return "[" + strings.Join(ids, " ") + "]"
+}
+
+// receive returns the events waiting on the subscription,
+// along with false if the subscription was dropped
+func receive(sub *subscription) ([]Event, bool) {
+	events := []Event{}
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return events, false
+			}
+			events = append(events, event)
+		default:
+			return events, true
+		}
+	}
+}
+
+func TestEventBusResume(t *testing.T) {
+	jobA, jobB := uuid.New(), uuid.New()
+	bus := newEventBus()
+	for _, event := range []Event{
+		{JobID: jobA, Tenant: "acme"},
+		{JobID: jobB, Tenant: "acme"},
+		{JobID: jobA, Tenant: "acme"},
+		{JobID: uuid.New(), Tenant: "beta"},
+		{JobID: jobB, Tenant: "acme"},
+	} {
+		bus.publish(event)
+	}
+	tests := []struct {
+		name   string
+		jobID  uuid.UUID
+		tenant string
+		lastID uint64
+		missed string
+	}{
+		{"every kept event", uuid.Nil, "acme", 0, "[1 2 3 5]"},
+		{"after the last event received", uuid.Nil, "acme", 2, "[3 5]"},
+		{"up to date", uuid.Nil, "acme", 5, "[]"},
+		{"unknown ID after a restart", uuid.Nil, "acme", 42, "[1 2 3 5]"},
+		{"job", jobA, "acme", 0, "[1 3]"},
+		{"job after the last event received", jobB, "acme", 2, "[5]"},
+		{"other tenant", uuid.Nil, "beta", 0, "[4]"},
+		{"job of another tenant", jobA, "beta", 0, "[]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			missed, sub := bus.resume(test.jobID, test.tenant, test.lastID)
+			defer bus.unsubscribe(sub)
+			if got := eventIDs(missed); got != test.missed {
+				t.Errorf("resume(%d) = %s, want %s", test.lastID, got, test.missed)
+			}
+		})
+	}
+}
+
+func TestEventBusHistory(t *testing.T) {
+	bus := newEventBus()
+	for i := 0; i < eventHistory+5; i++ {
+		bus.publish(Event{JobID: uuid.New(), Tenant: "acme"})
+	}
+	missed, sub := bus.resume(uuid.Nil, "acme", 0)
+	bus.unsubscribe(sub)
+	if len(missed) != eventHistory || missed[0].ID != 6 {
+		t.Errorf("resume kept %d events from %d, want %d from 6", len(missed), missed[0].ID, eventHistory)
+	}
+}
+
+func TestEventBusSubscribe(t *testing.T) {
+	jobA, jobB := uuid.New(), uuid.New()
+	bus := newEventBus()
+	bus.publish(Event{JobID: jobA, Tenant: "acme"})
+	all := bus.subscribe(uuid.Nil, "acme")
+	job := bus.subscribe(jobA, "acme")
+	other := bus.subscribe(uuid.Nil, "beta")
+	if all.after != 1 {
+		t.Errorf("subscription after %d, want 1", all.after)
+	}
+	bus.publish(Event{JobID: jobB, Tenant: "acme"})
+	bus.publish(Event{JobID: jobA, Tenant: "acme"})
+	tests := []struct {
+		name   string
+		sub    *subscription
+		events string
+	}{
+		{"every job of the tenant", all, "[2 3]"},
+		{"job", job, "[3]"},
+		{"other tenant", other, "[]"},
+	}
+	for _, test := range tests {
+		events, ok := receive(test.sub)
+		if got := eventIDs(events); got != test.events || !ok {
+			t.Errorf("%s: received %s, subscribed %v, want %s", test.name, got, ok, test.events)
+		}
+		bus.unsubscribe(test.sub)
+	}
+}
+
+// TestEventBusSlowSubscriber checks that a subscriber which doesn't
+// keep up is dropped, without affecting the other subscribers
+func TestEventBusSlowSubscriber(t *testing.T) {
+	jobA, jobB := uuid.New(), uuid.New()
+	bus := newEventBus()
+	slow := bus.subscribe(uuid.Nil, "acme")
+	filtered := bus.subscribe(jobB, "acme")
+	for i := 0; i < subscriberBuffer+1; i++ {
+		bus.publish(Event{JobID: jobA, Tenant: "acme"})
+	}
+	bus.publish(Event{JobID: jobB, Tenant: "acme"})
+	events, ok := receive(slow)
+	if ok || len(events) != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events, subscribed %v, want %d then dropped", len(events), ok, subscriberBuffer)
+	}
+	events, ok = receive(filtered)
+	if !ok || eventIDs(events) != "["+strconv.Itoa(subscriberBuffer+2)+"]" {
+		t.Errorf("subscriber of another job received %s, subscribed %v", eventIDs(events), ok)
+	}
+	// Unsubscribing a dropped subscriber is a no-op
+	bus.unsubscribe(slow)
+	bus.unsubscribe(filtered)
+	if len(bus.subscribers) != 0 {
+		t.Errorf("%d subscribers left", len(bus.subscribers))
+	}
+}
+
+// TestStreamEvents checks that the stream only replays
+// the kept events if the client sends Last-Event-ID
+func TestStreamEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		lastID string
+		ids    string
+	}{
+		{"new client", "", "[3]"},
+		{"invalid Last-Event-ID", "last", "[3]"},
+		{"resumed", "1", "[2 3]"},
+		{"resumed from the start", "0", "[1 2 3]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := &JobManager{events: newEventBus()}
+			r := gin.New()
+			r.GET("/events", func(c *gin.Context) {
+				c.Set(principalKey, &Principal{Role: Viewer, Tenant: defaultTenant})
+			}, manager.streamEvents)
+			server := httptest.NewServer(r)
+			defer server.Close()
+			manager.events.publish(Event{JobID: uuid.New(), Tenant: defaultTenant})
+			manager.events.publish(Event{JobID: uuid.New(), Tenant: defaultTenant})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+			if test.lastID != "" {
+				req.Header.Set("Last-Event-ID", test.lastID)
+			}
+			res, err := http.DefaultClient.Do(req.WithContext(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			// The response starts once the stream subscribed
+			manager.events.publish(Event{JobID: uuid.New(), Tenant: defaultTenant})
+			ids := []string{}
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				if line := scanner.Text(); strings.HasPrefix(line, "id: ") {
+					ids = append(ids, strings.TrimPrefix(line, "id: "))
+					if line == "id: 3" {
+						break
+					}
+				}
+			}
+			if got := "[" + strings.Join(ids, " ") + "]"; got != test.ids {
+				t.Errorf("stream sent %s, want %s", got, test.ids)
+			}
+		})
+	}
+}
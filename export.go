@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+)
+
+// parseExportSources parses the comma separated tenant=path list of the
+// export sources of the tenants and the comma separated tenant=table list
+// of the tables they can export, along with the source and the comma
+// separated tables of the default tenant. Every tenant has its own source,
+// a tenant without one can't export, and a source without tables is refused
+func parseExportSources(value string, defaultSource string, tables string, defaultTables string) (map[string]export.Source, error) {
+	sources := make(map[string]export.Source)
+	if defaultSource != "" {
+		sources[defaultTenant] = export.Source{Path: defaultSource}
+	}
+	if value != "" {
+		for _, item := range strings.Split(value, ",") {
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, errors.New("Invalid export source, expected tenant=path: " + item)
+			}
+			if _, ok := sources[parts[0]]; ok {
+				return nil, errors.New("Export source of the tenant given twice: " + parts[0])
+			}
+			sources[parts[0]] = export.Source{Path: parts[1]}
+		}
+	}
+	items := []string{}
+	if defaultTables != "" {
+		for _, table := range strings.Split(defaultTables, ",") {
+			items = append(items, defaultTenant+"="+table)
+		}
+	}
+	if tables != "" {
+		items = append(items, strings.Split(tables, ",")...)
+	}
+	for _, item := range items {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("Invalid export table, expected tenant=table: " + item)
+		}
+		source, ok := sources[parts[0]]
+		if !ok {
+			return nil, errors.New("Export table of a tenant without an export source: " + item)
+		}
+		source.Tables = append(source.Tables, parts[1])
+		sources[parts[0]] = source
+	}
+	for tenant, source := range sources {
+		if len(source.Tables) == 0 {
+			return nil, errors.New("No export table given for the export source of the tenant: " + tenant)
+		}
+	}
+	return sources, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+)
+
+// exportEnv configures the exports with a source seeded with the rows
+// of the test and temporary directories, until the returned
+// function restores the configuration
+func exportEnv(t *testing.T, tenant string) (*export.Config, func()) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "source.db")
+	db, err := sql.Open("sqlite3", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE responses (id INTEGER, answer TEXT, note TEXT, created_at TEXT);
+		INSERT INTO responses VALUES
+			(1, 'before the range', NULL, '2021-01-01 23:59:59'),
+			(2, 'first second', NULL, '2021-01-02 00:00:00'),
+			(3, 'last second', 'late', '2021-01-02 23:59:59'),
+			(4, 'date only', NULL, '2021-01-02'),
+			(5, 'said "yes", then
+no', '', '2021-01-03 00:00:00'),
+			(6, 'to_date', NULL, '2021-01-04 00:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &export.Config{
+		Sources:   map[string]export.Source{tenant: {Path: source, Tables: []string{"responses"}}},
+		Dir:       filepath.Join(dir, "exports"),
+		Artifacts: newLocalArtifactStore(filepath.Join(dir, "artifacts")),
+	}
+	if err = jobs.Configure(export.Name, config); err != nil {
+		t.Fatal(err)
+	}
+	return config, func() {
+		jobs.Configure(export.Name, nil)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestParseExportSources(t *testing.T) {
+	tests := []struct {
+		value, defaultSource  string
+		tables, defaultTables string
+		want                  map[string]export.Source // Nil if invalid
+	}{
+		{"", "", "", "", map[string]export.Source{}},
+		{"", "main.db", "", "responses", map[string]export.Source{defaultTenant: {Path: "main.db", Tables: []string{"responses"}}}},
+		{
+			"acme=acme.db,beta=/data/beta.db", "main.db", "acme=responses,beta=answers,acme=answers", "responses,answers",
+			map[string]export.Source{
+				defaultTenant: {Path: "main.db", Tables: []string{"responses", "answers"}},
+				"acme":        {Path: "acme.db", Tables: []string{"responses", "answers"}},
+				"beta":        {Path: "/data/beta.db", Tables: []string{"answers"}},
+			},
+		},
+		{"acme=acme.db", "", "acme=responses", "", map[string]export.Source{"acme": {Path: "acme.db", Tables: []string{"responses"}}}},
+		{"acme", "", "", "", nil},
+		{"acme=", "", "", "", nil},
+		{"=acme.db", "", "", "", nil},
+		{"acme=a.db,acme=b.db", "", "acme=responses", "", nil},
+		{"default=other.db", "main.db", "", "responses", nil},
+		// Every source has its tables, and every table its source
+		{"", "main.db", "", "", nil},
+		{"acme=acme.db", "main.db", "", "responses", nil},
+		{"", "main.db", "acme=responses", "responses", nil},
+		{"", "", "", "responses", nil},
+		{"acme=acme.db", "", "acme", "", nil},
+		{"acme=acme.db", "", "acme=", "", nil},
+	}
+	for _, test := range tests {
+		sources, err := parseExportSources(test.value, test.defaultSource, test.tables, test.defaultTables)
+		if test.want == nil && err == nil || test.want != nil && !reflect.DeepEqual(sources, test.want) {
+			t.Errorf("parseExportSources(%q, %q, %q, %q) = %v, %v, want %v", test.value, test.defaultSource, test.tables, test.defaultTables, sources, err, test.want)
+		}
+	}
+}
+
+// failingArtifactStore fails to remove the artifacts
+type failingArtifactStore struct {
+	*localArtifactStore
+}
+
+func (store failingArtifactStore) Remove(jobID uuid.UUID, name string) error {
+	return errors.New("remove " + name + ": permission denied")
+}
+
+// TestStopCleanError checks that the error of the rollback of a stopped export
+// is returned by the stop and kept in the details of the job
+func TestStopCleanError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config, restore := exportEnv(t, defaultTenant)
+	defer restore()
+	config.Artifacts = failingArtifactStore{config.Artifacts.(*localArtifactStore)}
+	store := newMemoryStore()
+	record := &JobRecord{
+		JobID: uuid.New(), Type: export.Name, Status: Halted, SubmittedAt: time.Now(),
+		Args:       map[string]interface{}{"from_date": "2021-Jan-01", "to_date": "2021-Jan-03", "table": "responses"},
+		Checkpoint: map[string]interface{}{"cur_date": "2021-Jan-03", "artifacts": []jobs.Artifact{{Name: "export.csv"}}},
+	}
+	if err := store.save(record); err != nil {
+		t.Fatal(err)
+	}
+	manager := newTestManager(t, store, 0)
+	if err := manager.loadJobs(); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(principalKey, &Principal{Role: Operator, Tenant: defaultTenant})
+	})
+	r.GET("/stop/:jobID", manager.stopJob)
+	r.GET("/details/:jobID", manager.detailsJob)
+
+	cleanErr := "Failed to clean the Job : remove export.csv: permission denied"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stop/"+record.JobID.String(), nil))
+	var res httpResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("stop = %d %s", w.Code, w.Body.String())
+	}
+	if res.Details["clean_error"] != cleanErr {
+		t.Errorf("clean_error of the stop = %v, want %s", res.Details["clean_error"], cleanErr)
+	}
+	stored, err := store.get(record.JobID)
+	if err != nil || stored.Status != Stopped || stored.CleanError != cleanErr {
+		t.Errorf("record saved as %s with clean error %q, want %s with %s", stored.Status, stored.CleanError, Stopped, cleanErr)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/details/"+record.JobID.String(), nil))
+	if err = json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Details["clean_error"] != cleanErr {
+		t.Errorf("details = %s, want the clean error", w.Body.String())
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// fairShare configures how the workers are shared between the tenants.
+// The next job started is taken from the tenant with the lowest share,
+// its running jobs divided by its weight, so that busy tenants get workers
+// in proportion to their weights whatever the number of jobs they queued.
+// Within a tenant, the types can be shared the same way
+type fairShare struct {
+	enabled       bool           // Jobs are started by priority across every tenant if false
+	types         bool           // Share the workers of a tenant between its job types
+	tenantWeights map[string]int // Weight of the tenants, 1 if missing
+	typeWeights   map[string]int // Weight of the job types, 1 if missing
+}
+
+func (share *fairShare) tenantWeight(tenant string) int {
+	if weight, ok := share.tenantWeights[tenant]; ok {
+		return weight
+	}
+	return 1
+}
+
+func (share *fairShare) typeWeight(jobType string) int {
+	if weight, ok := share.typeWeights[jobType]; ok {
+		return weight
+	}
+	return 1
+}
+
+// parseWeights parses the weights given as a comma separated list of name=weight,
+// known checks the names if not nil
+func parseWeights(value string, known func(name string) bool) (map[string]int, error) {
+	weights := make(map[string]int)
+	if value == "" {
+		return weights, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New("Invalid weight, expected name=weight: " + item)
+		}
+		if known != nil && !known(parts[0]) {
+			return nil, errors.New("Invalid weight, unknown name: " + item)
+		}
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil || weight <= 0 {
+			return nil, errors.New("Invalid weight, expected a positive number: " + item)
+		}
+		weights[parts[0]] = weight
+	}
+	return weights, nil
+}
+
+// usage counts the jobs holding a worker by type, by tenant and by type of each tenant
+type usage struct {
+	types       map[string]int
+	tenants     map[string]int
+	tenantTypes map[string]int // By tenant and type, see tenantType
+}
+
+func newUsage(jobs map[uuid.UUID]queuedJob) *usage {
+	u := &usage{
+		types:       make(map[string]int),
+		tenants:     make(map[string]int),
+		tenantTypes: make(map[string]int),
+	}
+	for _, job := range jobs {
+		u.add(job)
+	}
+	return u
+}
+
+func (u *usage) add(job queuedJob) {
+	u.types[job.jobType]++
+	u.tenants[job.tenant]++
+	u.tenantTypes[tenantType(job)]++
+}
+
+func tenantType(job queuedJob) string {
+	return job.tenant + "\x00" + job.jobType
+}
+
+// fairer returns true if job a should be started before job b according
+// to the shares of their tenants, and of their types within the same tenant.
+// Shares are compared as running/weight without dividing
+func (share *fairShare) fairer(a queuedJob, b queuedJob, u *usage) bool {
+	if !share.enabled {
+		return false
+	}
+	sa := u.tenants[a.tenant] * share.tenantWeight(b.tenant)
+	sb := u.tenants[b.tenant] * share.tenantWeight(a.tenant)
+	if sa != sb || a.tenant != b.tenant || !share.types {
+		return sa < sb
+	}
+	return u.tenantTypes[tenantType(a)]*share.typeWeight(b.jobType) < u.tenantTypes[tenantType(b)]*share.typeWeight(a.jobType)
+}
+
+// next returns the index of the next job to start among the jobs sorted
+// by priority, or -1 if none is eligible. It is the first eligible job
+// unless an eligible job of a tenant, or type, with a lower share follows it
+func (share *fairShare) next(jobs []queuedJob, u *usage, eligible func(job queuedJob) bool) int {
+	best := -1
+	for i, job := range jobs {
+		if !eligible(job) {
+			continue
+		}
+		if best < 0 || share.fairer(job, jobs[best], u) {
+			best = i
+		}
+		if !share.enabled {
+			break
+		}
+	}
+	return best
+}
+
+// TenantShare represents the share of the workers of a tenant
+// FairShare is the share of the busy workers the tenant is entitled to, from its weight
+// Share is the share of the busy workers the tenant holds
+// QueuePosition is the position of the next job of the tenant in the dispatch order, 0 if it has none
+type TenantShare struct {
+	Tenant        string  `json:"tenant" example:"acme"`
+	Weight        int     `json:"weight" example:"2"`
+	FairShare     float64 `json:"fair_share" example:"0.5"`
+	Share         float64 `json:"share" example:"0.25"`
+	Running       int     `json:"running" example:"1"`
+	Queued        int     `json:"queued" example:"12"`
+	QueuePosition int     `json:"queue_position" example:"1"`
+}
+
+// SchedulerStats represents the sharing of the workers between the tenants
+type SchedulerStats struct {
+	FairShare      bool          `json:"fair_share" example:"true"`
+	FairShareTypes bool          `json:"fair_share_types" example:"false"`
+	Workers        int           `json:"workers" example:"4"`
+	Running        int           `json:"running" example:"4"`
+	Queued         int           `json:"queued" example:"20"`
+	Tenants        []TenantShare `json:"tenants"`
+}
+
+// shares returns the share of the workers of the tenants with running or queued jobs,
+// only the given tenant is returned unless all is true
+func (s *scheduler) shares(tenant string, all bool) SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := SchedulerStats{
+		FairShare:      s.share.enabled,
+		FairShareTypes: s.share.types,
+		Workers:        s.workers,
+		Running:        len(s.running),
+		Queued:         len(s.queue),
+		Tenants:        []TenantShare{},
+	}
+	tenants := make(map[string]*TenantShare)
+	get := func(name string) *TenantShare {
+		if _, ok := tenants[name]; !ok {
+			tenants[name] = &TenantShare{Tenant: name, Weight: s.share.tenantWeight(name)}
+		}
+		return tenants[name]
+	}
+	for _, job := range s.running {
+		get(job.tenant).Running++
+	}
+	for i, job := range s.ordered() {
+		t := get(job.tenant)
+		t.Queued++
+		if t.QueuePosition == 0 {
+			t.QueuePosition = i + 1
+		}
+	}
+	weights := 0
+	for _, t := range tenants {
+		weights += t.Weight
+	}
+	for _, t := range tenants {
+		t.FairShare = float64(t.Weight) / float64(weights)
+		if len(s.running) > 0 {
+			t.Share = float64(t.Running) / float64(len(s.running))
+		}
+		if all || t.Tenant == tenant {
+			stats.Tenants = append(stats.Tenants, *t)
+		}
+	}
+	sort.Slice(stats.Tenants, func(i, j int) bool {
+		return stats.Tenants[i].Tenant < stats.Tenants[j].Tenant
+	})
+	return stats
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	"reflect"
+	"testing"
+)
+
+func TestSchedulerFairShare(t *testing.T) {
+	tests := []struct {
+		name       string
+		share      *fairShare
+		workers    int
+		running    []testJob
+		queued     []testJob
+		dispatched string
+		ordered    string // Dispatch order of the queue before dispatching
+	}{
+		{
+			name:       "disabled follows the priorities",
+			share:      &fairShare{},
+			workers:    4,
+			running:    []testJob{{name: "a1", tenant: "acme"}, {name: "a2", tenant: "acme"}},
+			queued:     []testJob{{name: "a3", tenant: "acme", priority: 9}, {name: "b1", tenant: "beta"}},
+			dispatched: "a3,b1",
+			ordered:    "a3,b1",
+		},
+		{
+			name:       "tenant with the lowest share first",
+			share:      &fairShare{enabled: true},
+			workers:    4,
+			running:    []testJob{{name: "a1", tenant: "acme"}, {name: "a2", tenant: "acme"}},
+			queued:     []testJob{{name: "a3", tenant: "acme", priority: 9}, {name: "b1", tenant: "beta"}},
+			dispatched: "b1,a3",
+			ordered:    "b1,a3",
+		},
+		{
+			name:       "tenants alternate",
+			share:      &fairShare{enabled: true},
+			workers:    4,
+			queued:     []testJob{{name: "a1", tenant: "acme"}, {name: "a2", tenant: "acme"}, {name: "a3", tenant: "acme"}, {name: "b1", tenant: "beta"}, {name: "b2", tenant: "beta"}},
+			dispatched: "a1,b1,a2,b2",
+			ordered:    "a1,b1,a2,b2,a3",
+		},
+		{
+			name:       "weights",
+			share:      &fairShare{enabled: true, tenantWeights: map[string]int{"acme": 3}},
+			workers:    4,
+			running:    []testJob{{name: "a1", tenant: "acme"}, {name: "a2", tenant: "acme"}, {name: "b1", tenant: "beta"}},
+			queued:     []testJob{{name: "b2", tenant: "beta"}, {name: "a3", tenant: "acme"}},
+			dispatched: "a3",
+			ordered:    "a3,b2",
+		},
+		{
+			name:       "priority within a tenant",
+			share:      &fairShare{enabled: true},
+			workers:    2,
+			queued:     []testJob{{name: "a1", tenant: "acme"}, {name: "a2", tenant: "acme", priority: 5}, {name: "b1", tenant: "beta"}},
+			dispatched: "a2,b1",
+			ordered:    "a2,b1,a1",
+		},
+		{
+			name:       "types shared within a tenant",
+			share:      &fairShare{enabled: true, types: true},
+			workers:    3,
+			running:    []testJob{{name: "s0", tenant: "acme"}},
+			queued:     []testJob{{name: "s1", tenant: "acme", priority: 5}, {name: "e1", tenant: "acme", jobType: export.Name}},
+			dispatched: "e1,s1",
+			ordered:    "e1,s1",
+		},
+		{
+			name:       "types not shared",
+			share:      &fairShare{enabled: true},
+			workers:    3,
+			running:    []testJob{{name: "s0", tenant: "acme"}},
+			queued:     []testJob{{name: "s1", tenant: "acme", priority: 5}, {name: "e1", tenant: "acme", jobType: export.Name}},
+			dispatched: "s1,e1",
+			ordered:    "s1,e1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, names := testScheduler(test.workers, nil, noQuotas, test.share, 0, test.running, test.queued)
+			if got := jobNames(s.ordered(), names); got != test.ordered {
+				t.Errorf("ordered = %s, want %s", got, test.ordered)
+			}
+			if got := jobNames(s.dispatch(), names); got != test.dispatched {
+				t.Errorf("dispatch = %s, want %s", got, test.dispatched)
+			}
+		})
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	known := func(name string) bool { return name != "unknown" }
+	tests := []struct {
+		value   string
+		weights map[string]int
+		valid   bool
+	}{
+		{"", map[string]int{}, true},
+		{"acme=3,beta=1", map[string]int{"acme": 3, "beta": 1}, true},
+		{"acme=0", nil, false},
+		{"acme", nil, false},
+		{"unknown=2", nil, false},
+	}
+	for _, test := range tests {
+		weights, err := parseWeights(test.value, known)
+		if (err == nil) != test.valid {
+			t.Errorf("parseWeights(%q) = %v, want valid %v", test.value, err, test.valid)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(weights, test.weights) {
+			t.Errorf("parseWeights(%q) = %v, want %v", test.value, weights, test.weights)
+		}
+	}
+}
@@ -2,202 +2,86 @@ package main
 
 import (
 	"errors"
-	"log"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
 )
 
-// JobInterface is the common interface that every
-// different job should implement
-type JobInterface interface {
-	start() error                    // Start the job processing
-	halt() error                     // Halt or pause the job processing
-	resume() error                   // Resume any halted/paused job
-	stop() error                     // Stop processing of any running or halted job
-	clean() error                    // Clean method can be used to rollback any changes when job is stopped
-	details() map[string]interface{} // Return details about the Job as a Map
+// cleanError is returned when a job is stopped but fails
+// to roll back its changes
+type cleanError struct {
+	err error
 }
 
-// Job is a generic simple job
-type Job struct {
-	status  string
-	jobID   uuid.UUID
-	sigChan chan Signal
+func (err *cleanError) Error() string {
+	return "Failed to clean the Job : " + err.err.Error()
 }
 
-// Signal is the representation of different signals
-// that can be sent to Job
-type Signal int
-
-// Different types of signals sent to Job.run() method
-const (
-	halt Signal = iota
-	stop
-)
-
-func (job *Job) run() {
-	for {
-		select {
-		case sig := <-job.sigChan:
-			switch sig {
-			case halt:
-				return
-			case stop:
-				return
-			}
-		default:
-			switch job.status {
-			case Running:
-				log.Println("Doing Job")
-				time.Sleep(time.Second)
-			}
-		}
+// storedDetails returns the details of a job which isn't live from its record,
+// with the progress saved at its last transition
+func storedDetails(record *JobRecord) map[string]interface{} {
+	var details map[string]interface{}
+	if jobType, ok := jobs.Lookup(record.Type); ok && jobType.Details != nil {
+		details = jobType.Details(jobs.Spec{JobID: record.JobID, Tenant: tenantOf(record.Tenant), Args: record.Args, Checkpoint: record.Checkpoint, Config: jobType.Config})
+	} else {
+		details = map[string]interface{}{"jobID": record.JobID}
 	}
-}
-
-func (job *Job) start() error {
-	switch job.status {
-	case Running:
-		return errors.New("Failed to start the Job : Job already running")
-	case Halted:
-		return errors.New("Failed to start the Job : Job is halted. Try to resume the job")
-	}
-	job.status = Running
-	go job.run()
-	return nil
-}
-
-func (job *Job) halt() error {
-	switch job.status {
-	case Submitted:
-		return errors.New("Failed to halt the Job : Job is not running")
-	case Halted:
-		return errors.New("Failed to halt the Job : Job is already halted")
+	details["status"] = record.Status
+	details["progress"] = Progress{}
+	if record.Progress != nil {
+		details["progress"] = *record.Progress
 	}
-	job.status = Halted
-	job.sigChan <- halt
-	return nil
+	return details
 }
 
-func (job *Job) stop() error {
-	if job.status == Submitted {
-		return errors.New("Failed to stop the Job : Job not running")
+// buildSubmittedJob builds the job of a record being submitted, once the settings
+// only checked on submit are validated. The callback URL isn't checked again
+// when the job is built from its record after a restart, as the allowed
+// addresses may have changed since, they are enforced when sending the payloads
+func buildSubmittedJob(record *JobRecord, checkpoint jobs.Checkpointer, logger *jobLogger) (jobs.Job, error) {
+	if record.CallbackURL != "" {
+		if err := validateWebhookURL(record.CallbackURL); err != nil {
+			return nil, err
+		}
 	}
-	job.sigChan <- stop
-	return nil
+	return buildJob(record, checkpoint, logger)
 }
 
-func (job *Job) resume() error {
-	if job.status != Halted {
-		return errors.New("Failed to resume the Job : Job not halted")
+// buildJob creates the job described by the record with the constructor
+// of its registered type, once its arguments are validated against the
+// schema of the type. Defaults of the missing arguments are set in the record
+func buildJob(record *JobRecord, checkpoint jobs.Checkpointer, logger *jobLogger) (jobs.Job, error) {
+	if record.Timeout != "" {
+		if d, err := time.ParseDuration(record.Timeout); err != nil || d <= 0 {
+			return nil, errors.New("Invalid timeout: " + record.Timeout)
+		}
 	}
-	job.status = Running
-	go job.run()
-	return nil
-}
-
-func (job *Job) clean() error {
-	return nil
-}
-
-func (job *Job) details() map[string]interface{} {
-	details := make(map[string]interface{})
-	details["jobID"] = job.jobID
-	details["status"] = job.status
-	return details
-}
-
-// ExportJob represents a Export data job having fromDate and toDate as arguments
-type ExportJob struct {
-	status  string
-	jobID   uuid.UUID
-	sigChan chan Signal
-
-	fromDate time.Time
-	toDate   time.Time
-	curDate  time.Time
-}
-
-func (job *ExportJob) run() {
-	for {
-		select {
-		case sig := <-job.sigChan:
-			switch sig {
-			case halt:
-				job.status = Halted
-				return
-			case stop:
-				return
-			}
-		default:
-			switch job.status {
-			case Running:
-				if job.curDate.After(job.fromDate) && job.curDate.Before(job.toDate) {
-					// Assuming we have access to some database from which we need to
-					// export the data. Assuming each export operation to take a second
-					log.Println("Exporting data: ", job.curDate.Format(timeLayout))
-					job.curDate = job.curDate.Add(time.Hour * 24)
-					time.Sleep(time.Second)
-				}
-			}
+	if record.Retry != nil {
+		if err := record.Retry.validate(); err != nil {
+			return nil, err
 		}
 	}
-}
-
-func (job *ExportJob) start() error {
-	switch job.status {
-	case Running:
-		return errors.New("Failed to start the Job : Job already running")
-	case Halted:
-		return errors.New("Failed to start the Job : Job is halted. Try to resume the job")
+	jobType, ok := jobs.Lookup(record.Type)
+	if !ok {
+		return nil, errors.New("Invalid Job Type, expected one of: " + strings.Join(jobs.Names(), ", "))
 	}
-	job.status = Running
-	go job.run()
-	return nil
-}
-
-func (job *ExportJob) halt() error {
-	switch job.status {
-	case Submitted:
-		return errors.New("Failed to halt the Job : Job is not running")
-	case Halted:
-		return errors.New("Failed to halt the Job : Job is already halted")
+	args, err := jobType.ValidateArgs(record.Args)
+	if err != nil {
+		return nil, err
 	}
-	job.status = Halted
-	job.sigChan <- halt
-	return nil
-}
-
-func (job *ExportJob) stop() error {
-	switch job.status {
-	case Submitted:
-		return errors.New("Failed to stop the Job : Job not running")
-	case Halted:
-		return nil
+	record.Args = args
+	spec := jobs.Spec{
+		JobID:        record.JobID,
+		Tenant:       tenantOf(record.Tenant),
+		Args:         args,
+		Checkpoint:   record.Checkpoint,
+		Checkpointer: checkpoint,
+		Config:       jobType.Config,
 	}
-	job.sigChan <- stop
-	return nil
-}
-
-func (job *ExportJob) resume() error {
-	if job.status != Halted {
-		return errors.New("Failed to resume the Job : Job not halted")
+	// A nil logger would make a non nil interface
+	if logger != nil {
+		spec.Logger = logger
 	}
-	job.status = Running
-	go job.run()
-	return nil
-}
-
-func (job *ExportJob) clean() error {
-	return nil
-}
-
-func (job *ExportJob) details() map[string]interface{} {
-	details := make(map[string]interface{})
-	details["jobID"] = job.jobID
-	details["status"] = job.status
-	details["from_date"] = job.fromDate.Format(timeLayout)
-	details["to_date"] = job.toDate.Format(timeLayout)
-	return details
+	return jobType.Build(spec)
 }
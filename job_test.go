@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+func TestStoredDetails(t *testing.T) {
+	tests := []struct {
+		name   string
+		record *JobRecord
+		want   map[string]interface{}
+		done   int
+	}{
+		{
+			name: "export submitted before the table arg",
+			record: &JobRecord{Type: export.Name, Status: Completed,
+				Args:       map[string]interface{}{"from_date": "2021-Jan-01", "to_date": "2021-Jan-05"},
+				Checkpoint: map[string]interface{}{"cur_date": "2021-Jan-05", "offset": 120.0, "rows": 12.0},
+				Progress:   &Progress{Done: 3, Total: 4},
+			},
+			want: map[string]interface{}{"from_date": "2021-Jan-01", "to_date": "2021-Jan-05", "cur_date": "2021-Jan-05", "format": export.CSVFormat, "rows": int64(12)},
+			done: 3,
+		},
+		{
+			name: "stopped export",
+			record: &JobRecord{Type: export.Name, Status: Stopped,
+				Args: map[string]interface{}{"from_date": "2021-Jan-01", "to_date": "2021-Jan-05", "table": "responses", "format": export.JSONLFormat},
+			},
+			want: map[string]interface{}{"table": "responses", "format": export.JSONLFormat, "rows": int64(0)},
+		},
+		{
+			name:   "simple job",
+			record: &JobRecord{Type: simple.Name, Status: Stopped, Progress: &Progress{Done: 7}},
+			want:   map[string]interface{}{},
+			done:   7,
+		},
+		{
+			name:   "unknown type",
+			record: &JobRecord{Type: "Removed", Status: Failed},
+			want:   map[string]interface{}{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.record.JobID = uuid.New()
+			details := storedDetails(test.record)
+			if details["jobID"] != test.record.JobID {
+				t.Errorf("jobID = %v, want %v", details["jobID"], test.record.JobID)
+			}
+			if details["status"] != test.record.Status {
+				t.Errorf("status = %v, want %s", details["status"], test.record.Status)
+			}
+			if progress := details["progress"].(Progress); progress.Done != test.done {
+				t.Errorf("progress.done = %d, want %d", progress.Done, test.done)
+			}
+			for key, value := range test.want {
+				if details[key] != value {
+					t.Errorf("%s = %v, want %v", key, details[key], value)
+				}
+			}
+		})
+	}
+}
+
+// TestCallbackValidatedOnSubmit checks that the callback URL of a job
+// is only validated on submit, not when the job is built again
+func TestCallbackValidatedOnSubmit(t *testing.T) {
+	tests := []struct {
+		callback string
+		valid    bool
+	}{
+		{"", true},
+		{"https://example.com/hooks", true},
+		{"http://169.254.169.254/latest", false},
+		{"ftp://example.com", false},
+	}
+	for _, test := range tests {
+		record := &JobRecord{JobID: uuid.New(), Type: simple.Name, Status: Submitted, CallbackURL: test.callback}
+		if _, err := buildSubmittedJob(record, nil, nil); (err == nil) != test.valid {
+			t.Errorf("buildSubmittedJob(%q) = %v, want valid %v", test.callback, err, test.valid)
+		}
+		record.Status = Halted
+		if _, err := buildJob(record, nil, nil); err != nil {
+			t.Errorf("buildJob(%q) = %v, want the job built from its record", test.callback, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Artifact describes a file produced by a job, its content is kept
+// in the artifact store while its metadata is part of the job state
+type Artifact struct {
+	Name        string    `json:"name" example:"export.csv"`
+	Size        int64     `json:"size" example:"1024"`
+	Checksum    string    `json:"checksum" example:"sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	ContentType string    `json:"content_type" example:"text/csv"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ArtifactStore keeps the content of the artifacts of the jobs
+type ArtifactStore interface {
+	// Put saves the content as the artifact of the job and returns its metadata
+	Put(jobID uuid.UUID, name string, contentType string, content io.ReadSeeker) (*Artifact, error)
+	// Open returns the content of the artifact, seeking is cheap
+	Open(jobID uuid.UUID, artifact *Artifact) (io.ReadSeeker, io.Closer, error)
+	// Remove deletes the artifact, removing a missing artifact isn't an error
+	Remove(jobID uuid.UUID, name string) error
+}
+
+// CheckpointArtifacts returns the artifacts saved in a checkpoint,
+// which are maps once the checkpoint went through JSON
+func CheckpointArtifacts(value interface{}) []Artifact {
+	artifacts := []Artifact{}
+	if value == nil {
+		return artifacts
+	}
+	if list, ok := value.([]Artifact); ok {
+		return append(artifacts, list...)
+	}
+	buf, err := json.Marshal(value)
+	if err == nil {
+		json.Unmarshal(buf, &artifacts)
+	}
+	return artifacts
+}
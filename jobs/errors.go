@@ -0,0 +1,38 @@
+package jobs
+
+import "errors"
+
+// Classes of the errors returned by jobs, used by the retry policies
+const (
+	TransientError string = "transient" // Temporary failure, e.g. the database is unreachable
+	PermanentError string = "permanent" // Failure which won't go away by retrying, the default class
+)
+
+// classifiedError is an error returned by a job along with its class
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// Transient marks the error as a temporary failure of the job
+func Transient(err error) error {
+	return &classifiedError{TransientError, err}
+}
+
+// ErrorClass returns the class of an error returned by a job,
+// which may wrap the classified error
+func ErrorClass(err error) string {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+	return PermanentError
+}
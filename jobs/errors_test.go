@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestErrorClass(t *testing.T) {
+	if class := ErrorClass(Transient(errors.New("timeout"))); class != TransientError {
+		t.Errorf("ErrorClass(Transient) = %s", class)
+	}
+	if class := ErrorClass(errors.New("bad")); class != PermanentError {
+		t.Errorf("ErrorClass(plain) = %s", class)
+	}
+	wrapped := fmt.Errorf("day 2021-Jan-02: %w", Transient(io.ErrUnexpectedEOF))
+	if class := ErrorClass(wrapped); class != TransientError {
+		t.Errorf("ErrorClass(wrapped Transient) = %s", class)
+	}
+	if !errors.Is(wrapped, io.ErrUnexpectedEOF) {
+		t.Errorf("errors.Is(wrapped Transient, cause) = false")
+	}
+}
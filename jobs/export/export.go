@@ -0,0 +1,611 @@
+// Package export registers the export job type, which exports the rows of
+// a table of the SQLite database of its tenant day by day. The server
+// configures it with jobs.Configure before building any export
+package export
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3" // SQLite driver of the export source
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the name of the export job type
+const Name string = "Export"
+
+// tracerName names the tracer of the spans of the exports
+const tracerName = "github.com/psinghal20/atlan-assignment/jobs/export"
+
+// Output formats of the exports
+const (
+	CSVFormat   string = "csv"   // Comma separated values, with a header row
+	JSONLFormat string = "jsonl" // JSON Lines, an object per row
+)
+
+// contentTypes of the artifacts of the exports by format
+var contentTypes = map[string]string{
+	CSVFormat:   "text/csv",
+	JSONLFormat: "application/x-ndjson",
+}
+
+// identifierPattern restricts the table and column names,
+// which can't be passed as query parameters
+const identifierPattern = "^[A-Za-z_][A-Za-z0-9_]*$"
+
+// Config is the configuration of the export job type, set with
+// jobs.Configure before any export is built
+type Config struct {
+	Sources      map[string]Source      // SQLite databases the exports read from by tenant
+	Dir          string                 // Directory the exports are written to until they are saved as artifacts
+	Artifacts    jobs.ArtifactStore     // Store the exports are saved to
+	DayDurations prometheus.ObserverVec // Time to export a day by format, not observed if nil
+}
+
+// Source is a SQLite database the exports of a tenant read from
+type Source struct {
+	Path   string   // Path of the database
+	Tables []string // Tables the tenant can export, no other table is read
+}
+
+// allows reports whether the table can be exported from the source,
+// table names are case insensitive in SQLite
+func (source Source) allows(table string) bool {
+	for _, allowed := range source.Tables {
+		if strings.EqualFold(allowed, table) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	jobs.Register(jobs.Type{
+		Name:        Name,
+		Description: "Exports the rows of every day between from_date and to_date from the export source",
+		Args: jobs.ArgsSchema{
+			Properties: map[string]jobs.ArgSchema{
+				"from_date": {
+					Type:        "string",
+					Format:      "day",
+					Description: "Day before the first day exported",
+				},
+				"to_date": {
+					Type:        "string",
+					Format:      "day",
+					Description: "Day after the last day exported",
+				},
+				"table": {
+					Type:        "string",
+					Pattern:     identifierPattern,
+					Description: "Table exported, one of the tables of the export source of the tenant",
+				},
+				"columns": {
+					Type:        "array",
+					Items:       &jobs.ArgSchema{Type: "string", Pattern: identifierPattern},
+					Description: "Columns exported, every column if empty",
+				},
+				"date_column": {
+					Type:        "string",
+					Pattern:     identifierPattern,
+					Description: "Column holding the ISO 8601 date of the rows, e.g. 2006-01-02 15:04:05",
+					Default:     "created_at",
+				},
+				"format": {
+					Type:        "string",
+					Enum:        []interface{}{CSVFormat, JSONLFormat},
+					Description: "Format of the output file",
+					Default:     CSVFormat,
+				},
+				"keep_partial": {
+					Type:        "boolean",
+					Description: "Keep the days exported before the job is stopped as the export.partial artifact, instead of removing them",
+					Default:     false,
+				},
+			},
+			Required: []string{"from_date", "to_date", "table"},
+		},
+		Build:   build,
+		Details: details,
+	})
+}
+
+// details returns the details of an ended export from its args and checkpoint.
+// The exports submitted before the table arg only have the dates
+func details(spec jobs.Spec) map[string]interface{} {
+	details := make(map[string]interface{})
+	details["jobID"] = spec.JobID
+	details["from_date"], _ = spec.Args["from_date"].(string)
+	details["to_date"], _ = spec.Args["to_date"].(string)
+	if curDate, ok := spec.Checkpoint["cur_date"].(string); ok {
+		details["cur_date"] = curDate
+	}
+	if table, ok := spec.Args["table"].(string); ok {
+		details["table"] = table
+	}
+	details["format"] = CSVFormat
+	if format, ok := spec.Args["format"].(string); ok {
+		details["format"] = format
+	}
+	details["rows"] = checkpointInt(spec.Checkpoint["rows"])
+	details["artifacts"] = jobs.CheckpointArtifacts(spec.Checkpoint["artifacts"])
+	return details
+}
+
+// build creates the export, continuing from its checkpoint if any.
+// It doesn't touch the source nor the output, which are opened by step
+func build(spec jobs.Spec) (jobs.Job, error) {
+	config, ok := spec.Config.(*Config)
+	if !ok {
+		return nil, errors.New("Export jobs aren't configured")
+	}
+	// The args are validated against the schema, parsing can't fail
+	fromDate, _ := time.Parse(jobs.DayLayout, spec.Args["from_date"].(string))
+	toDate, _ := time.Parse(jobs.DayLayout, spec.Args["to_date"].(string))
+	table := spec.Args["table"].(string)
+	// The schema of the source is only readable by the operators
+	if strings.HasPrefix(strings.ToLower(table), "sqlite_") {
+		return nil, &jobs.ArgsError{Fields: []jobs.FieldError{{Field: "args.table", Error: "Internal tables can't be exported"}}}
+	}
+	source, ok := config.Sources[spec.Tenant]
+	if !ok {
+		return nil, &jobs.ArgsError{Fields: []jobs.FieldError{{Field: "args.table", Error: "No export source configured for the tenant " + spec.Tenant}}}
+	}
+	if !source.allows(table) {
+		return nil, &jobs.ArgsError{Fields: []jobs.FieldError{{Field: "args.table", Error: "Not exported from the source of the tenant, expected one of: " + strings.Join(source.Tables, ", ")}}}
+	}
+	columns := []string{}
+	if values, ok := spec.Args["columns"].([]interface{}); ok {
+		for _, value := range values {
+			columns = append(columns, value.(string))
+		}
+	}
+	job := &Job{
+		config:      config,
+		jobID:       spec.JobID,
+		tenant:      spec.Tenant,
+		checkpoint:  spec.Checkpointer,
+		logger:      spec.Logger,
+		fromDate:    fromDate,
+		toDate:      toDate,
+		curDate:     fromDate.Add(time.Hour * 24),
+		table:       table,
+		columns:     columns,
+		dateColumn:  spec.Args["date_column"].(string),
+		format:      spec.Args["format"].(string),
+		keepPartial: spec.Args["keep_partial"].(bool),
+		artifacts:   []jobs.Artifact{},
+	}
+	if checkpointDate, ok := spec.Checkpoint["cur_date"].(string); ok {
+		date, err := time.Parse(jobs.DayLayout, checkpointDate)
+		if err != nil {
+			return nil, errors.New("Invalid cur_date checkpoint")
+		}
+		job.curDate = date
+		job.offset = checkpointInt(spec.Checkpoint["offset"])
+		job.rows = checkpointInt(spec.Checkpoint["rows"])
+		job.artifacts = jobs.CheckpointArtifacts(spec.Checkpoint["artifacts"])
+	}
+	return job, nil
+}
+
+// checkpointInt returns the number saved in a checkpoint,
+// which is a float64 once the checkpoint went through JSON
+func checkpointInt(value interface{}) int64 {
+	switch n := value.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// Job represents a Export data job having fromDate and toDate as arguments.
+// Every step appends the rows of a day to the output file, and checkpoints
+// the size of the file so that the rows of a step interrupted half way
+// are truncated before the day is exported again.
+// Once every day is exported the output is saved as an artifact
+type Job struct {
+	config     *Config
+	jobID      uuid.UUID
+	tenant     string
+	checkpoint jobs.Checkpointer
+	logger     jobs.Logger
+
+	fromDate    time.Time
+	toDate      time.Time
+	curDate     time.Time
+	table       string
+	columns     []string
+	dateColumn  string
+	format      string
+	keepPartial bool
+
+	offset int64 // Size of the output once the days before curDate are exported
+	rows   int64 // Number of rows exported
+
+	artifacts []jobs.Artifact // Saved once the export is complete
+
+	db     *sql.DB  // Source, opened by the first step
+	output *os.File // Output, opened by the first step
+}
+
+// path of the output file of the export
+func (job *Job) path() string {
+	return filepath.Join(job.config.Dir, job.jobID.String()+"."+job.format)
+}
+
+// state returns the checkpoint of the export
+func (job *Job) state() map[string]interface{} {
+	return map[string]interface{}{
+		"cur_date":  job.curDate.Format(jobs.DayLayout),
+		"offset":    job.offset,
+		"rows":      job.rows,
+		"artifacts": job.artifacts,
+	}
+}
+
+// statement selects the rows of a day, which are bound as parameters.
+// The names of the table and columns match identifierPattern,
+// so quoting them is enough to keep them identifiers
+func (job *Job) statement() string {
+	columns := "*"
+	if len(job.columns) > 0 {
+		quoted := make([]string, 0, len(job.columns))
+		for _, column := range job.columns {
+			quoted = append(quoted, `"`+column+`"`)
+		}
+		columns = strings.Join(quoted, ", ")
+	}
+	return fmt.Sprintf(`SELECT %s FROM "%s" WHERE "%s" >= ? AND "%s" < ? ORDER BY "%s"`,
+		columns, job.table, job.dateColumn, job.dateColumn, job.dateColumn)
+}
+
+// open opens the source of the tenant read only and the output,
+// truncated to the size of the last checkpoint
+func (job *Job) open() error {
+	if job.db == nil {
+		// The source of the tenant is checked by build
+		db, err := sql.Open("sqlite3", "file:"+job.config.Sources[job.tenant].Path+"?mode=ro")
+		if err != nil {
+			return err
+		}
+		job.db = db
+	}
+	if job.output == nil {
+		if err := os.MkdirAll(job.config.Dir, 0755); err != nil {
+			return jobs.Transient(err)
+		}
+		output, err := os.OpenFile(job.path(), os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return jobs.Transient(err)
+		}
+		if err = output.Truncate(job.offset); err == nil {
+			_, err = output.Seek(job.offset, io.SeekStart)
+		}
+		if err != nil {
+			output.Close()
+			return jobs.Transient(err)
+		}
+		job.output = output
+	}
+	return nil
+}
+
+// close releases the source and the output until the next step
+func (job *Job) close() {
+	if job.db != nil {
+		job.db.Close()
+		job.db = nil
+	}
+	if job.output != nil {
+		job.output.Close()
+		job.output = nil
+	}
+}
+
+func (job *Job) Step(ctx context.Context) (bool, error) {
+	// The spans of the export are children of the run of the job, traced by its provider
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	if !job.curDate.Before(job.toDate) {
+		if len(job.artifacts) == 0 {
+			_, span := tracer.Start(ctx, "export.save", trace.WithAttributes(attribute.String("export.format", job.format)))
+			err := job.save("export." + job.format)
+			if err != nil {
+				fail(span, err)
+			}
+			span.End()
+			if err != nil {
+				job.close()
+				return false, err
+			}
+		}
+		job.close()
+		return true, nil
+	}
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "export.day", trace.WithAttributes(
+		attribute.String("export.date", job.curDate.Format(jobs.DayLayout)),
+		attribute.String("export.format", job.format),
+	))
+	defer span.End()
+	count, err := job.exportDay(ctx)
+	if err != nil {
+		// The output is truncated to the last checkpoint on the next step
+		job.close()
+		fail(span, err)
+		return false, err
+	}
+	offset, err := job.output.Seek(0, io.SeekCurrent)
+	if err != nil {
+		job.close()
+		fail(span, err)
+		return false, jobs.Transient(err)
+	}
+	// Checkpoint after every exported day so that a restart
+	// continues from the next day
+	next := *job
+	next.curDate, next.offset, next.rows = job.curDate.Add(time.Hour*24), offset, job.rows+count
+	if err = job.checkpoint(next.state()); err != nil {
+		job.close()
+		fail(span, err)
+		return false, jobs.Transient(errors.New("Failed to checkpoint the export: " + err.Error()))
+	}
+	job.logger.Debug("Exported the day", "date", job.curDate.Format(jobs.DayLayout), "rows", count)
+	job.curDate, job.offset, job.rows = next.curDate, next.offset, next.rows
+	span.SetAttributes(attribute.Int64("export.rows", count))
+	if job.config.DayDurations != nil {
+		job.config.DayDurations.WithLabelValues(job.format).Observe(time.Since(start).Seconds())
+	}
+	return false, nil
+}
+
+// save saves the output, up to the last checkpoint, as the artifact
+// of the given name and removes it once checkpointed
+func (job *Job) save(name string) error {
+	job.close()
+	if err := os.MkdirAll(job.config.Dir, 0755); err != nil {
+		return jobs.Transient(err)
+	}
+	// The output is created when no day was exported
+	output, err := os.OpenFile(job.path(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return jobs.Transient(err)
+	}
+	defer output.Close()
+	if err = output.Truncate(job.offset); err != nil {
+		return jobs.Transient(err)
+	}
+	artifact, err := job.config.Artifacts.Put(job.jobID, name, contentTypes[job.format], output)
+	if err != nil {
+		return jobs.Transient(errors.New("Failed to save the export: " + err.Error()))
+	}
+	job.artifacts = []jobs.Artifact{*artifact}
+	if err = job.checkpoint(job.state()); err != nil {
+		job.artifacts = []jobs.Artifact{}
+		return jobs.Transient(errors.New("Failed to checkpoint the export: " + err.Error()))
+	}
+	job.logger.Info("Saved the export", "artifact", name, "size", artifact.Size, "rows", job.rows)
+	if err = os.Remove(job.path()); err != nil {
+		job.logger.Warn("Failed to remove the saved export", "error", err)
+	}
+	return nil
+}
+
+// exportDay writes the rows of the current day to the output
+// and returns their number
+func (job *Job) exportDay(ctx context.Context) (int64, error) {
+	if err := job.open(); err != nil {
+		return 0, err
+	}
+	job.logger.Info("Exporting data", "date", job.curDate.Format(jobs.DayLayout))
+	rows, err := job.db.QueryContext(ctx, job.statement(),
+		job.curDate.Format("2006-01-02"), job.curDate.Add(time.Hour*24).Format("2006-01-02"))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	buf := bufio.NewWriter(job.output)
+	write := job.writer(buf, columns)
+	var count int64
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return 0, err
+		}
+		if err = write(values); err != nil {
+			return 0, jobs.Transient(err)
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if err = write(nil); err != nil {
+		return 0, jobs.Transient(err)
+	}
+	if err = buf.Flush(); err != nil {
+		return 0, jobs.Transient(err)
+	}
+	return count, nil
+}
+
+// writer returns the function writing a row in the format of the export,
+// which flushes its buffer when given no row. The header of a CSV
+// export is written before the rows of the first day
+func (job *Job) writer(w io.Writer, columns []string) func(values []interface{}) error {
+	if job.format == JSONLFormat {
+		encoder := json.NewEncoder(w)
+		return func(values []interface{}) error {
+			if values == nil {
+				return nil
+			}
+			row := make(map[string]interface{}, len(columns))
+			for i, column := range columns {
+				row[column] = jsonValue(values[i])
+			}
+			return encoder.Encode(row)
+		}
+	}
+	csvWriter := csv.NewWriter(w)
+	if job.offset == 0 {
+		csvWriter.Write(columns)
+	}
+	return func(values []interface{}) error {
+		if values == nil {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+		record := make([]string, len(values))
+		for i, value := range values {
+			record[i] = csvValue(value)
+		}
+		return csvWriter.Write(record)
+	}
+}
+
+// jsonValue converts a value scanned from the source to its JSON value
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// csvValue converts a value scanned from the source to a CSV field,
+// NULL is an empty field
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+func (job *Job) Start() error {
+	return nil
+}
+
+func (job *Job) Halt() error {
+	job.close()
+	return nil
+}
+
+func (job *Job) Stop() error {
+	job.close()
+	return nil
+}
+
+func (job *Job) Resume() error {
+	return nil
+}
+
+// Clean rolls back a stopped export by removing its output, its artifacts
+// and its checkpoint. With keep_partial the days exported so far are
+// saved as the export.partial artifact instead
+func (job *Job) Clean() error {
+	if job.keepPartial && job.offset > 0 && len(job.artifacts) == 0 {
+		return job.save("export.partial." + job.format)
+	}
+	if job.keepPartial && len(job.artifacts) > 0 {
+		return nil
+	}
+	failures := []string{}
+	if err := os.Remove(job.path()); err != nil && !os.IsNotExist(err) {
+		failures = append(failures, err.Error())
+	}
+	// Artifacts which can't be removed are kept in the checkpoint
+	remaining := []jobs.Artifact{}
+	for _, artifact := range job.artifacts {
+		if err := job.config.Artifacts.Remove(job.jobID, artifact.Name); err != nil {
+			failures = append(failures, err.Error())
+			remaining = append(remaining, artifact)
+		}
+	}
+	job.curDate = job.fromDate.Add(time.Hour * 24)
+	job.offset, job.rows, job.artifacts = 0, 0, remaining
+	state := job.state()
+	if len(remaining) == 0 {
+		state = nil
+	}
+	if err := job.checkpoint(state); err != nil {
+		failures = append(failures, "Failed to checkpoint the export: "+err.Error())
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+func (job *Job) Details() map[string]interface{} {
+	details := make(map[string]interface{})
+	details["jobID"] = job.jobID
+	details["from_date"] = job.fromDate.Format(jobs.DayLayout)
+	details["to_date"] = job.toDate.Format(jobs.DayLayout)
+	details["cur_date"] = job.curDate.Format(jobs.DayLayout)
+	details["table"] = job.table
+	details["format"] = job.format
+	details["rows"] = job.rows
+	details["artifacts"] = job.artifacts
+	return details
+}
+
+// Progress of an export is the number of days exported out of its range,
+// both from_date and to_date are excluded
+func (job *Job) Progress() jobs.Progress {
+	start := job.fromDate.Add(time.Hour * 24)
+	progress := jobs.Progress{
+		Done:  days(job.curDate.Sub(start)),
+		Total: days(job.toDate.Sub(start)),
+	}
+	if job.curDate.Before(job.toDate) {
+		progress.Current = job.curDate.Format(jobs.DayLayout)
+	}
+	return progress
+}
+
+// days returns the number of whole days of the duration, 0 if negative
+func days(d time.Duration) int {
+	if d < 0 {
+		return 0
+	}
+	return int(d / (time.Hour * 24))
+}
+
+// fail marks the span as failed with the error
+func fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,411 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+// dirStore keeps the artifacts in a directory by job, like the local store of the server
+type dirStore struct {
+	dir string
+}
+
+func (store *dirStore) path(jobID uuid.UUID, name string) string {
+	return filepath.Join(store.dir, jobID.String(), name)
+}
+
+func (store *dirStore) Put(jobID uuid.UUID, name string, contentType string, content io.ReadSeeker) (*jobs.Artifact, error) {
+	path := store.path(jobID, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	buf, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(path, buf, 0644); err != nil {
+		return nil, err
+	}
+	return &jobs.Artifact{Name: name, Size: int64(len(buf)), ContentType: contentType, CreatedAt: time.Now().UTC()}, nil
+}
+
+func (store *dirStore) Open(jobID uuid.UUID, artifact *jobs.Artifact) (io.ReadSeeker, io.Closer, error) {
+	file, err := os.Open(store.path(jobID, artifact.Name))
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file, nil
+}
+
+func (store *dirStore) Remove(jobID uuid.UUID, name string) error {
+	if err := os.Remove(store.path(jobID, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// nopLogger discards the log lines of the exports
+type nopLogger struct{}
+
+func (nopLogger) Debug(message string, fields ...interface{}) {}
+func (nopLogger) Info(message string, fields ...interface{})  {}
+func (nopLogger) Warn(message string, fields ...interface{})  {}
+func (nopLogger) Error(message string, fields ...interface{}) {}
+
+// newTestConfig returns the configuration of exports reading a source
+// of the tenant seeded with the rows of the tests, in a temporary
+// directory removed at the end of the test, and its artifact store
+func newTestConfig(t *testing.T, tenant string) (*Config, *dirStore) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	source := filepath.Join(dir, "source.db")
+	db, err := sql.Open("sqlite3", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE responses (id INTEGER, answer TEXT, note TEXT, created_at TEXT);
+		INSERT INTO responses VALUES
+			(1, 'before the range', NULL, '2021-01-01 23:59:59'),
+			(2, 'first second', NULL, '2021-01-02 00:00:00'),
+			(3, 'last second', 'late', '2021-01-02 23:59:59'),
+			(4, 'date only', NULL, '2021-01-02'),
+			(5, 'said "yes", then
+no', '', '2021-01-03 00:00:00'),
+			(6, 'to_date', NULL, '2021-01-04 00:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts := &dirStore{filepath.Join(dir, "artifacts")}
+	return &Config{
+		Sources:   map[string]Source{tenant: {Path: source, Tables: []string{"responses"}}},
+		Dir:       filepath.Join(dir, "exports"),
+		Artifacts: artifacts,
+	}, artifacts
+}
+
+// newJob validates the args against the schema like the server does
+// and builds the export of the tenant with the configuration
+func newJob(config interface{}, jobID uuid.UUID, tenant string, args map[string]interface{}, checkpoint map[string]interface{}, checkpointer jobs.Checkpointer) (*Job, error) {
+	jobType, _ := jobs.Lookup(Name)
+	args, err := jobType.ValidateArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	job, err := build(jobs.Spec{
+		JobID:        jobID,
+		Tenant:       tenant,
+		Args:         args,
+		Checkpoint:   checkpoint,
+		Checkpointer: checkpointer,
+		Logger:       nopLogger{},
+		Config:       config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job.(*Job), nil
+}
+
+// TestExportRange checks that both from_date and to_date are excluded from the export
+func TestExportRange(t *testing.T) {
+	tests := []struct {
+		from, to, cur string
+		done, total   int
+		current       string
+		finished      bool
+	}{
+		{"2021-Jan-01", "2021-Jan-05", "", 0, 3, "2021-Jan-02", false},
+		{"2021-Jan-01", "2021-Jan-05", "2021-Jan-04", 2, 3, "2021-Jan-04", false},
+		{"2021-Jan-01", "2021-Jan-05", "2021-Jan-05", 3, 3, "", true},
+		{"2021-Jan-01", "2021-Jan-02", "", 0, 0, "", true},
+	}
+	// The source is never read, the finished exports complete from their saved artifact
+	config := &Config{Sources: map[string]Source{"acme": {Path: "acme.db", Tables: []string{"responses"}}}}
+	for _, test := range tests {
+		var checkpoint map[string]interface{}
+		if test.cur != "" {
+			checkpoint = map[string]interface{}{"cur_date": test.cur, "artifacts": []jobs.Artifact{{Name: "export.csv"}}}
+		}
+		job, err := newJob(config, uuid.New(), "acme", map[string]interface{}{
+			"from_date": test.from, "to_date": test.to, "table": "responses",
+		}, checkpoint, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		progress := job.Progress()
+		if progress.Done != test.done || progress.Total != test.total || progress.Current != test.current {
+			t.Errorf("%s..%s at %q: progress = %+v, want done %d of %d at %q", test.from, test.to, test.cur, progress, test.done, test.total, test.current)
+		}
+		if test.finished && test.cur != "" {
+			// The artifact is saved, the step completes the job without reading the source
+			if done, err := job.Step(context.Background()); !done || err != nil {
+				t.Errorf("%s..%s at %q: step = %v, %v, want the job completed", test.from, test.to, test.cur, done, err)
+			}
+		}
+	}
+}
+
+// TestExportDays checks the rows exported for every day of the range
+// and the output of both formats, from a SQLite source
+func TestExportDays(t *testing.T) {
+	tests := []struct {
+		format string
+		rows   []int64 // Rows exported by the steps
+		output string
+	}{
+		{
+			CSVFormat,
+			[]int64{3, 4},
+			"id,answer,note\n" +
+				"4,date only,\n" +
+				"2,first second,\n" +
+				"3,last second,late\n" +
+				"5,\"said \"\"yes\"\", then\nno\",\n",
+		},
+		{
+			JSONLFormat,
+			[]int64{3, 4},
+			`{"answer":"date only","id":4,"note":null}` + "\n" +
+				`{"answer":"first second","id":2,"note":null}` + "\n" +
+				`{"answer":"last second","id":3,"note":"late"}` + "\n" +
+				`{"answer":"said \"yes\", then\nno","id":5,"note":""}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			config, artifacts := newTestConfig(t, "acme")
+			var state map[string]interface{}
+			jobID := uuid.New()
+			job, err := newJob(config, jobID, "acme", map[string]interface{}{
+				"from_date": "2021-Jan-01", "to_date": "2021-Jan-04", "table": "responses",
+				"columns": []interface{}{"id", "answer", "note"}, "format": test.format,
+			}, nil, func(checkpoint map[string]interface{}) error {
+				state = checkpoint
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, rows := range test.rows {
+				if done, err := job.Step(context.Background()); done || err != nil {
+					t.Fatalf("step = %v, %v, want a day exported", done, err)
+				}
+				if state["rows"] != rows {
+					t.Errorf("rows after exporting %s = %v, want %d", job.curDate.Add(-24*time.Hour).Format(jobs.DayLayout), state["rows"], rows)
+				}
+			}
+			if done, err := job.Step(context.Background()); !done || err != nil {
+				t.Fatalf("last step = %v, %v, want the export saved", done, err)
+			}
+			saved := state["artifacts"].([]jobs.Artifact)
+			if len(saved) != 1 || saved[0].Name != "export."+test.format {
+				t.Fatalf("artifacts = %+v, want export.%s", saved, test.format)
+			}
+			if _, err = os.Stat(job.path()); !os.IsNotExist(err) {
+				t.Errorf("output left once saved: %v", err)
+			}
+			output, err := ioutil.ReadFile(artifacts.path(jobID, saved[0].Name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(output) != test.output {
+				t.Errorf("output = %q, want %q", output, test.output)
+			}
+		})
+	}
+}
+
+// TestExportResume checks that the rows of a day written after the
+// last checkpoint are truncated when the export continues from it
+func TestExportResume(t *testing.T) {
+	config, artifacts := newTestConfig(t, "acme")
+	jobID := uuid.New()
+	args := map[string]interface{}{
+		"from_date": "2021-Jan-01", "to_date": "2021-Jan-04", "table": "responses",
+		"columns": []interface{}{"id"},
+	}
+	var state map[string]interface{}
+	checkpoint := func(checkpoint map[string]interface{}) error {
+		state = checkpoint
+		return nil
+	}
+	job, err := newJob(config, jobID, "acme", args, nil, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = job.Step(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	job.Halt()
+	// A restart after the second day was written but not checkpointed
+	output, err := os.OpenFile(job.path(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output.WriteString("5\n")
+	output.Close()
+
+	if job, err = newJob(config, jobID, "acme", args, state, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	for done := false; !done; {
+		if done, err = job.Step(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, _ := ioutil.ReadFile(artifacts.path(jobID, "export.csv"))
+	if want := "id\n4\n2\n3\n5\n"; string(content) != want {
+		t.Errorf("output = %q, want %q", content, want)
+	}
+	if state["rows"] != int64(4) {
+		t.Errorf("rows = %v, want 4", state["rows"])
+	}
+}
+
+// TestExportSourceOfTenant checks that an export only reads the source
+// of its tenant, and is refused for a tenant without a source
+func TestExportSourceOfTenant(t *testing.T) {
+	config, _ := newTestConfig(t, "acme")
+	tests := map[string]string{
+		"acme": "",
+		"beta": "Invalid args: args.table: No export source configured for the tenant beta",
+		"":     "Invalid args: args.table: No export source configured for the tenant ",
+	}
+	for tenant, want := range tests {
+		job, err := newJob(config, uuid.New(), tenant, map[string]interface{}{
+			"from_date": "2021-Jan-01", "to_date": "2021-Jan-03", "table": "responses",
+		}, nil, func(map[string]interface{}) error { return nil })
+		if want != "" {
+			if _, ok := err.(*jobs.ArgsError); !ok || err.Error() != want {
+				t.Errorf("export of tenant %q = %v, want %q", tenant, err, want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = job.Step(context.Background())
+		job.Stop()
+		if err != nil {
+			t.Errorf("export of tenant %q = %v, want it to read its source", tenant, err)
+		}
+	}
+}
+
+func TestExportTable(t *testing.T) {
+	tests := []struct {
+		args map[string]interface{}
+		err  string // Empty if valid
+	}{
+		{map[string]interface{}{"table": "responses", "columns": []interface{}{"id", "answer"}, "date_column": "submitted_at"}, ""},
+		{map[string]interface{}{}, "Invalid args: args.table: table is required"},
+		{map[string]interface{}{"table": `responses" WHERE 1; DELETE FROM "responses`}, "Invalid args: args.table: Does not match pattern '" + identifierPattern + "'"},
+		{map[string]interface{}{"table": "responses", "columns": []interface{}{"id", "answer AS id"}}, "Invalid args: args.columns.1: Does not match pattern '" + identifierPattern + "'"},
+		{map[string]interface{}{"table": "responses", "date_column": "1"}, "Invalid args: args.date_column: Does not match pattern '" + identifierPattern + "'"},
+		{map[string]interface{}{"table": "sqlite_master"}, "Invalid args: args.table: Internal tables can't be exported"},
+		{map[string]interface{}{"table": "SQLite_Schema"}, "Invalid args: args.table: Internal tables can't be exported"},
+		{map[string]interface{}{"query": "SELECT * FROM responses"}, "Invalid args: args.table: table is required, args.query: Additional property query is not allowed"},
+		{map[string]interface{}{"table": "Responses"}, ""},
+		{map[string]interface{}{"table": "users"}, "Invalid args: args.table: Not exported from the source of the tenant, expected one of: responses, answers"},
+	}
+	config := &Config{Sources: map[string]Source{"acme": {Path: "acme.db", Tables: []string{"responses", "answers"}}}}
+	for _, test := range tests {
+		test.args["from_date"], test.args["to_date"] = "2021-Jan-01", "2021-Jan-03"
+		_, err := newJob(config, uuid.New(), "acme", test.args, nil, nil)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("build(%v) = %v, want %q", test.args, err, test.err)
+		}
+	}
+	args := map[string]interface{}{"from_date": "2021-Jan-01", "to_date": "2021-Jan-03", "table": "responses"}
+	if _, err := newJob(nil, uuid.New(), "acme", args, nil, nil); err == nil || err.Error() != "Export jobs aren't configured" {
+		t.Errorf("build without configuration = %v, want an error", err)
+	}
+}
+
+// TestExportClean checks what is left of a stopped export,
+// with and without keep_partial
+func TestExportClean(t *testing.T) {
+	tests := []struct {
+		name        string
+		keepPartial bool
+		steps       int    // Steps done before the stop, 3 saves the export
+		artifacts   string // Artifacts left, comma separated
+		rows        int    // Rows of the partial export kept
+	}{
+		{"nothing exported", false, 0, "", 0},
+		{"nothing exported, keep_partial", true, 0, "", 0},
+		{"half way", false, 1, "", 0},
+		{"half way, keep_partial", true, 1, "export.partial.csv", 3},
+		{"saved", false, 3, "", 0},
+		{"saved, keep_partial", true, 3, "export.csv", 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, artifacts := newTestConfig(t, "acme")
+			var state map[string]interface{}
+			jobID := uuid.New()
+			job, err := newJob(config, jobID, "acme", map[string]interface{}{
+				"from_date": "2021-Jan-01", "to_date": "2021-Jan-04", "table": "responses", "keep_partial": test.keepPartial,
+			}, nil, func(checkpoint map[string]interface{}) error {
+				state = checkpoint
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < test.steps; i++ {
+				if _, err = job.Step(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = job.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			if err = job.Clean(); err != nil {
+				t.Fatalf("clean = %v", err)
+			}
+			if _, err = os.Stat(job.path()); !os.IsNotExist(err) {
+				t.Errorf("output left after the clean: %v", err)
+			}
+			left := []string{}
+			files, _ := ioutil.ReadDir(filepath.Dir(artifacts.path(jobID, "export.csv")))
+			for _, file := range files {
+				left = append(left, file.Name())
+			}
+			if got := strings.Join(left, ","); got != test.artifacts {
+				t.Fatalf("artifacts left = %q, want %q", got, test.artifacts)
+			}
+			if test.artifacts == "" {
+				if state != nil {
+					t.Errorf("checkpoint = %v, want none", state)
+				}
+				return
+			}
+			saved := state["artifacts"].([]jobs.Artifact)
+			if len(saved) != 1 || saved[0].Name != test.artifacts {
+				t.Errorf("checkpointed artifacts = %+v, want %s", saved, test.artifacts)
+			}
+			output, _ := ioutil.ReadFile(artifacts.path(jobID, test.artifacts))
+			rows, err := csv.NewReader(bytes.NewReader(output)).ReadAll()
+			if err != nil || len(rows)-1 != test.rows {
+				t.Errorf("%d rows kept, want %d: %v", len(rows)-1, test.rows, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Package jobs defines the interface of the jobs run by the server
+// and the registry of their types. A job type plugs in from its own
+// package by calling Register from its init function, and the package
+// is imported by the server for its side effect, see jobs/simple
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DayLayout is the layout of the days given as job arguments
+const DayLayout = "2006-Jan-02"
+
+// Job is the common interface that every different job should implement.
+// The status of the job is managed by the server, the methods are only
+// called when the transition is allowed by the job state machine.
+// The context given to Step is cancelled when the job is stopped
+// or exceeds its timeout or deadline, Step should return ctx.Err() then
+type Job interface {
+	Start() error                           // Start the job processing
+	Halt() error                            // Halt or pause the job processing
+	Resume() error                          // Resume any halted/paused job
+	Stop() error                            // Stop processing of any running or halted job
+	Clean() error                           // Clean method can be used to rollback any changes when job is stopped
+	Step(ctx context.Context) (bool, error) // Process a single unit of work, returns true once the job has completed
+	Details() map[string]interface{}        // Return details about the Job as a Map
+	Progress() Progress                     // Return the units done and the total if known
+}
+
+// Progress is the progress reported by a job, the server
+// completes it with the percentage, throughput and ETA
+type Progress struct {
+	Done    int    // Units of work done
+	Total   int    // Total units of work, 0 if unknown
+	Current string // Item being processed
+}
+
+// Logger writes the log lines of a job, which are stored by the server.
+// Fields are given as key value pairs after the message
+type Logger interface {
+	Debug(message string, fields ...interface{})
+	Info(message string, fields ...interface{})
+	Warn(message string, fields ...interface{})
+	Error(message string, fields ...interface{})
+}
+
+// Checkpointer persists the state required by a job
+// to continue its processing after a restart
+type Checkpointer func(state map[string]interface{}) error
+
+// Spec describes the job built by a job type
+// Tenant is the tenant which submitted the job, whose data the job may access
+// Args match the schema of the type, along with the defaults
+// Checkpoint is the state last saved by the job, nil if none
+// Checkpointer and Logger are nil when the job is only validated
+// Config is the configuration of the type, see Configure
+type Spec struct {
+	JobID        uuid.UUID
+	Tenant       string
+	Args         map[string]interface{}
+	Checkpoint   map[string]interface{}
+	Checkpointer Checkpointer
+	Logger       Logger
+	Config       interface{}
+}
+
+// Sleep waits for the duration, or returns the error
+// of the context if it is cancelled before
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
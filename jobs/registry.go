@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Type describes a type of job which can be submitted.
+// Every type registers itself from the init function of its package
+type Type struct {
+	Name        string     `json:"name" example:"Export"`
+	Description string     `json:"description" example:"Exports the data of every day between from_date and to_date"`
+	Args        ArgsSchema `json:"args"` // JSON Schema of the arguments of the job
+
+	// Build creates the job of the spec, whose args match the schema
+	Build func(spec Spec) (Job, error) `json:"-"`
+
+	// Details returns the details of a job in a terminal status from its args
+	// and checkpoint, as the job isn't built again once it ended. Its args may
+	// predate the schema. Only the jobID is returned if nil
+	Details func(spec Spec) map[string]interface{} `json:"-"`
+
+	// Config is the configuration of the type given by the server to Configure,
+	// passed to Build and Details in the spec. Nil until configured
+	Config interface{} `json:"-"`
+
+	schema *gojsonschema.Schema `json:"-"` // Compiled Args schema
+}
+
+// ArgsSchema is the JSON Schema of the arguments of a job type
+// Properties are the schemas of the arguments
+// Required are the arguments without default which must be given
+// AdditionalProperties allows arguments not in Properties
+type ArgsSchema struct {
+	Type                 string               `json:"type" example:"object"`
+	Properties           map[string]ArgSchema `json:"properties"`
+	Required             []string             `json:"required,omitempty"`
+	AdditionalProperties bool                 `json:"additionalProperties"`
+}
+
+// ArgSchema is the JSON Schema of an argument of a job type
+// Type is one of string, number, integer, boolean or array
+// Format day restricts a string to a date like 2006-Jan-02
+// Items is the schema of the elements of an array
+// Default is the value of the argument if it isn't given
+type ArgSchema struct {
+	Type        string        `json:"type" example:"string"`
+	Format      string        `json:"format,omitempty" example:"day"`
+	Description string        `json:"description,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	Minimum     *float64      `json:"minimum,omitempty"`
+	Maximum     *float64      `json:"maximum,omitempty"`
+	Pattern     string        `json:"pattern,omitempty"`
+	Items       *ArgSchema    `json:"items,omitempty"`
+}
+
+// FieldError is the error of a field of a request
+type FieldError struct {
+	Field string `json:"field" example:"args.from_date"`
+	Error string `json:"error" example:"Does not match format 'day'"`
+}
+
+// ArgsError is returned when the arguments of a job
+// don't match the schema of its type
+type ArgsError struct {
+	Fields []FieldError
+}
+
+func (err *ArgsError) Error() string {
+	messages := make([]string, 0, len(err.Fields))
+	for _, field := range err.Fields {
+		messages = append(messages, field.Field+": "+field.Error)
+	}
+	return "Invalid args: " + strings.Join(messages, ", ")
+}
+
+// dayFormat checks the day format of the arguments,
+// registered before the job types are compiled by their init functions
+type dayFormat struct{}
+
+func (dayFormat) IsFormat(input interface{}) bool {
+	s, ok := input.(string)
+	if !ok {
+		return true // Only strings are checked, as for the standard formats
+	}
+	_, err := time.Parse(DayLayout, s)
+	return err == nil
+}
+
+var _ = gojsonschema.FormatCheckers.Add("day", dayFormat{})
+
+// types is the registry of the job types by name
+var types = make(map[string]*Type)
+
+// Register adds the job type to the registry,
+// it panics if the type is invalid or already registered
+func Register(jobType Type) {
+	if jobType.Name == "" || jobType.Build == nil {
+		panic("Invalid job type: " + jobType.Name)
+	}
+	if _, ok := types[jobType.Name]; ok {
+		panic("Job type registered twice: " + jobType.Name)
+	}
+	jobType.Args.Type = "object"
+	if jobType.Args.Properties == nil {
+		jobType.Args.Properties = make(map[string]ArgSchema)
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(jobType.Args))
+	if err != nil {
+		panic(fmt.Sprintf("Invalid args schema of job type %s: %s", jobType.Name, err.Error()))
+	}
+	jobType.schema = schema
+	types[jobType.Name] = &jobType
+}
+
+// Configure sets the configuration of the registered job type of the name,
+// it must be called before the jobs of the type are built
+func Configure(name string, config interface{}) error {
+	jobType, ok := types[name]
+	if !ok {
+		return errors.New("Unknown job type: " + name)
+	}
+	jobType.Config = config
+	return nil
+}
+
+// Lookup returns the registered job type of the name
+func Lookup(name string) (*Type, bool) {
+	jobType, ok := types[name]
+	return jobType, ok
+}
+
+// Names returns the names of the registered job types in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns the registered job types in alphabetical order
+func List() []*Type {
+	list := []*Type{}
+	for _, name := range Names() {
+		list = append(list, types[name])
+	}
+	return list
+}
+
+// ValidateArgs checks the arguments against the schema of the job type
+// and returns them along with the defaults of the missing ones.
+// The error is an *ArgsError listing every invalid argument
+func (jobType *Type) ValidateArgs(args map[string]interface{}) (map[string]interface{}, error) {
+	validated := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		validated[name] = value
+	}
+	result, err := jobType.schema.Validate(gojsonschema.NewGoLoader(validated))
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid() {
+		invalid := &ArgsError{}
+		for _, resultError := range result.Errors() {
+			// Missing and unknown arguments are reported on the args object
+			// along with the name of the argument
+			field := "args"
+			if resultError.Field() != gojsonschema.STRING_CONTEXT_ROOT {
+				field += "." + resultError.Field()
+			}
+			if property, ok := resultError.Details()["property"].(string); ok {
+				field += "." + property
+			}
+			invalid.Fields = append(invalid.Fields, FieldError{field, resultError.Description()})
+		}
+		return nil, invalid
+	}
+	for name, schema := range jobType.Args.Properties {
+		if _, ok := validated[name]; !ok && schema.Default != nil {
+			validated[name] = schema.Default
+		}
+	}
+	return validated, nil
+}
@@ -0,0 +1,181 @@
+package jobs_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+// countJob is a job type plugged in from outside the jobs package,
+// it completes once it counted up to its target
+type countJob struct {
+	target int
+	count  int
+}
+
+func (job *countJob) Step(ctx context.Context) (bool, error) {
+	job.count++
+	return job.count >= job.target, nil
+}
+
+func (job *countJob) Start() error  { return nil }
+func (job *countJob) Halt() error   { return nil }
+func (job *countJob) Resume() error { return nil }
+func (job *countJob) Stop() error   { return nil }
+func (job *countJob) Clean() error  { return nil }
+
+func (job *countJob) Details() map[string]interface{} {
+	return map[string]interface{}{"count": job.count}
+}
+
+func (job *countJob) Progress() jobs.Progress {
+	return jobs.Progress{Done: job.count, Total: job.target}
+}
+
+func init() {
+	jobs.Register(jobs.Type{
+		Name: "Count",
+		Args: jobs.ArgsSchema{
+			Properties: map[string]jobs.ArgSchema{
+				"target": {Type: "integer", Default: 3},
+			},
+		},
+		Build: func(spec jobs.Spec) (jobs.Job, error) {
+			target, _ := spec.Args["target"].(int)
+			return &countJob{target: target}, nil
+		},
+	})
+	minimum, maximum := 1.0, 10.0
+	jobs.Register(jobs.Type{
+		Name: "Validated",
+		Args: jobs.ArgsSchema{
+			Properties: map[string]jobs.ArgSchema{
+				"from_date": {Type: "string", Format: "day"},
+				"format":    {Type: "string", Enum: []interface{}{"csv", "jsonl"}, Default: "csv"},
+				"workers":   {Type: "integer", Minimum: &minimum, Maximum: &maximum},
+				"columns":   {Type: "array", Items: &jobs.ArgSchema{Type: "string", Pattern: "^[a-z_]+$"}},
+			},
+			Required: []string{"from_date"},
+		},
+		Build: func(spec jobs.Spec) (jobs.Job, error) { return &countJob{}, nil },
+	})
+}
+
+func TestRegisteredType(t *testing.T) {
+	jobType, ok := jobs.Lookup("Count")
+	if !ok {
+		t.Fatal("Count job type not registered")
+	}
+	if _, ok = jobs.Lookup("Missing"); ok {
+		t.Error("unknown job type found")
+	}
+	args, err := jobType.ValidateArgs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := jobType.Build(jobs.Spec{JobID: uuid.New(), Args: args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for done := false; !done; {
+		if done, err = job.Step(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if progress := job.Progress(); progress.Done != 3 || progress.Total != 3 {
+		t.Errorf("progress = %+v, want the default target of 3 done", progress)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	if err := jobs.Configure("Missing", 1); err == nil {
+		t.Error("configured an unknown job type")
+	}
+	jobType, _ := jobs.Lookup("Count")
+	defer func() { jobType.Config = nil }()
+	if err := jobs.Configure("Count", map[string]int{"target": 5}); err != nil {
+		t.Fatal(err)
+	}
+	if config, ok := jobType.Config.(map[string]int); !ok || config["target"] != 5 {
+		t.Errorf("config = %v, want the configured target", jobType.Config)
+	}
+}
+
+func TestRegisterInvalidType(t *testing.T) {
+	build := func(spec jobs.Spec) (jobs.Job, error) { return &countJob{}, nil }
+	tests := []struct {
+		name    string
+		jobType jobs.Type
+	}{
+		{"no name", jobs.Type{Build: build}},
+		{"no constructor", jobs.Type{Name: "Unbuilt"}},
+		{"registered twice", jobs.Type{Name: "Count", Build: build}},
+		{"invalid schema", jobs.Type{Name: "Invalid", Build: build, Args: jobs.ArgsSchema{
+			Properties: map[string]jobs.ArgSchema{"n": {Type: "integer", Pattern: "("}},
+		}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Register didn't panic")
+				}
+			}()
+			jobs.Register(test.jobType)
+		})
+	}
+	if names := strings.Join(jobs.Names(), ","); names != "Count,Validated" {
+		t.Errorf("registered job types = %s, want Count,Validated", names)
+	}
+}
+
+func TestValidateArgs(t *testing.T) {
+	jobType, _ := jobs.Lookup("Validated")
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want map[string]interface{} // Validated args, nil if invalid
+		err  string
+	}{
+		{"defaults", map[string]interface{}{"from_date": "2021-Jan-02"},
+			map[string]interface{}{"from_date": "2021-Jan-02", "format": "csv"}, ""},
+		{"given", map[string]interface{}{"from_date": "2021-Jan-02", "format": "jsonl", "workers": 4.0, "columns": []interface{}{"id"}},
+			map[string]interface{}{"from_date": "2021-Jan-02", "format": "jsonl", "workers": 4.0, "columns": []interface{}{"id"}}, ""},
+		{"missing", map[string]interface{}{}, nil,
+			"Invalid args: args.from_date: from_date is required"},
+		{"wrong type", map[string]interface{}{"from_date": 20210102.0}, nil,
+			"Invalid args: args.from_date: Invalid type. Expected: string, given: integer"},
+		{"wrong format", map[string]interface{}{"from_date": "2021-01-02"}, nil,
+			"Invalid args: args.from_date: Does not match format 'day'"},
+		{"not in enum", map[string]interface{}{"from_date": "2021-Jan-02", "format": "xml"}, nil,
+			`Invalid args: args.format: format must be one of the following: "csv", "jsonl"`},
+		{"out of range", map[string]interface{}{"from_date": "2021-Jan-02", "workers": 11.0}, nil,
+			"Invalid args: args.workers: Must be less than or equal to 10"},
+		{"not an integer", map[string]interface{}{"from_date": "2021-Jan-02", "workers": 1.5}, nil,
+			"Invalid args: args.workers: Invalid type. Expected: integer, given: number"},
+		{"array item", map[string]interface{}{"from_date": "2021-Jan-02", "columns": []interface{}{"id", "Name"}}, nil,
+			"Invalid args: args.columns.1: Does not match pattern '^[a-z_]+$'"},
+		{"unknown", map[string]interface{}{"from_date": "2021-Jan-02", "to": "x"}, nil,
+			"Invalid args: args.to: Additional property to is not allowed"},
+		{"every invalid arg", map[string]interface{}{"format": 1.0}, nil,
+			"Invalid args: args.from_date: from_date is required, args.format: Invalid type. Expected: string, given: integer"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := jobType.ValidateArgs(test.args)
+			if test.err == "" {
+				if err != nil || !reflect.DeepEqual(args, test.want) {
+					t.Errorf("ValidateArgs = %v, %v, want %v", args, err, test.want)
+				}
+				return
+			}
+			if _, ok := err.(*jobs.ArgsError); !ok || err.Error() != test.err {
+				t.Errorf("ValidateArgs = %v, want %s", err, test.err)
+			}
+		})
+	}
+}
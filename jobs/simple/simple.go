@@ -0,0 +1,86 @@
+// Package simple registers the simple job type,
+// the server imports it for its side effect
+package simple
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+// Name is the name of the simple job type
+const Name string = "Simple"
+
+func init() {
+	jobs.Register(jobs.Type{
+		Name:        Name,
+		Description: "Prints its message on every step until stopped",
+		Args: jobs.ArgsSchema{
+			Properties: map[string]jobs.ArgSchema{
+				"message": {
+					Type:        "string",
+					Description: "Statement printed on every step",
+					Default:     "Doing Job",
+				},
+			},
+		},
+		Build: func(spec jobs.Spec) (jobs.Job, error) {
+			return &Job{
+				jobID:   spec.JobID,
+				logger:  spec.Logger,
+				message: spec.Args["message"].(string),
+			}, nil
+		},
+	})
+}
+
+// Job is a generic simple job, it runs until stopped
+type Job struct {
+	jobID   uuid.UUID
+	logger  jobs.Logger
+	message string
+	steps   int
+}
+
+// Step prints the message then waits for a second
+func (job *Job) Step(ctx context.Context) (bool, error) {
+	job.logger.Info(job.message)
+	if err := jobs.Sleep(ctx, time.Second); err != nil {
+		return false, err
+	}
+	job.steps++
+	return false, nil
+}
+
+func (job *Job) Start() error {
+	return nil
+}
+
+func (job *Job) Halt() error {
+	return nil
+}
+
+func (job *Job) Stop() error {
+	return nil
+}
+
+func (job *Job) Resume() error {
+	return nil
+}
+
+func (job *Job) Clean() error {
+	return nil
+}
+
+func (job *Job) Details() map[string]interface{} {
+	details := make(map[string]interface{})
+	details["jobID"] = job.jobID
+	return details
+}
+
+// Progress of a simple job is the number of steps done, it has no total
+func (job *Job) Progress() jobs.Progress {
+	return jobs.Progress{Done: job.steps}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// sortKeys maps the fields jobs can be sorted on to the sort key of a record.
+// Keys are compared as strings, ties are broken with the jobID
+var sortKeys = map[string]func(record *JobRecord) string{
+	"submitted_at": func(record *JobRecord) string {
+		return record.SubmittedAt.UTC().Format("2006-01-02T15:04:05.000000000")
+	},
+	"status": func(record *JobRecord) string {
+		return record.Status
+	},
+	"type": func(record *JobRecord) string {
+		return record.Type
+	},
+}
+
+// jobQuery represents the filters, sorting and pagination of a job listing
+type jobQuery struct {
+	jobType         string
+	status          string
+	owner           string
+	tenant          string // Tenant of the caller, set by the handler
+	submittedAfter  time.Time
+	submittedBefore time.Time
+	labels          map[string]string
+	sortBy          string
+	descending      bool
+	limit           int
+	cursor          string // Sort key and jobID of the last job of the previous page
+}
+
+// parseJobQuery builds the job query from the query parameters of a request
+func parseJobQuery(get func(key string) string, labels []string) (*jobQuery, error) {
+	query := &jobQuery{
+		jobType: get("type"),
+		status:  get("status"),
+		owner:   get("owner"),
+		labels:  make(map[string]string),
+		sortBy:  "submitted_at",
+		limit:   defaultListLimit,
+	}
+	var err error
+	if value := get("submitted_after"); value != "" {
+		if query.submittedAfter, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errors.New("Invalid submitted_after format")
+		}
+	}
+	if value := get("submitted_before"); value != "" {
+		if query.submittedBefore, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errors.New("Invalid submitted_before format")
+		}
+	}
+	for _, label := range labels {
+		parts := strings.SplitN(label, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid label format, expected key:value")
+		}
+		query.labels[parts[0]] = parts[1]
+	}
+	if value := get("sort"); value != "" {
+		query.descending = strings.HasPrefix(value, "-")
+		query.sortBy = strings.TrimPrefix(value, "-")
+		if _, ok := sortKeys[query.sortBy]; !ok {
+			return nil, errors.New("Invalid sort field")
+		}
+	}
+	if value := get("limit"); value != "" {
+		if query.limit, err = strconv.Atoi(value); err != nil || query.limit <= 0 || query.limit > maxListLimit {
+			return nil, errors.New("Invalid limit, expected a number between 1 and " + strconv.Itoa(maxListLimit))
+		}
+	}
+	if value := get("cursor"); value != "" {
+		buf, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.New("Invalid cursor")
+		}
+		query.cursor = string(buf)
+	}
+	return query, nil
+}
+
+func (query *jobQuery) match(record *JobRecord) bool {
+	if query.jobType != "" && record.Type != query.jobType {
+		return false
+	}
+	if query.status != "" && record.Status != query.status {
+		return false
+	}
+	if tenantOf(record.Tenant) != query.tenant {
+		return false
+	}
+	if query.owner != "" && record.Owner != query.owner {
+		return false
+	}
+	if !query.submittedAfter.IsZero() && record.SubmittedAt.Before(query.submittedAfter) {
+		return false
+	}
+	if !query.submittedBefore.IsZero() && !record.SubmittedAt.Before(query.submittedBefore) {
+		return false
+	}
+	for key, value := range query.labels {
+		if record.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// cursorKey is the position of the record in the sorted listing
+func (query *jobQuery) cursorKey(record *JobRecord) string {
+	return sortKeys[query.sortBy](record) + "\x00" + record.JobID.String()
+}
+
+// apply filters and sorts the records and returns the requested page,
+// along with the cursor of the next page if there are more records
+func (query *jobQuery) apply(records []*JobRecord) ([]*JobRecord, string) {
+	keys := make(map[*JobRecord]string)
+	matched := []*JobRecord{}
+	for _, record := range records {
+		if query.match(record) {
+			keys[record] = query.cursorKey(record)
+			matched = append(matched, record)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if query.descending {
+			return keys[matched[i]] > keys[matched[j]]
+		}
+		return keys[matched[i]] < keys[matched[j]]
+	})
+
+	if query.cursor != "" {
+		start := sort.Search(len(matched), func(i int) bool {
+			if query.descending {
+				return keys[matched[i]] < query.cursor
+			}
+			return keys[matched[i]] > query.cursor
+		})
+		matched = matched[start:]
+	}
+	if len(matched) <= query.limit {
+		return matched, ""
+	}
+	page := matched[:query.limit]
+	next := base64.RawURLEncoding.EncodeToString([]byte(keys[page[len(page)-1]]))
+	return page, next
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+// listRecords returns the records of the listing tests, named by their
+// jobID ending with their number so that ties are broken in that order
+func listRecords() []*JobRecord {
+	at := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+	record := func(n int, jobType string, status string, owner string, tenant string, hours int, labels map[string]string) *JobRecord {
+		return &JobRecord{
+			JobID:       uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", n)),
+			Type:        jobType,
+			Status:      status,
+			Owner:       owner,
+			Tenant:      tenant,
+			SubmittedAt: at.Add(time.Duration(hours) * time.Hour),
+			Labels:      labels,
+		}
+	}
+	return []*JobRecord{
+		record(5, export.Name, Completed, "alice", "", 4, map[string]string{"team": "data", "env": "prod"}),
+		record(1, simple.Name, Running, "alice", "", 0, nil),
+		record(3, export.Name, Queued, "bob", "", 2, map[string]string{"team": "data"}),
+		record(2, simple.Name, Completed, "bob", "", 1, map[string]string{"team": "web"}),
+		record(4, simple.Name, Running, "carol", "", 2, nil),
+		record(6, simple.Name, Running, "alice", "acme", 5, map[string]string{"team": "data"}),
+	}
+}
+
+// jobNumbers returns the numbers of the jobs of the records
+func jobNumbers(records []*JobRecord) string {
+	list := make([]string, 0, len(records))
+	for _, record := range records {
+		id := record.JobID.String()
+		list = append(list, strings.TrimLeft(id[len(id)-12:], "0"))
+	}
+	return strings.Join(list, ",")
+}
+
+func TestParseJobQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string // Empty if valid
+	}{
+		{"", ""},
+		{"type=Export&status=Queued&owner=alice&sort=-status&limit=100", ""},
+		{"submitted_after=2021-01-02T00:00:00Z&submitted_before=2021-01-03T00:00:00%2B02:00", ""},
+		{"label=team:data&label=env:prod", ""},
+		{"submitted_after=2021-01-02", "Invalid submitted_after format"},
+		{"submitted_before=yesterday", "Invalid submitted_before format"},
+		{"label=team", "Invalid label format, expected key:value"},
+		{"sort=owner", "Invalid sort field"},
+		{"sort=-", "Invalid sort field"},
+		{"limit=0", "Invalid limit, expected a number between 1 and 100"},
+		{"limit=101", "Invalid limit, expected a number between 1 and 100"},
+		{"limit=ten", "Invalid limit, expected a number between 1 and 100"},
+		{"cursor=not%20base64!", "Invalid cursor"},
+		{"cursor=" + base64.StdEncoding.EncodeToString([]byte("padded key")), "Invalid cursor"},
+	}
+	for _, test := range tests {
+		values, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = parseJobQuery(values.Get, values["label"])
+		if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("parseJobQuery(%q) = %v, want %q", test.query, err, test.err)
+		}
+	}
+}
+
+func TestJobQueryFilters(t *testing.T) {
+	tests := []struct {
+		query string
+		jobs  string
+	}{
+		{"", "1,2,3,4,5"},
+		{"type=Export", "3,5"},
+		{"status=Running", "1,4"},
+		{"owner=alice", "1,5"},
+		{"type=Simple&status=Completed", "2"},
+		{"label=team:data", "3,5"},
+		{"label=team:data&label=env:prod", "5"},
+		{"label=team:ops", ""},
+		// submitted_after is inclusive, submitted_before exclusive
+		{"submitted_after=2021-01-02T02:00:00Z", "3,4,5"},
+		{"submitted_before=2021-01-02T02:00:00Z", "1,2"},
+		{"submitted_after=2021-01-02T01:00:00Z&submitted_before=2021-01-02T04:00:00Z", "2,3,4"},
+		{"submitted_after=2021-01-02T03:00:00%2B01:00", "3,4,5"},
+	}
+	for _, test := range tests {
+		values, _ := url.ParseQuery(test.query)
+		query, err := parseJobQuery(values.Get, values["label"])
+		if err != nil {
+			t.Fatalf("parseJobQuery(%q) = %v", test.query, err)
+		}
+		query.tenant = defaultTenant
+		page, next := query.apply(listRecords())
+		if got := jobNumbers(page); got != test.jobs || next != "" {
+			t.Errorf("%q lists %s with next cursor %q, want %s", test.query, got, next, test.jobs)
+		}
+	}
+}
+
+// TestJobQueryPages checks that walking the pages lists every job
+// once in a stable order, even when the sort keys are equal
+func TestJobQueryPages(t *testing.T) {
+	tests := []struct {
+		sort string
+		jobs string
+	}{
+		{"", "1,2,3,4,5"},
+		{"-submitted_at", "5,4,3,2,1"},
+		{"status", "2,5,3,1,4"},
+		{"-status", "4,1,3,5,2"},
+		{"type", "3,5,1,2,4"},
+		{"-type", "4,2,1,5,3"},
+	}
+	for _, test := range tests {
+		for limit := 1; limit <= 6; limit++ {
+			listed := []*JobRecord{}
+			cursor := ""
+			for pages := 0; pages < 10; pages++ {
+				values := url.Values{"sort": {test.sort}, "limit": {fmt.Sprint(limit)}, "cursor": {cursor}}
+				query, err := parseJobQuery(values.Get, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				query.tenant = defaultTenant
+				page, next := query.apply(listRecords())
+				if len(page) > limit {
+					t.Fatalf("sort %q: page of %d jobs, want at most %d", test.sort, len(page), limit)
+				}
+				listed = append(listed, page...)
+				if cursor = next; cursor == "" {
+					break
+				}
+			}
+			if got := jobNumbers(listed); got != test.jobs {
+				t.Errorf("sort %q by pages of %d lists %s, want %s", test.sort, limit, got, test.jobs)
+			}
+		}
+	}
+}
+
+// TestJobQueryRemovedCursor checks that the listing continues
+// after the cursor even if its job no longer matches
+func TestJobQueryRemovedCursor(t *testing.T) {
+	values := url.Values{"limit": {"2"}}
+	query, _ := parseJobQuery(values.Get, nil)
+	query.tenant = defaultTenant
+	page, next := query.apply(listRecords())
+	if jobNumbers(page) != "1,2" || next == "" {
+		t.Fatalf("first page = %s with next cursor %q, want 1,2 and a cursor", jobNumbers(page), next)
+	}
+	records := []*JobRecord{}
+	for _, record := range listRecords() {
+		// Job 2 is no longer listed
+		if !strings.HasSuffix(record.JobID.String(), "2") {
+			records = append(records, record)
+		}
+	}
+	values.Set("cursor", next)
+	query, _ = parseJobQuery(values.Get, nil)
+	query.tenant = defaultTenant
+	if page, _ = query.apply(records); jobNumbers(page) != "3,4" {
+		t.Errorf("next page = %s, want 3,4", jobNumbers(page))
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Levels of the job log lines, by increasing severity
+const (
+	DebugLevel string = "debug"
+	InfoLevel  string = "info"
+	WarnLevel  string = "warn"
+	ErrorLevel string = "error"
+)
+
+var logLevels = map[string]int{DebugLevel: 0, InfoLevel: 1, WarnLevel: 2, ErrorLevel: 3}
+
+const (
+	maxJobLogLines      = 1000                   // Number of log lines kept per job, the oldest ones are dropped
+	logSubscriberBuffer = 256                    // Number of log lines a follower can lag behind
+	logFlushInterval    = 200 * time.Millisecond // Maximum time a log line is buffered before being saved
+	logFlushLines       = 100                    // Number of buffered lines of a job which triggers a flush
+)
+
+// parseLogLevel checks the minimum level of the log lines to return, every line is returned if empty
+func parseLogLevel(level string) (string, error) {
+	if level == "" {
+		return DebugLevel, nil
+	}
+	if _, ok := logLevels[level]; !ok {
+		return "", errors.New("Invalid level, expected one of: debug, info, warn, error")
+	}
+	return level, nil
+}
+
+// LogEntry is a log line of a job
+// Seq numbers the log lines of the job from 1
+type LogEntry struct {
+	Seq     uint64                 `json:"seq" example:"12"`
+	At      time.Time              `json:"at"`
+	Level   string                 `json:"level" example:"info"`
+	Message string                 `json:"message" example:"Exporting data"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// jobLogger writes the log lines of a job, tagged with its ID and type.
+// Fields are given as key value pairs after the message
+type jobLogger struct {
+	logs    *jobLogs
+	jobID   uuid.UUID
+	jobType string
+}
+
+func (logger *jobLogger) Debug(message string, fields ...interface{}) {
+	logger.logs.write(logger, DebugLevel, message, fields)
+}
+
+func (logger *jobLogger) Info(message string, fields ...interface{}) {
+	logger.logs.write(logger, InfoLevel, message, fields)
+}
+
+func (logger *jobLogger) Warn(message string, fields ...interface{}) {
+	logger.logs.write(logger, WarnLevel, message, fields)
+}
+
+func (logger *jobLogger) Error(message string, fields ...interface{}) {
+	logger.logs.write(logger, ErrorLevel, message, fields)
+}
+
+// logSubscription receives the log lines of a job
+type logSubscription struct {
+	jobID   uuid.UUID
+	entries chan LogEntry
+}
+
+// deliver passes the lines to the follower, it returns false if the follower lags behind
+func (sub *logSubscription) deliver(entries []*LogEntry) bool {
+	for _, entry := range entries {
+		select {
+		case sub.entries <- *entry:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// jobLogs saves the log lines of the jobs in the store and delivers them
+// to the followers of the jobs. Lines are buffered per job and saved in
+// batches, every logFlushInterval or once a job buffered logFlushLines,
+// so that logging never waits for the store. The lines of a job are saved
+// before they are read, followed or the followers of the job are dropped.
+// A follower which doesn't keep up is dropped, its channel is closed,
+// as are the channels of the followers of a job once it has ended
+type jobLogs struct {
+	store  LogStore
+	stdout bool // Print the lines on the standard output as well
+
+	mu      sync.Mutex // Guards the buffered lines
+	pending map[uuid.UUID][]*LogEntry
+	wake    chan struct{}
+
+	flushMu     sync.Mutex // Serializes the saved lines with the subscriptions
+	subscribers map[*logSubscription]struct{}
+}
+
+func newJobLogs(store LogStore, stdout bool) *jobLogs {
+	logs := &jobLogs{
+		store:       store,
+		stdout:      stdout,
+		pending:     make(map[uuid.UUID][]*LogEntry),
+		wake:        make(chan struct{}, 1),
+		subscribers: make(map[*logSubscription]struct{}),
+	}
+	go logs.loop()
+	return logs
+}
+
+// logger returns the logger of the job
+func (logs *jobLogs) logger(jobID uuid.UUID, jobType string) *jobLogger {
+	return &jobLogger{logs: logs, jobID: jobID, jobType: jobType}
+}
+
+func (logs *jobLogs) write(logger *jobLogger, level string, message string, pairs []interface{}) {
+	entry := &LogEntry{At: time.Now(), Level: level, Message: message}
+	if len(pairs) > 0 {
+		entry.Fields = make(map[string]interface{})
+		for i := 0; i < len(pairs); i += 2 {
+			key := fmt.Sprint(pairs[i])
+			var value interface{} = "(missing)"
+			if i+1 < len(pairs) {
+				value = pairs[i+1]
+			}
+			if err, ok := value.(error); ok {
+				value = err.Error()
+			}
+			entry.Fields[key] = value
+		}
+	}
+	if logs.stdout {
+		log.Println(formatLogLine(logger, entry))
+	}
+
+	logs.mu.Lock()
+	logs.pending[logger.jobID] = append(logs.pending[logger.jobID], entry)
+	full := len(logs.pending[logger.jobID]) >= logFlushLines
+	logs.mu.Unlock()
+	if full {
+		select {
+		case logs.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// formatLogLine returns the line printed on the standard output,
+// the message followed by the tags of the job and the sorted fields
+func formatLogLine(logger *jobLogger, entry *LogEntry) string {
+	line := fmt.Sprintf("%s job=%s type=%s %s", strings.ToUpper(entry.Level), logger.jobID.String(), logger.jobType, entry.Message)
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		line += fmt.Sprintf(" %s=%v", key, entry.Fields[key])
+	}
+	return line
+}
+
+// loop saves the buffered lines of every job periodically
+func (logs *jobLogs) loop() {
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-logs.wake:
+		}
+		logs.flushMu.Lock()
+		logs.mu.Lock()
+		pending := logs.pending
+		logs.pending = make(map[uuid.UUID][]*LogEntry)
+		logs.mu.Unlock()
+		for jobID, entries := range pending {
+			logs.save(jobID, entries)
+		}
+		logs.flushMu.Unlock()
+	}
+}
+
+// flush saves the buffered lines of the job, flushMu must be held
+func (logs *jobLogs) flush(jobID uuid.UUID) {
+	logs.mu.Lock()
+	entries := logs.pending[jobID]
+	delete(logs.pending, jobID)
+	logs.mu.Unlock()
+	if len(entries) > 0 {
+		logs.save(jobID, entries)
+	}
+}
+
+// save appends the lines to the job in the store and delivers
+// them to its followers, flushMu must be held
+func (logs *jobLogs) save(jobID uuid.UUID, entries []*LogEntry) {
+	if err := logs.store.appendLogs(jobID, entries); err != nil {
+		log.Printf("Failed to save the log of the job: %s\nError: %s", jobID.String(), err.Error())
+		return
+	}
+	for sub := range logs.subscribers {
+		if sub.jobID == jobID && !sub.deliver(entries) {
+			delete(logs.subscribers, sub)
+			close(sub.entries)
+		}
+	}
+}
+
+// list returns the kept log lines of the job after the sequence number
+func (logs *jobLogs) list(jobID uuid.UUID, after uint64) ([]*LogEntry, error) {
+	logs.flushMu.Lock()
+	defer logs.flushMu.Unlock()
+	logs.flush(jobID)
+	return logs.store.listLogs(jobID, after)
+}
+
+// subscribe returns the kept log lines of the job after the sequence number
+// along with the subscription delivering the following ones
+func (logs *jobLogs) subscribe(jobID uuid.UUID, after uint64) ([]*LogEntry, *logSubscription, error) {
+	logs.flushMu.Lock()
+	defer logs.flushMu.Unlock()
+	logs.flush(jobID)
+	missed, err := logs.store.listLogs(jobID, after)
+	if err != nil {
+		return nil, nil, err
+	}
+	sub := &logSubscription{jobID: jobID, entries: make(chan LogEntry, logSubscriberBuffer)}
+	logs.subscribers[sub] = struct{}{}
+	return missed, sub, nil
+}
+
+func (logs *jobLogs) unsubscribe(sub *logSubscription) {
+	logs.flushMu.Lock()
+	defer logs.flushMu.Unlock()
+	if _, ok := logs.subscribers[sub]; ok {
+		delete(logs.subscribers, sub)
+		close(sub.entries)
+	}
+}
+
+// end saves the last lines of the job once it reached a terminal status
+// and drops its followers, as it won't log anymore
+func (logs *jobLogs) end(jobID uuid.UUID) {
+	logs.flushMu.Lock()
+	defer logs.flushMu.Unlock()
+	logs.flush(jobID)
+	for sub := range logs.subscribers {
+		if sub.jobID == jobID {
+			delete(logs.subscribers, sub)
+			close(sub.entries)
+		}
+	}
+}
+
+// filterLogs returns the log lines of at least the given level
+func filterLogs(entries []*LogEntry, level string) []*LogEntry {
+	filtered := []*LogEntry{}
+	for _, entry := range entries {
+		if logLevels[entry.Level] >= logLevels[level] {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
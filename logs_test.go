@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+func TestJobLogs(t *testing.T) {
+	logs := newJobLogs(newMemoryStore(), false)
+	jobID := uuid.New()
+	logger := logs.logger(jobID, simple.Name)
+	other := logs.logger(uuid.New(), simple.Name)
+
+	logger.Info("Exporting data", "date", "2021-Jan-02")
+	other.Info("Not this job")
+	logger.Warn("Odd field", "alone")
+	entries, err := logs.list(jobID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Seq != 1 || entries[1].Seq != 2 {
+		t.Fatalf("list = %+v, want the 2 buffered lines of the job", entries)
+	}
+	if entries[0].Fields["date"] != "2021-Jan-02" || entries[1].Fields["alone"] != "(missing)" {
+		t.Errorf("fields = %v, %v", entries[0].Fields, entries[1].Fields)
+	}
+
+	missed, sub, err := logs.subscribe(jobID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missed) != 1 || missed[0].Seq != 2 {
+		t.Errorf("missed = %+v, want the line after seq 1", missed)
+	}
+	logger.Error("Job failed", "error", errors.New("boom"))
+	select {
+	case entry := <-sub.entries:
+		if entry.Seq != 3 || entry.Fields["error"] != "boom" {
+			t.Errorf("followed = %+v", entry)
+		}
+	case <-time.After(5 * logFlushInterval):
+		t.Fatal("the buffered line wasn't delivered")
+	}
+
+	// The last lines are saved and delivered before the followers are dropped
+	logger.Info("Status changed")
+	logs.end(jobID)
+	var followed []LogEntry
+	for entry := range sub.entries {
+		followed = append(followed, entry)
+	}
+	if len(followed) != 1 || followed[0].Seq != 4 {
+		t.Errorf("followed = %+v, want the last line before the end", followed)
+	}
+}
+
+func TestJobLogsLaggingFollower(t *testing.T) {
+	logs := newJobLogs(newMemoryStore(), false)
+	jobID := uuid.New()
+	logger := logs.logger(jobID, simple.Name)
+	_, sub, err := logs.subscribe(jobID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < logSubscriberBuffer+1; i++ {
+		logger.Debug("Line")
+	}
+	logs.list(jobID, 0)
+	count := 0
+	for range sub.entries {
+		count++
+	}
+	if count > logSubscriberBuffer {
+		t.Errorf("the follower got %d lines, want it dropped once its buffer is full", count)
+	}
+}
@@ -1,24 +1,56 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	_ "github.com/psinghal20/atlan-assignment/docs"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	_ "github.com/psinghal20/atlan-assignment/jobs/simple"
 	swaggerFiles "github.com/swaggo/files"     // swagger embed files
 	ginSwagger "github.com/swaggo/gin-swagger" // gin-swagger middleware
+	"github.com/swaggo/swag"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // JobRequest represents the job submission request
-// Type is from a list of types of jobs found in const.go
+// Type is the name of a job type registered in the registry, see jobs/registry.go
 // Args are the additional arguments to the job
+// Labels are arbitrary key value pairs jobs can be filtered on
+// Priority orders the queued jobs, higher priority jobs are started first
+// Timeout bounds the execution of the job from its first start, e.g. 30m
+// Deadline is the absolute time by which the job must have completed
+// Retry is the policy used to retry the job when it fails, it isn't retried if nil
+// CallbackURL receives the transitions of the job, see webhooks.go
 type JobRequest struct {
-	Type string                 `json:"Type" example:"Simple"`
-	Args map[string]interface{} `json:"args"`
+	Type        string                 `json:"Type" example:"Simple"`
+	Args        map[string]interface{} `json:"args"`
+	Labels      map[string]string      `json:"labels"`
+	Priority    int                    `json:"priority" example:"0"`
+	Timeout     string                 `json:"timeout" example:"30m"`
+	Deadline    *time.Time             `json:"deadline" example:"2021-01-02T15:04:05Z"`
+	Retry       *RetryPolicy           `json:"retry"`
+	CallbackURL string                 `json:"callback_url" example:"https://example.com/hooks/jobs"`
+}
+
+// PriorityRequest represents the request to change the priority of a job
+type PriorityRequest struct {
+	Priority int `json:"priority" example:"10"`
 }
 
 type httpResponse struct {
@@ -27,15 +59,66 @@ type httpResponse struct {
 	Details map[string]interface{} `json:"details"`
 }
 
+// jobSummary is the details of a job as returned by /details/:jobID
+type jobSummary map[string]interface{}
+
+type jobsResponse struct {
+	Jobs       []jobSummary `json:"jobs"`
+	NextCursor string       `json:"next_cursor,omitempty" example:"MjAxOS0xMC0yMlQxNTowNDowNS4wMDAwMDAwMDAAZTNiMGM0NDI"`
+}
+
+type schedulesResponse struct {
+	Schedules []*Schedule `json:"schedules"`
+}
+
+type scheduleResponse struct {
+	ScheduleID uuid.UUID `json:"scheduleID" example:"9e3e9c1c-2d2a-4a3f-8b9a-3c1f0d7e6a51"`
+	Message    string    `json:"message" example:"Success"`
+}
+
+type webhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type webhookResponse struct {
+	WebhookID uuid.UUID `json:"webhookID" example:"3f1c2b9e-6a0d-4c55-9d2e-8b7a1f4e5c6d"`
+	Message   string    `json:"message" example:"Success"`
+}
+
+type logsResponse struct {
+	Logs []*LogEntry `json:"logs"`
+}
+
+type apiKeysResponse struct {
+	APIKeys []APIKey `json:"api_keys"`
+}
+
+// apiKeyResponse holds the created API key, its value is only returned once
+type apiKeyResponse struct {
+	KeyID   uuid.UUID `json:"keyID" example:"0f8d3c1a-7b2e-4f5d-9a6c-2e1b8d7f4a3c"`
+	Key     string    `json:"key" example:"q2Vh1b8sYk9mZp3xTn7wLr0aJc5dFe4gHi6uKo2yXs8"`
+	Message string    `json:"message" example:"Success"`
+}
+
+type deliveriesResponse struct {
+	Deliveries []Delivery `json:"deliveries"`
+}
+
 type httpError struct {
 	JobID string `json:"jobID" example:"55e75f6c-24f8-49b5-9e62-a268db7370e9"`
 	Error string `json:"error" example:"Invalid JobID"`
 }
 
-// JobManager manages the list of submitted jobs
-// It has methods to handle different actions called on these jobs.
-type JobManager struct {
-	jobs map[uuid.UUID]JobInterface
+// validationError is the error returned when the args of a job
+// don't match the schema of its type, listing the invalid fields
+type validationError struct {
+	JobID  string            `json:"jobID" example:""`
+	Error  string            `json:"error" example:"Invalid args"`
+	Fields []jobs.FieldError `json:"fields,omitempty"`
+}
+
+type jobTypesResponse struct {
+	JobTypes []*jobs.Type `json:"job_types"`
 }
 
 func marshalError(err error, jobID string) []byte {
@@ -46,10 +129,119 @@ func marshalError(err error, jobID string) []byte {
 	return buf
 }
 
+// findJob fetches the record of the job for the given jobID.
+// It responds with an error and returns false if the job can't be found
+// in the tenant of the caller
+func (manager *JobManager) findJob(c *gin.Context, jobID string) (*JobRecord, bool) {
+	record, status, err := manager.lookupJob(jobID, principalOf(c))
+	if err != nil {
+		c.JSON(status, httpError{
+			jobID,
+			err.Error(),
+		})
+		return nil, false
+	}
+	return record, true
+}
+
+// lookupJob fetches the record of the job for the given jobID,
+// along with the HTTP status matching the error if it can't be found.
+// Jobs of other tenants are reported as not found
+func (manager *JobManager) lookupJob(jobID string, principal *Principal) (*JobRecord, int, error) {
+	jobUUID, err := uuid.Parse(jobID)
+	if err != nil {
+		log.Println("Error while parsing UUID from string: ", jobID)
+		return nil, http.StatusNotFound, errors.New("Invalid JobID")
+	}
+	record, err := manager.store.get(jobUUID)
+	if err == errJobNotFound || (err == nil && !principal.sees(record.Tenant)) {
+		return nil, http.StatusNotFound, errors.New("Invalid JobID")
+	} else if err != nil {
+		log.Printf("Failed to fetch the job: %s\nError: %s", jobID, err.Error())
+		return nil, http.StatusInternalServerError, errors.New("Failed to fetch the job")
+	}
+	return record, http.StatusOK, nil
+}
+
+// control performs the action on the job for the given jobID,
+// it is shared by the HTTP routes and the WebSocket commands.
+// It returns the HTTP status matching the error if it fails.
+// A stopped job which failed to clean is reported with StatusOK
+// along with the cleanError. Only operators can act on the jobs of others,
+// and a job can't be resumed once its tenant reached its quota
+func (manager *JobManager) control(jobID string, action Action, principal *Principal) (int, error) {
+	record, status, err := manager.lookupJob(jobID, principal)
+	if err != nil {
+		return status, err
+	}
+	if !principal.canControl(record.Owner) {
+		return http.StatusForbidden, errors.New("Not allowed to " + string(action) + " the Job : owned by another user")
+	}
+	if action == resume {
+		err = manager.admitResume(record.JobID, tenantOf(record.Tenant))
+	} else {
+		err = manager.perform(record.JobID, action)
+	}
+	if err != nil {
+		if _, ok := err.(*cleanError); ok {
+			log.Printf("Performed %s on job: %s\nError: %s", action, jobID, err.Error())
+			return http.StatusOK, err
+		}
+		if _, ok := err.(*quotaError); ok {
+			log.Printf("Failed to %s the job: %s\nError: %s", action, jobID, err.Error())
+			return http.StatusTooManyRequests, err
+		}
+		log.Printf("Failed to %s the job: %s\nError: %s", action, jobID, err.Error())
+		return http.StatusInternalServerError, err
+	}
+	log.Printf("Performed %s on job: %s", action, jobID)
+	return http.StatusOK, nil
+}
+
+// controlJob responds to the HTTP routes performing an action on a job
+func (manager *JobManager) controlJob(c *gin.Context, action Action) {
+	jobID := c.Param("jobID")
+	status, err := manager.control(jobID, action, principalOf(c))
+	if status != http.StatusOK {
+		c.JSON(status, httpError{
+			jobID,
+			err.Error(),
+		})
+		return
+	}
+	res := httpResponse{
+		JobID:   uuid.MustParse(jobID),
+		Message: "Success",
+		Details: make(map[string]interface{}),
+	}
+	if err != nil {
+		res.Details["clean_error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// invalidRequest responds to a request which failed its validation,
+// along with the invalid fields if the args don't match their schema
+func invalidRequest(c *gin.Context, err error) {
+	if invalid, ok := err.(*jobs.ArgsError); ok {
+		c.JSON(http.StatusBadRequest, validationError{
+			"",
+			"Invalid args",
+			invalid.Fields,
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, httpError{
+		"",
+		err.Error(),
+	})
+}
+
 func parseJobRequest(c *gin.Context) (*JobRequest, error) {
 	jobRequest := &JobRequest{
-		"",
-		make(map[string]interface{}),
+		Type:   "",
+		Args:   make(map[string]interface{}),
+		Labels: make(map[string]string),
 	}
 
 	err := c.BindJSON(&jobRequest)
@@ -62,13 +254,19 @@ func parseJobRequest(c *gin.Context) (*JobRequest, error) {
 // submitJob godoc
 // @Summary Submit a job for processing
 // @Description Job processing backend API for Atlan Collect
+// @Description The job is rejected if the tenant of the caller reached its quota of queued jobs
 // @ID submit-job
 // @Accept  json
 // @Produce  json
 // @Param jobRequest body main.JobRequest true "Submit a job"
 // @Success 200 {object} main.httpResponse
-// @Failure 400 {object} main.httpError
+// @Failure 400 {object} main.validationError
+// @Failure 429 {object} main.httpError
 // @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /submit [post]
 func (manager *JobManager) submitJob(c *gin.Context) {
 	newJobID := uuid.New()
@@ -83,56 +281,32 @@ func (manager *JobManager) submitJob(c *gin.Context) {
 		return
 	}
 
-	var newJob JobInterface
-	switch jobRequest.Type {
-	case Simple:
-		newJob = &Job{
-			status:  Submitted,
-			jobID:   newJobID,
-			sigChan: make(chan Signal),
-		}
-	case Export:
-		fromDate, err := time.Parse(timeLayout, jobRequest.Args["from_date"].(string))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, httpError{
-				"",
-				"Invalid from_date format",
-			})
-			return
-		}
-		toDate, err := time.Parse(timeLayout, jobRequest.Args["to_date"].(string))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, httpError{
+	principal := principalOf(c)
+	record := newJobRecord(newJobID, jobRequest, principal.Subject, principal.Tenant)
+	span := manager.startSubmitSpan(c.Request.Context(), record)
+	defer span.End()
+	newJob, err := buildSubmittedJob(record, manager.checkpointer(newJobID), manager.logs.logger(newJobID, record.Type))
+	if err != nil {
+		log.Println("Invalid Job request: ", err.Error())
+		failSpan(span, err)
+		invalidRequest(c, err)
+		return
+	}
+
+	if err = manager.queueJob(record, newJob); err != nil {
+		log.Printf("Failed to queue the job: %s\nError: %s", newJobID.String(), err.Error())
+		failSpan(span, err)
+		if _, ok := err.(*quotaError); ok {
+			c.JSON(http.StatusTooManyRequests, httpError{
 				"",
-				"Invalid to_date format",
+				err.Error(),
 			})
 			return
 		}
-		newJob = &ExportJob{
-			status:   Submitted,
-			jobID:    newJobID,
-			sigChan:  make(chan Signal),
-			fromDate: fromDate,
-			toDate:   toDate,
-			curDate:  fromDate.Add(time.Hour * 24),
-		}
-	default:
-		log.Println("Invalid Job Type")
-		c.JSON(http.StatusBadRequest, httpError{
-			"",
-			"Invalid Job Type",
-		})
-		return
-	}
-
-	manager.jobs[newJobID] = newJob
-	if err = newJob.start(); err != nil {
-		log.Printf("Failed to start the job: %s\nError: %s", newJobID.String(), err.Error())
 		c.JSON(http.StatusInternalServerError, httpError{
 			"",
-			err.Error(),
+			"Failed to queue the job",
 		})
-		delete(manager.jobs, newJobID)
 		return
 	}
 
@@ -154,47 +328,19 @@ func (manager *JobManager) submitJob(c *gin.Context) {
 // @Success 200 {object} httpResponse
 // @Failure 404 {object} main.httpError
 // @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /halt/{jobID} [get]
 func (manager *JobManager) haltJob(c *gin.Context) {
-	jobID := c.Param("jobID")
-	jobUUID, err := uuid.Parse(jobID)
-	if err != nil {
-		log.Println("Error while parsing UUID from string: ", jobID)
-		c.JSON(http.StatusNotFound, httpError{
-			jobID,
-			"Invalid JobID",
-		})
-		return
-	}
-	job, ok := manager.jobs[jobUUID]
-	if !ok {
-		c.JSON(http.StatusNotFound, httpError{
-			jobID,
-			"Invalid JobID",
-		})
-		return
-	}
-
-	if err = job.halt(); err != nil {
-		log.Printf("Failed to stop the job: %s\nError: %s", jobID, err.Error())
-		c.JSON(http.StatusInternalServerError, httpError{
-			jobID,
-			err.Error(),
-		})
-		return
-	}
-	res := httpResponse{
-		JobID:   jobUUID,
-		Message: "Success",
-		Details: make(map[string]interface{}),
-	}
-	log.Println("Halted job:", jobID)
-	c.JSON(http.StatusOK, res)
+	manager.controlJob(c, halt)
 }
 
 // stopJob godoc
 // @Summary Stop a  job
 // @Description Job processing backend API for Atlan Collect
+// @Description The job is stopped even if it fails to roll back its changes, the error is then returned as clean_error in the details
 // @ID stop-job
 // @Accept  json
 // @Produce  json
@@ -202,77 +348,117 @@ func (manager *JobManager) haltJob(c *gin.Context) {
 // @Success 200 {object} main.httpResponse
 // @Failure 404 {object} main.httpError
 // @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /stop/{jobID} [get]
 func (manager *JobManager) stopJob(c *gin.Context) {
+	manager.controlJob(c, stop)
+}
+
+// resumeJob godoc
+// @Summary Resume a pause/halted job
+// @Description Job processing backend API for Atlan Collect
+// @Description The job is queued again unless its tenant reached its quota of queued jobs
+// @ID resume-job
+// @Accept  json
+// @Produce  json
+// @Param jobID path string true "Job ID"
+// @Success 200 {object} main.httpResponse
+// @Failure 404 {object} main.httpError
+// @Failure 429 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /resume/{jobID} [get]
+func (manager *JobManager) resumeJob(c *gin.Context) {
+	manager.controlJob(c, resume)
+}
+
+// detailsJob godoc
+// @Summary Fetch details about a submitted job
+// @Description Job processing backend API for Atlan Collect
+// @ID details-job
+// @Accept  json
+// @Produce  json
+// @Param jobID path string true "Job ID"
+// @Success 200 {object} main.httpResponse
+// @Failure 404 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /details/{jobID} [get]
+func (manager *JobManager) detailsJob(c *gin.Context) {
 	jobID := c.Param("jobID")
-	jobUUID, err := uuid.Parse(jobID)
-	if err != nil {
-		log.Println("Error while parsing UUID from string: ", jobID)
-		c.JSON(http.StatusNotFound, httpError{
-			jobID,
-			"Invalid JobID",
-		})
-		return
-	}
-	job, ok := manager.jobs[jobUUID]
+	record, ok := manager.findJob(c, jobID)
 	if !ok {
-		c.JSON(http.StatusNotFound, httpError{
-			jobID,
-			"Invalid JobID",
-		})
 		return
 	}
-	if err = job.stop(); err != nil {
-		log.Printf("Failed to stop the job: %s\nError: %s\n", jobID, err.Error())
+	jobUUID := record.JobID
+	details, err := manager.jobDetails(record)
+	if err != nil {
+		log.Printf("Failed to fetch the details: %s\nError: %s\n", jobID, err.Error())
 		c.JSON(http.StatusInternalServerError, httpError{
 			jobID,
-			err.Error(),
+			"Failed to fetch the details",
 		})
 		return
 	}
-	job.clean()
-	delete(manager.jobs, jobUUID)
 	res := httpResponse{
 		JobID:   jobUUID,
 		Message: "Success",
-		Details: make(map[string]interface{}),
+		Details: details,
 	}
-	log.Println("Stopped job: ", jobID)
 	c.JSON(http.StatusOK, res)
 }
 
-// resumeJob godoc
-// @Summary Resume a pause/halted job
+// priorityJob godoc
+// @Summary Change the priority of a queued or halted job
 // @Description Job processing backend API for Atlan Collect
-// @ID resume-job
+// @ID priority-job
 // @Accept  json
 // @Produce  json
 // @Param jobID path string true "Job ID"
+// @Param priorityRequest body main.PriorityRequest true "New priority of the job"
 // @Success 200 {object} main.httpResponse
+// @Failure 400 {object} main.httpError
 // @Failure 404 {object} main.httpError
 // @Failure 500 {object} main.httpError
-// @Router /resume/{jobID} [get]
-func (manager *JobManager) resumeJob(c *gin.Context) {
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /priority/{jobID} [post]
+func (manager *JobManager) priorityJob(c *gin.Context) {
 	jobID := c.Param("jobID")
-	jobUUID, err := uuid.Parse(jobID)
-	if err != nil {
-		log.Println("Error while parsing UUID from string: ", jobID)
-		c.JSON(http.StatusNotFound, httpError{
+	record, ok := manager.findJob(c, jobID)
+	if !ok {
+		return
+	}
+	jobUUID := record.JobID
+	if !principalOf(c).canControl(record.Owner) {
+		c.JSON(http.StatusForbidden, httpError{
 			jobID,
-			"Invalid JobID",
+			"Not allowed to change the priority of the Job : owned by another user",
 		})
 		return
 	}
-	job, ok := manager.jobs[jobUUID]
-	if !ok {
-		c.JSON(http.StatusNotFound, httpError{
+
+	priorityRequest := &PriorityRequest{}
+	if err := c.BindJSON(priorityRequest); err != nil {
+		log.Println("Couldn't parse the priority request")
+		c.JSON(http.StatusBadRequest, httpError{
 			jobID,
-			"Invalid JobID",
+			"Invalid priority request format",
 		})
 		return
 	}
-	if err = job.resume(); err != nil {
-		log.Printf("Failed to stop the job: %s\nError: %s\n", jobID, err.Error())
+	if err := manager.reprioritize(jobUUID, priorityRequest.Priority); err != nil {
+		log.Printf("Failed to change the priority of the job: %s\nError: %s\n", jobID, err.Error())
 		c.JSON(http.StatusInternalServerError, httpError{
 			jobID,
 			err.Error(),
@@ -284,81 +470,1078 @@ func (manager *JobManager) resumeJob(c *gin.Context) {
 		Message: "Success",
 		Details: make(map[string]interface{}),
 	}
-	log.Println("Resumed Job:", jobID)
+	log.Println("Changed priority of job:", jobID)
 	c.JSON(http.StatusOK, res)
 }
 
-// detailsJob godoc
-// @Summary Fetch details about a submitted job
+// listJobs godoc
+// @Summary List the submitted jobs
 // @Description Job processing backend API for Atlan Collect
-// @ID details-job
+// @ID list-jobs
 // @Accept  json
 // @Produce  json
-// @Param jobID path string true "Job ID"
-// @Success 200 {object} main.httpResponse
-// @Failure 404 {object} main.httpError
+// @Param type query string false "Filter by job type"
+// @Param status query string false "Filter by job status"
+// @Param owner query string false "Filter by owner, the user who submitted the job"
+// @Param submitted_after query string false "Only jobs submitted at or after the time (RFC3339)"
+// @Param submitted_before query string false "Only jobs submitted before the time (RFC3339)"
+// @Param label query []string false "Filter by label as key:value, can be repeated"
+// @Param sort query string false "Sort by submitted_at, status or type, prefix with - for descending order"
+// @Param limit query int false "Number of jobs per page, at most 100"
+// @Param cursor query string false "Cursor of the page returned as next_cursor"
+// @Success 200 {object} main.jobsResponse
+// @Failure 400 {object} main.httpError
 // @Failure 500 {object} main.httpError
-// @Router /details/{jobID} [get]
-func (manager *JobManager) detailsJob(c *gin.Context) {
-	jobID := c.Param("jobID")
-	jobUUID, err := uuid.Parse(jobID)
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /jobs [get]
+func (manager *JobManager) listJobs(c *gin.Context) {
+	query, err := parseJobQuery(c.Query, c.QueryArray("label"))
 	if err != nil {
-		log.Println("Error while parsing UUID from string: ", jobID)
-		c.JSON(http.StatusNotFound, httpError{
-			jobID,
-			"Invalid JobID",
-		})
-		return
-	}
-	job, ok := manager.jobs[jobUUID]
-	if !ok {
-		c.JSON(http.StatusNotFound, httpError{
-			jobID,
-			"Invalid JobID",
+		c.JSON(http.StatusBadRequest, httpError{
+			"",
+			err.Error(),
 		})
 		return
 	}
-	details := job.details()
-	res := httpResponse{
-		JobID:   jobUUID,
-		Message: "Success",
-		Details: details,
-	}
+	query.tenant = principalOf(c).Tenant
+	records, err := manager.store.list()
 	if err != nil {
-		log.Println("Couldn't marshal job details")
+		log.Println("Failed to list the jobs: ", err.Error())
 		c.JSON(http.StatusInternalServerError, httpError{
 			"",
-			"Failed to fetch the details",
+			"Failed to list the jobs",
 		})
 		return
 	}
+
+	page, nextCursor := query.apply(records)
+	res := jobsResponse{
+		Jobs:       make([]jobSummary, 0, len(page)),
+		NextCursor: nextCursor,
+	}
+	for _, record := range page {
+		details, err := manager.jobDetails(record)
+		if err != nil {
+			log.Printf("Failed to fetch the details: %s\nError: %s\n", record.JobID.String(), err.Error())
+			continue
+		}
+		res.Jobs = append(res.Jobs, details)
+	}
 	c.JSON(http.StatusOK, res)
 }
 
-// @title Job submitting backend
-// @version 0.1
-// @description Job processing backend API for Atlan Collect
-func main() {
-	// Setup jobs queue
-	manager := &JobManager{
-		jobs: make(map[uuid.UUID]JobInterface),
+// queueStats godoc
+// @Summary Fetch the state of the job queue and workers
+// @Description Job processing backend API for Atlan Collect
+// @Description The queue only lists the jobs of the tenant of the caller
+// @ID queue-stats
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} main.QueueStats
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /queue [get]
+func (manager *JobManager) queueStats(c *gin.Context) {
+	c.JSON(http.StatusOK, manager.scheduler.stats(principalOf(c).Tenant))
+}
+
+// schedulerStats godoc
+// @Summary Fetch the share of the workers of the tenants
+// @Description Job processing backend API for Atlan Collect
+// @Description Operators of the default tenant see every tenant with running or queued jobs, other users only their tenant
+// @ID scheduler-stats
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} main.SchedulerStats
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /scheduler [get]
+func (manager *JobManager) schedulerStats(c *gin.Context) {
+	principal := principalOf(c)
+	all := principal.Tenant == defaultTenant && principal.has(Operator)
+	c.JSON(http.StatusOK, manager.scheduler.shares(principal.Tenant, all))
+}
+
+// streamEvents godoc
+// @Summary Stream the status and progress changes of every job as Server-Sent Events
+// @Description Job processing backend API for Atlan Collect
+// @Description Only the events following the connection are sent, unless the stream resumes after the event given in the Last-Event-ID header
+// @ID stream-events
+// @Produce  text/event-stream
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {object} main.Event
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /events [get]
+func (manager *JobManager) streamEvents(c *gin.Context) {
+	manager.stream(c, uuid.Nil)
+}
+
+// streamJobEvents godoc
+// @Summary Stream the status and progress changes of a job as Server-Sent Events
+// @Description Job processing backend API for Atlan Collect
+// @Description Only the events following the connection are sent, unless the stream resumes after the event given in the Last-Event-ID header
+// @ID stream-job-events
+// @Produce  text/event-stream
+// @Param jobID path string true "Job ID"
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {object} main.Event
+// @Failure 404 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /events/{jobID} [get]
+func (manager *JobManager) streamJobEvents(c *gin.Context) {
+	record, ok := manager.findJob(c, c.Param("jobID"))
+	if !ok {
+		return
 	}
-	r := initRouter(manager)
+	manager.stream(c, record.JobID)
+}
 
-	log.Println("Swagger docs can be found on http://localhost:8080/swagger/index.html")
+// stream sends the events of the job as Server-Sent Events,
+// those of every job of the tenant if jobID is nil
+func (manager *JobManager) stream(c *gin.Context, jobID uuid.UUID) {
+	// Only a client resuming its stream gets the kept events
+	tenant := principalOf(c).Tenant
+	missed := []Event{}
+	var sub *subscription
+	if lastID, err := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64); err == nil {
+		missed, sub = manager.events.resume(jobID, tenant, lastID)
+	} else {
+		sub = manager.events.subscribe(jobID, tenant)
+	}
+	defer manager.events.unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	for _, event := range missed {
+		writeEvent(c, event)
+	}
+	c.Writer.Flush()
 
-	r.Run(":8080")
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				// Dropped for lagging behind, the client reconnects with Last-Event-ID
+				return
+			}
+			writeEvent(c, event)
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		case <-c.Request.Context().Done():
+			return
+		}
+		c.Writer.Flush()
+	}
 }
 
-func initRouter(manager *JobManager) *gin.Engine {
-	r := gin.Default()
-	r.Use(gin.Logger())
-	r.Use(gin.Recovery())
-	r.POST("/submit", manager.submitJob)
-	r.GET("/halt/:jobID", manager.haltJob)
-	r.GET("/stop/:jobID", manager.stopJob)
-	r.GET("/resume/:jobID", manager.resumeJob)
-	r.GET("/details/:jobID", manager.detailsJob)
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+// writeEvent writes the event in the Server-Sent Events format
+func writeEvent(c *gin.Context, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Failed to marshal the event: ", err.Error())
+		return
+	}
+	fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// jobTypes godoc
+// @Summary List the job types along with the JSON Schema of their args
+// @Description Job processing backend API for Atlan Collect
+// @ID job-types
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} main.jobTypesResponse
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /job-types [get]
+func jobTypesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, jobTypesResponse{jobs.List()})
+}
+
+// apiDocs serves the swagger docs generated by swag, along with
+// the schemas of the args of the registered job types as definitions
+func apiDocs(c *gin.Context) {
+	doc, err := swag.ReadDoc()
+	if err != nil {
+		log.Println("Failed to read the swagger docs: ", err.Error())
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	spec := make(map[string]interface{})
+	if err = json.Unmarshal([]byte(doc), &spec); err != nil {
+		log.Println("Failed to parse the swagger docs: ", err.Error())
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	definitions, ok := spec["definitions"].(map[string]interface{})
+	if !ok {
+		definitions = make(map[string]interface{})
+		spec["definitions"] = definitions
+	}
+	for _, jobType := range jobs.List() {
+		definitions["args."+jobType.Name] = jobType.Args
+	}
+	c.JSON(http.StatusOK, spec)
+}
+
+// createSchedule godoc
+// @Summary Create a recurring job schedule
+// @Description Job processing backend API for Atlan Collect
+// @ID create-schedule
+// @Accept  json
+// @Produce  json
+// @Param scheduleRequest body main.ScheduleRequest true "Schedule a recurring job"
+// @Success 200 {object} main.Schedule
+// @Failure 400 {object} main.validationError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /schedules [post]
+func (runner *scheduleRunner) createSchedule(c *gin.Context) {
+	scheduleRequest := &ScheduleRequest{
+		JobRequest: JobRequest{
+			Args:   make(map[string]interface{}),
+			Labels: make(map[string]string),
+		},
+	}
+	if err := c.BindJSON(scheduleRequest); err != nil {
+		log.Println("Couldn't parse the schedule request")
+		c.JSON(http.StatusBadRequest, httpError{
+			"",
+			"Invalid schedule request format",
+		})
+		return
+	}
+	principal := principalOf(c)
+	schedule, err := newSchedule(scheduleRequest, principal.Subject, principal.Tenant)
+	if err != nil {
+		log.Println("Invalid schedule request: ", err.Error())
+		invalidRequest(c, err)
+		return
+	}
+	if err = runner.store.saveSchedule(schedule); err != nil {
+		log.Printf("Failed to save the schedule: %s\nError: %s", schedule.ScheduleID.String(), err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			"",
+			"Failed to save the schedule",
+		})
+		return
+	}
+	log.Println("Created schedule:", schedule.ScheduleID.String())
+	c.JSON(http.StatusOK, schedule)
+}
+
+// listSchedules godoc
+// @Summary List the recurring job schedules
+// @Description Job processing backend API for Atlan Collect
+// @ID list-schedules
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} main.schedulesResponse
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /schedules [get]
+func (runner *scheduleRunner) listSchedules(c *gin.Context) {
+	schedules, err := runner.list(principalOf(c).Tenant)
+	if err != nil {
+		log.Println("Failed to list the schedules: ", err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			"",
+			"Failed to list the schedules",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, schedulesResponse{schedules})
+}
+
+// getSchedule godoc
+// @Summary Fetch a recurring job schedule along with its runs
+// @Description Job processing backend API for Atlan Collect
+// @ID get-schedule
+// @Accept  json
+// @Produce  json
+// @Param scheduleID path string true "Schedule ID"
+// @Success 200 {object} main.Schedule
+// @Failure 404 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /schedules/{scheduleID} [get]
+func (runner *scheduleRunner) getSchedule(c *gin.Context) {
+	scheduleID, err := uuid.Parse(c.Param("scheduleID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, httpError{
+			"",
+			"Invalid ScheduleID",
+		})
+		return
+	}
+	schedule, err := runner.store.getSchedule(scheduleID)
+	if err == errScheduleNotFound || (err == nil && !principalOf(c).sees(schedule.Tenant)) {
+		c.JSON(http.StatusNotFound, httpError{
+			"",
+			"Invalid ScheduleID",
+		})
+		return
+	} else if err != nil {
+		log.Printf("Failed to fetch the schedule: %s\nError: %s", scheduleID.String(), err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			"",
+			"Failed to fetch the schedule",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// deleteSchedule godoc
+// @Summary Delete a recurring job schedule, jobs already created are kept
+// @Description Job processing backend API for Atlan Collect
+// @ID delete-schedule
+// @Accept  json
+// @Produce  json
+// @Param scheduleID path string true "Schedule ID"
+// @Success 200 {object} main.scheduleResponse
+// @Failure 404 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /schedules/{scheduleID} [delete]
+func (runner *scheduleRunner) deleteSchedule(c *gin.Context) {
+	scheduleID, err := uuid.Parse(c.Param("scheduleID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, httpError{
+			"",
+			"Invalid ScheduleID",
+		})
+		return
+	}
+	schedule, err := runner.store.getSchedule(scheduleID)
+	if err == errScheduleNotFound || (err == nil && !principalOf(c).sees(schedule.Tenant)) {
+		c.JSON(http.StatusNotFound, httpError{
+			"",
+			"Invalid ScheduleID",
+		})
+		return
+	}
+	if err == nil && !principalOf(c).canControl(schedule.Owner) {
+		c.JSON(http.StatusForbidden, httpError{
+			"",
+			"Not allowed to delete the Schedule : owned by another user",
+		})
+		return
+	}
+	if err == nil {
+		err = runner.store.deleteSchedule(scheduleID)
+	}
+	if err != nil {
+		log.Printf("Failed to delete the schedule: %s\nError: %s", scheduleID.String(), err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			"",
+			"Failed to delete the schedule",
+		})
+		return
+	}
+	log.Println("Deleted schedule:", scheduleID.String())
+	c.JSON(http.StatusOK, scheduleResponse{
+		ScheduleID: scheduleID,
+		Message:    "Success",
+	})
+}
+
+// createWebhook godoc
+// @Summary Subscribe a webhook to the transitions of every job of the tenant
+// @Description Job processing backend API for Atlan Collect
+// @ID create-webhook
+// @Accept  json
+// @Produce  json
+// @Param webhookRequest body main.WebhookRequest true "Subscribe a webhook"
+// @Success 200 {object} main.Webhook
+// @Failure 400 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks [post]
+func (dispatcher *webhookDispatcher) createWebhook(c *gin.Context) {
+	webhookRequest := &WebhookRequest{}
+	if err := c.BindJSON(webhookRequest); err != nil {
+		log.Println("Couldn't parse the webhook request")
+		c.JSON(http.StatusBadRequest, httpError{
+			"",
+			"Invalid webhook request format",
+		})
+		return
+	}
+	webhook, err := newWebhook(webhookRequest, principalOf(c).Tenant)
+	if err != nil {
+		log.Println("Invalid webhook request: ", err.Error())
+		c.JSON(http.StatusBadRequest, httpError{
+			"",
+			err.Error(),
+		})
+		return
+	}
+	if err = dispatcher.subscribe(webhook); err != nil {
+		log.Printf("Failed to save the webhook: %s\nError: %s", webhook.WebhookID.String(), err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			"",
+			"Failed to save the webhook",
+		})
+		return
+	}
+	log.Println("Created webhook:", webhook.WebhookID.String())
+	c.JSON(http.StatusOK, webhook.public())
+}
+
+// listWebhooks godoc
+// @Summary List the webhooks subscribed to the job transitions of the tenant
+// @Description Job processing backend API for Atlan Collect
+// @ID list-webhooks
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} main.webhooksResponse
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks [get]
+func (dispatcher *webhookDispatcher) listWebhooks(c *gin.Context) {
+	c.JSON(http.StatusOK, webhooksResponse{dispatcher.list(principalOf(c).Tenant)})
+}
+
+// deleteWebhook godoc
+// @Summary Delete a webhook, its pending deliveries fail
+// @Description Job processing backend API for Atlan Collect
+// @ID delete-webhook
+// @Accept  json
+// @Produce  json
+// @Param webhookID path string true "Webhook ID"
+// @Success 200 {object} main.webhookResponse
+// @Failure 404 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /webhooks/{webhookID} [delete]
+func (dispatcher *webhookDispatcher) deleteWebhook(c *gin.Context) {
+	webhookID, err := uuid.Parse(c.Param("webhookID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, httpError{
+			"",
+			"Invalid WebhookID",
+		})
+		return
+	}
+	webhook, err := dispatcher.store.getWebhook(webhookID)
+	if err == errWebhookNotFound || (err == nil && !principalOf(c).sees(webhook.Tenant)) {
+		c.JSON(http.StatusNotFound, httpError{
+			"",
+			"Invalid WebhookID",
+		})
+		return
+	}
+	if err == nil {
+		err = dispatcher.unsubscribe(webhookID)
+	}
+	if err != nil {
+		log.Printf("Failed to delete the webhook: %s\nError: %s", webhookID.String(), err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			"",
+			"Failed to delete the webhook",
+		})
+		return
+	}
+	log.Println("Deleted webhook:", webhookID.String())
+	c.JSON(http.StatusOK, webhookResponse{
+		WebhookID: webhookID,
+		Message:   "Success",
+	})
+}
+
+// jobDeliveries godoc
+// @Summary Fetch the webhook deliveries of the transitions of a job
+// @Description Job processing backend API for Atlan Collect
+// @ID job-deliveries
+// @Accept  json
+// @Produce  json
+// @Param jobID path string true "Job ID"
+// @Success 200 {object} main.deliveriesResponse
+// @Failure 404 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /jobs/{jobID}/deliveries [get]
+func (manager *JobManager) jobDeliveries(c *gin.Context) {
+	record, ok := manager.findJob(c, c.Param("jobID"))
+	if !ok {
+		return
+	}
+	deliveries := record.Deliveries
+	if deliveries == nil {
+		deliveries = []Delivery{}
+	}
+	c.JSON(http.StatusOK, deliveriesResponse{deliveries})
+}
+
+// readJobLogs godoc
+// @Summary Fetch the log lines of a job, or follow them as Server-Sent Events
+// @Description Job processing backend API for Atlan Collect
+// @Description With follow=true the lines are streamed as log events until the job ends, resuming after the line given in the Last-Event-ID header
+// @ID job-logs
+// @Produce  json
+// @Produce  text/event-stream
+// @Param jobID path string true "Job ID"
+// @Param level query string false "Minimum level of the lines, debug, info, warn or error"
+// @Param after query integer false "Only return the lines following this sequence number"
+// @Param follow query boolean false "Stream the lines until the job ends"
+// @Param Last-Event-ID header string false "Sequence number of the last line received when following"
+// @Success 200 {object} main.logsResponse
+// @Failure 400 {object} main.httpError
+// @Failure 404 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /jobs/{jobID}/logs [get]
+func (manager *JobManager) readJobLogs(c *gin.Context) {
+	record, ok := manager.findJob(c, c.Param("jobID"))
+	if !ok {
+		return
+	}
+	level, err := parseLogLevel(c.Query("level"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpError{
+			record.JobID.String(),
+			err.Error(),
+		})
+		return
+	}
+	after := c.Query("after")
+	follow := c.Query("follow") == "true"
+	if lastID := c.GetHeader("Last-Event-ID"); follow && lastID != "" {
+		after = lastID
+	}
+	var seq uint64
+	if after != "" {
+		if seq, err = strconv.ParseUint(after, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, httpError{
+				record.JobID.String(),
+				"Invalid after, expected a sequence number",
+			})
+			return
+		}
+	}
+	if follow {
+		manager.followJobLogs(c, record.JobID, seq, level)
+		return
+	}
+	entries, err := manager.logs.list(record.JobID, seq)
+	if err != nil {
+		log.Printf("Failed to fetch the logs of the job: %s\nError: %s", record.JobID.String(), err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			record.JobID.String(),
+			"Failed to fetch the logs",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, logsResponse{filterLogs(entries, level)})
+}
+
+// followJobLogs streams the log lines of the job following the
+// sequence number as Server-Sent Events, until the job ends
+func (manager *JobManager) followJobLogs(c *gin.Context, jobID uuid.UUID, after uint64, level string) {
+	ended := func() bool {
+		record, err := manager.store.get(jobID)
+		return err != nil || isTerminal(record.Status)
+	}
+	write := func(entry LogEntry) {
+		after = entry.Seq
+		if logLevels[entry.Level] < logLevels[level] {
+			return
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			log.Println("Failed to marshal the log line: ", err.Error())
+			return
+		}
+		fmt.Fprintf(c.Writer, "id: %d\nevent: log\ndata: %s\n\n", entry.Seq, data)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		missed, sub, err := manager.logs.subscribe(jobID, after)
+		if err != nil {
+			log.Printf("Failed to fetch the logs of the job: %s\nError: %s", jobID.String(), err.Error())
+			return
+		}
+		for _, entry := range missed {
+			write(*entry)
+		}
+		c.Writer.Flush()
+		// The lines of an ended job are only the buffered ones
+		done := ended()
+		if done {
+			manager.logs.unsubscribe(sub)
+		}
+		for open := true; open; {
+			select {
+			case entry, ok := <-sub.entries:
+				if ok {
+					write(entry)
+				}
+				open = ok
+			case <-heartbeat.C:
+				fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			case <-c.Request.Context().Done():
+				manager.logs.unsubscribe(sub)
+				return
+			}
+			c.Writer.Flush()
+		}
+		if done || ended() {
+			return
+		}
+		// Dropped for lagging behind, resume after the last line sent
+	}
+}
+
+// createAPIKey godoc
+// @Summary Create an API key
+// @Description Job processing backend API for Atlan Collect
+// @Description The key is only returned in the response, the server keeps its hash
+// @Description The key belongs to the tenant of the caller and authenticates as the caller, a key of another owner is refused
+// @ID create-api-key
+// @Accept  json
+// @Produce  json
+// @Param apiKeyRequest body main.APIKeyRequest true "Owner and role of the key"
+// @Success 200 {object} main.apiKeyResponse
+// @Failure 400 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api-keys [post]
+func (auth *authenticator) createAPIKey(c *gin.Context) {
+	apiKeyRequest := &APIKeyRequest{}
+	if err := c.BindJSON(apiKeyRequest); err != nil {
+		log.Println("Couldn't parse the API key request")
+		c.JSON(http.StatusBadRequest, httpError{
+			"",
+			"Invalid API key request format",
+		})
+		return
+	}
+	// Ownership checks would take a key of another owner for that user
+	principal := principalOf(c)
+	if apiKeyRequest.Owner == "" {
+		apiKeyRequest.Owner = principal.Subject
+	}
+	if apiKeyRequest.Owner != principal.Subject {
+		c.JSON(http.StatusForbidden, httpError{
+			"",
+			"API keys can only be owned by their creator",
+		})
+		return
+	}
+	key, secret, err := newAPIKey(apiKeyRequest, principal.Tenant)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpError{
+			"",
+			err.Error(),
+		})
+		return
+	}
+	if err = auth.store.saveAPIKey(key); err != nil {
+		log.Printf("Failed to save the API key: %s\nError: %s", key.KeyID.String(), err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			"",
+			"Failed to save the API key",
+		})
+		return
+	}
+	log.Printf("Created API key: %s for %s as %s of %s", key.KeyID.String(), key.Owner, key.Role, key.Tenant)
+	c.JSON(http.StatusOK, apiKeyResponse{key.KeyID, secret, "Success"})
+}
+
+// listAPIKeys godoc
+// @Summary List the API keys of the tenant, without their value
+// @Description Job processing backend API for Atlan Collect
+// @ID list-api-keys
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} main.apiKeysResponse
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api-keys [get]
+func (auth *authenticator) listAPIKeys(c *gin.Context) {
+	keys, err := auth.store.listAPIKeys()
+	if err != nil {
+		log.Println("Failed to list the API keys: ", err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			"",
+			"Failed to list the API keys",
+		})
+		return
+	}
+	principal := principalOf(c)
+	public := make([]APIKey, 0, len(keys))
+	for _, key := range keys {
+		if principal.sees(key.Tenant) {
+			public = append(public, key.public())
+		}
+	}
+	c.JSON(http.StatusOK, apiKeysResponse{public})
+}
+
+// deleteAPIKey godoc
+// @Summary Revoke an API key
+// @Description Job processing backend API for Atlan Collect
+// @ID delete-api-key
+// @Accept  json
+// @Produce  json
+// @Param keyID path string true "API key ID"
+// @Success 200 {object} main.httpResponse
+// @Failure 404 {object} main.httpError
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Failure 403 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api-keys/{keyID} [delete]
+func (auth *authenticator) deleteAPIKey(c *gin.Context) {
+	keyID, err := uuid.Parse(c.Param("keyID"))
+	if err == nil {
+		err = auth.revoke(keyID, principalOf(c))
+	}
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Failed to delete the API key"
+		if err == errAPIKeyNotFound || keyID == uuid.Nil {
+			status, message = http.StatusNotFound, "Invalid API key ID"
+		} else {
+			log.Printf("Failed to delete the API key: %s\nError: %s", keyID.String(), err.Error())
+		}
+		c.JSON(status, httpError{
+			"",
+			message,
+		})
+		return
+	}
+	log.Println("Deleted API key:", keyID.String())
+	c.JSON(http.StatusOK, httpResponse{
+		JobID:   uuid.Nil,
+		Message: "Success",
+		Details: make(map[string]interface{}),
+	})
+}
+
+// downloadArtifact godoc
+// @Summary Download an artifact produced by a job
+// @Description Job processing backend API for Atlan Collect
+// @Description Range requests are supported to download a part of the artifact or resume a download
+// @ID download-artifact
+// @Produce  octet-stream
+// @Param jobID path string true "Job ID"
+// @Param name path string true "Name of the artifact"
+// @Param Range header string false "Byte ranges, e.g. bytes=0-1023"
+// @Success 200 {string} string "Content of the artifact"
+// @Success 206 {string} string "Requested ranges of the artifact"
+// @Failure 404 {object} main.httpError
+// @Failure 416 {string} string
+// @Failure 500 {object} main.httpError
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /jobs/{jobID}/artifacts/{name} [get]
+func (manager *JobManager) downloadArtifact(c *gin.Context) {
+	jobID := c.Param("jobID")
+	record, ok := manager.findJob(c, jobID)
+	if !ok {
+		return
+	}
+	details, err := manager.jobDetails(record)
+	if err != nil {
+		log.Printf("Failed to fetch the details: %s\nError: %s\n", jobID, err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			jobID,
+			"Failed to fetch the artifact",
+		})
+		return
+	}
+	var artifact *jobs.Artifact
+	artifacts, _ := details["artifacts"].([]jobs.Artifact)
+	for i := range artifacts {
+		if artifacts[i].Name == c.Param("name") {
+			artifact = &artifacts[i]
+		}
+	}
+	if artifact == nil {
+		c.JSON(http.StatusNotFound, httpError{
+			jobID,
+			"Invalid artifact",
+		})
+		return
+	}
+	content, closer, err := artifactStore.Open(record.JobID, artifact)
+	if err != nil {
+		log.Printf("Failed to open the artifact %s of the job: %s\nError: %s", artifact.Name, jobID, err.Error())
+		c.JSON(http.StatusInternalServerError, httpError{
+			jobID,
+			"Failed to fetch the artifact",
+		})
+		return
+	}
+	defer closer.Close()
+	// ServeContent answers the range and conditional requests
+	c.Header("Content-Type", artifact.ContentType)
+	// The name is quoted and escaped, its quotes and semicolons stay in the file name
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name}))
+	c.Header("ETag", `"`+artifact.Checksum+`"`)
+	http.ServeContent(c.Writer, c.Request, artifact.Name, artifact.CreatedAt, content)
+}
+
+// @title Job submitting backend
+// @version 0.1
+// @description Job processing backend API for Atlan Collect
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+func main() {
+	dbPath := flag.String("db", "jobs.db", "Path of the database file to persist jobs, empty to keep jobs in memory")
+	workers := flag.Int("workers", 4, "Number of jobs processed at once")
+	aging := flag.Duration("aging", time.Minute, "Time a queued job waits for its priority to be raised by one, 0 to disable aging")
+	typeLimits := flag.String("type-limits", "", "Maximum number of jobs of a type processed at once, as a comma separated list of Type=limit")
+	tenantMaxRunning := flag.Int("tenant-max-running", 0, "Maximum number of jobs of a tenant processed at once, 0 for unlimited")
+	tenantMaxQueued := flag.Int("tenant-max-queued", 0, "Maximum number of jobs of a tenant waiting in the queue, 0 for unlimited")
+	tenantQuotas := flag.String("tenant-quotas", "", "Quotas of the tenants overriding the default ones, as a comma separated list of tenant=running:queued")
+	fairShareEnabled := flag.Bool("fair-share", true, "Share the workers between the tenants according to their weights, jobs are started by priority across every tenant if disabled")
+	fairShareTypes := flag.Bool("fair-share-types", false, "Share the workers of a tenant between its job types according to their weights")
+	tenantWeights := flag.String("tenant-weights", "", "Weights of the tenants sharing the workers, as a comma separated list of tenant=weight, 1 if missing")
+	typeWeights := flag.String("type-weights", "", "Weights of the job types sharing the workers of a tenant, as a comma separated list of Type=weight, 1 if missing")
+	webhookSecret := flag.String("webhook-secret", "", "Secret signing the payloads of the callback URLs and of the webhooks without their own secret, a random secret is generated and kept in the store if empty")
+	flag.BoolVar(&webhookAllowPrivate, "webhook-allow-private", webhookAllowPrivate, "Allow the webhooks and callback URLs to target loopback, link-local and private addresses, refused by default")
+	exportSource := flag.String("export-source", "", "Path of the SQLite database the export jobs of the default tenant read from")
+	tenantExportSources := flag.String("tenant-export-sources", "", "Paths of the SQLite databases the export jobs of the other tenants read from, as a comma separated list of tenant=path")
+	exportTables := flag.String("export-tables", "", "Tables the export jobs of the default tenant can export from its source, as a comma separated list")
+	tenantExportTables := flag.String("tenant-export-tables", "", "Tables the export jobs of the other tenants can export from their source, as a comma separated list of tenant=table, a tenant being repeated for each of its tables")
+	exportDir := flag.String("export-dir", "exports", "Directory the export jobs write their output to until it is saved as an artifact")
+	artifacts := flag.String("artifacts", "artifacts", "Where the artifacts of the jobs are stored, a local directory or an S3 bucket like s3://bucket/prefix")
+	s3Endpoint := flag.String("s3-endpoint", "https://s3.amazonaws.com", "Endpoint of the S3 compatible service storing the artifacts, credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN")
+	s3Region := flag.String("s3-region", "us-east-1", "Region of the S3 bucket storing the artifacts")
+	authEnabled := flag.Bool("auth", true, "Require an API key or a JWT on every request, disabled requests are made as an anonymous operator")
+	jwksPath := flag.String("jwks", "", "Path of the JWKS file holding the keys verifying the JWT bearer tokens, tokens are rejected if empty")
+	jwtIssuer := flag.String("jwt-issuer", "", "Expected issuer of the JWT bearer tokens, not checked if empty")
+	jwtAudience := flag.String("jwt-audience", "", "Expected audience of the JWT bearer tokens, not checked if empty")
+	jwtRoleClaim := flag.String("jwt-role-claim", "role", "Claim of the JWT bearer tokens holding the role of the user")
+	jwtTenantClaim := flag.String("jwt-tenant-claim", "tenant", "Claim of the JWT bearer tokens holding the tenant of the user, the tokens without it are refused")
+	jobLogsStdout := flag.Bool("job-logs-stdout", false, "Print the log lines of the jobs on the standard output as well")
+	traceExporter := flag.String("trace-exporter", "", "Exporter of the spans tracing the requests and the jobs, otlp or file, tracing is disabled if empty")
+	otlpEndpoint := flag.String("otlp-endpoint", "http://localhost:4318", "Endpoint of the OpenTelemetry collector receiving the spans with OTLP over HTTP")
+	otlpHeaders := flag.String("otlp-headers", "", "Headers sent to the OpenTelemetry collector, as a comma separated list of key=value")
+	traceFile := flag.String("trace-file", "traces.jsonl", "File the spans are appended to by the file exporter, one JSON span per line")
+	createAPIKey := flag.String("create-api-key", "", "Create an API key for owner:role or owner:role:tenant, print it and exit")
+	flag.Parse()
+
+	limits, err := parseTypeLimits(*typeLimits)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	if *workers <= 0 {
+		log.Fatalln("Invalid number of workers: ", *workers)
+	}
+	quotas, err := parseTenantQuotas(*tenantQuotas, TenantQuota{*tenantMaxRunning, *tenantMaxQueued})
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	share := &fairShare{enabled: *fairShareEnabled, types: *fairShareTypes}
+	if share.tenantWeights, err = parseWeights(*tenantWeights, nil); err != nil {
+		log.Fatalln(err.Error())
+	}
+	share.typeWeights, err = parseWeights(*typeWeights, func(name string) bool {
+		_, ok := jobs.Lookup(name)
+		return ok
+	})
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	traces, err := newTracerProvider(*traceExporter, *otlpEndpoint, *otlpHeaders, *traceFile)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	if artifactStore, err = newArtifactStore(*artifacts, *s3Endpoint, *s3Region); err != nil {
+		log.Fatalln(err.Error())
+	}
+	sources, err := parseExportSources(*tenantExportSources, *exportSource, *tenantExportTables, *exportTables)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	err = jobs.Configure(export.Name, &export.Config{
+		Sources:      sources,
+		Dir:          *exportDir,
+		Artifacts:    artifactStore,
+		DayDurations: metrics.exportDay,
+	})
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	var store Store
+	if *dbPath == "" {
+		store = newMemoryStore()
+	} else {
+		var err error
+		store, err = newBoltStore(*dbPath)
+		if err != nil {
+			log.Fatalln("Failed to open the job store: ", err.Error())
+		}
+	}
+	defer store.close()
+
+	auth, err := newAuthenticator(store, *jwksPath, *jwtIssuer, *jwtAudience, *jwtRoleClaim, *jwtTenantClaim)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	auth.disabled = !*authEnabled
+	if *createAPIKey != "" {
+		parts := strings.SplitN(*createAPIKey, ":", 3)
+		if len(parts) < 2 {
+			log.Fatalln("Invalid API key, expected owner:role or owner:role:tenant")
+		}
+		tenant := defaultTenant
+		if len(parts) == 3 && parts[2] != "" {
+			tenant = parts[2]
+		}
+		key, secret, err := newAPIKey(&APIKeyRequest{Owner: parts[0], Role: parts[1]}, tenant)
+		if err == nil {
+			err = store.saveAPIKey(key)
+		}
+		if err != nil {
+			log.Fatalln("Failed to create the API key: ", err.Error())
+		}
+		fmt.Println(secret)
+		return
+	}
+	if auth.disabled {
+		log.Println("Authentication is disabled, every request is allowed")
+	}
+
+	if *webhookSecret == "" {
+		if *webhookSecret, err = store.webhookSecret(newWebhookSecret); err != nil {
+			log.Fatalln("Failed to load the webhook secret: ", err.Error())
+		}
+		log.Println("No webhook secret given, the payloads are signed with the secret generated in the store")
+	}
+	webhooks, err := newWebhookDispatcher(store, *webhookSecret)
+	if err != nil {
+		log.Fatalln("Failed to load the webhooks: ", err.Error())
+	}
+
+	// Setup jobs queue
+	manager := newJobManager(store, newJobLogs(store, *jobLogsStdout), webhooks, traces, *workers, limits, quotas, share, *aging)
+	if err := manager.loadJobs(); err != nil {
+		log.Fatalln("Failed to load the jobs: ", err.Error())
+	}
+	runner := newScheduleRunner(store, manager)
+	r := initRouter(manager, runner, webhooks, auth)
+
+	log.Println("Swagger docs can be found on http://localhost:8080/swagger/index.html")
+
+	server := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln(err.Error())
+		}
+	}()
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+	log.Println("Shutting down")
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Failed to wait for the requests in progress: ", err.Error())
+	}
+	// The pending deliveries are saved and sent again after a restart
+	webhooks.stop()
+}
+
+func initRouter(manager *JobManager, runner *scheduleRunner, webhooks *webhookDispatcher, auth *authenticator) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.LoggerWithFormatter(logRequest))
+	r.Use(gin.Recovery())
+	r.Use(otelgin.Middleware(serviceName, otelgin.WithTracerProvider(manager.traces), otelgin.WithPropagators(propagator)))
+	r.Use(metrics.instrument)
+	r.GET("/api-docs.json", apiDocs)
+	r.GET("/metrics", metrics.serveMetrics)
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/api-docs.json")))
+
+	// Every other route requires a role, the ownership
+	// of the jobs and schedules is checked by the handlers
+	viewer := r.Group("/", auth.authenticate, requireRole(Viewer))
+	viewer.GET("/details/:jobID", manager.detailsJob)
+	viewer.GET("/jobs", manager.listJobs)
+	viewer.GET("/jobs/:jobID/deliveries", manager.jobDeliveries)
+	viewer.GET("/jobs/:jobID/artifacts/:name", manager.downloadArtifact)
+	viewer.GET("/jobs/:jobID/logs", manager.readJobLogs)
+	viewer.GET("/queue", manager.queueStats)
+	viewer.GET("/scheduler", manager.schedulerStats)
+	viewer.GET("/job-types", jobTypesHandler)
+	viewer.GET("/events", manager.streamEvents)
+	viewer.GET("/events/:jobID", manager.streamJobEvents)
+	viewer.GET("/ws", manager.controlSocket)
+	viewer.GET("/schedules", runner.listSchedules)
+	viewer.GET("/schedules/:scheduleID", runner.getSchedule)
+
+	submitter := r.Group("/", auth.authenticate, requireRole(Submitter))
+	submitter.POST("/submit", manager.submitJob)
+	submitter.GET("/halt/:jobID", manager.haltJob)
+	submitter.GET("/stop/:jobID", manager.stopJob)
+	submitter.GET("/resume/:jobID", manager.resumeJob)
+	submitter.POST("/priority/:jobID", manager.priorityJob)
+	submitter.POST("/schedules", runner.createSchedule)
+	submitter.DELETE("/schedules/:scheduleID", runner.deleteSchedule)
+
+	operator := r.Group("/", auth.authenticate, requireRole(Operator))
+	operator.POST("/webhooks", webhooks.createWebhook)
+	operator.GET("/webhooks", webhooks.listWebhooks)
+	operator.DELETE("/webhooks/:webhookID", webhooks.deleteWebhook)
+	operator.POST("/api-keys", auth.createAPIKey)
+	operator.GET("/api-keys", auth.listAPIKeys)
+	operator.DELETE("/api-keys/:keyID", auth.deleteAPIKey)
 	return r
 }
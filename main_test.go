@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+// TestSubmitInvalidArgs checks that the args which don't match
+// the schema of the job type are rejected with the invalid fields
+func TestSubmitInvalidArgs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, restore := exportEnv(t, "acme")
+	defer restore()
+	manager := newTestManager(t, newMemoryStore(), 0)
+	r := gin.New()
+	r.POST("/submit", func(c *gin.Context) {
+		c.Set(principalKey, &Principal{Role: Submitter, Tenant: defaultTenant})
+	}, manager.submitJob)
+	tests := []struct {
+		name string
+		body string
+		code int
+		want string
+	}{
+		{
+			"numeric date",
+			`{"Type": "Export", "Args": {"from_date": 20210101, "to_date": "2021-Jan-05", "table": "events"}}`,
+			http.StatusBadRequest,
+			`{"jobID":"","error":"Invalid args","fields":[{"field":"args.from_date","error":"Invalid type. Expected: string, given: integer"}]}`,
+		},
+		{
+			"missing date and wrong format",
+			`{"Type": "Export", "Args": {"from_date": "2021-01-01", "table": "events"}}`,
+			http.StatusBadRequest,
+			`{"jobID":"","error":"Invalid args","fields":[{"field":"args.to_date","error":"to_date is required"},{"field":"args.from_date","error":"Does not match format 'day'"}]}`,
+		},
+		{
+			"no export source",
+			`{"Type": "Export", "Args": {"from_date": "2021-Jan-01", "to_date": "2021-Jan-05", "table": "responses"}}`,
+			http.StatusBadRequest,
+			`{"jobID":"","error":"Invalid args","fields":[{"field":"args.table","error":"No export source configured for the tenant default"}]}`,
+		},
+		{
+			"unknown arg",
+			`{"Type": "Simple", "Args": {"msg": "hi"}}`,
+			http.StatusBadRequest,
+			`{"jobID":"","error":"Invalid args","fields":[{"field":"args.msg","error":"Additional property msg is not allowed"}]}`,
+		},
+		{
+			"unknown type",
+			`{"Type": "Report"}`,
+			http.StatusBadRequest,
+			`{"jobID":"","error":"Invalid Job Type, expected one of: Export, Simple"}`,
+		},
+		{
+			"no args",
+			`{"Type": "Simple"}`,
+			http.StatusOK,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader(test.body)))
+			if w.Code != test.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.code, w.Body.String())
+			}
+			if test.want != "" && w.Body.String() != test.want {
+				t.Errorf("response = %s, want %s", w.Body.String(), test.want)
+			}
+		})
+	}
+}
+
+// TestTenantScoping checks that the jobs of a tenant are hidden
+// from the other tenants, whatever their role
+func TestTenantScoping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStore()
+	manager := newTestManager(t, store, 0)
+	webhooks, err := newWebhookDispatcher(store, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(webhooks.stop)
+	server := httptest.NewServer(initRouter(manager, &scheduleRunner{store: store, manager: manager}, webhooks, &authenticator{store: store}))
+	defer server.Close()
+
+	// Alice submits to acme, the operator of beta sees the jobs of beta only
+	secrets := make(map[string]string)
+	jobIDs := make(map[string]string)
+	for _, user := range []struct{ owner, role, tenant string }{{"alice", Submitter, "acme"}, {"olga", Operator, "beta"}} {
+		key, secret, err := newAPIKey(&APIKeyRequest{Owner: user.owner, Role: user.role}, user.tenant)
+		if err == nil {
+			err = store.saveAPIKey(key)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[user.tenant] = secret
+		record := newJobRecord(uuid.New(), &JobRequest{Type: simple.Name}, user.owner, user.tenant)
+		record.Checkpoint = map[string]interface{}{"artifacts": []jobs.Artifact{{Name: "export.csv"}}}
+		job, err := buildSubmittedJob(record, manager.checkpointer(record.JobID), manager.logs.logger(record.JobID, record.Type))
+		if err == nil {
+			err = manager.queueJob(record, job)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobIDs[user.tenant] = record.JobID.String()
+	}
+	request := func(method string, path string, tenant string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.Header.Set("X-API-Key", secrets[tenant])
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/details/"},
+		{http.MethodGet, "/jobs/{job}/logs"},
+		{http.MethodGet, "/jobs/{job}/artifacts/export.csv"},
+		{http.MethodGet, "/jobs/{job}/deliveries"},
+		{http.MethodGet, "/events/"},
+		{http.MethodGet, "/halt/"},
+		{http.MethodGet, "/stop/"},
+		{http.MethodGet, "/resume/"},
+		{http.MethodPost, "/priority/"},
+	}
+	for _, route := range routes {
+		for tenant, other := range map[string]string{"acme": "beta", "beta": "acme"} {
+			path := route.path + jobIDs[other]
+			if strings.Contains(route.path, "{job}") {
+				path = strings.Replace(route.path, "{job}", jobIDs[other], 1)
+			}
+			res := request(route.method, path, tenant)
+			res.Body.Close()
+			if res.StatusCode != http.StatusNotFound {
+				t.Errorf("%s %s of %s by %s = %d, want %d", route.method, route.path, other, tenant, res.StatusCode, http.StatusNotFound)
+			}
+		}
+	}
+
+	for tenant, jobID := range jobIDs {
+		var list jobsResponse
+		res := request(http.MethodGet, "/jobs", tenant)
+		json.NewDecoder(res.Body).Decode(&list)
+		res.Body.Close()
+		if len(list.Jobs) != 1 || list.Jobs[0]["jobID"] != jobID {
+			t.Errorf("jobs listed for %s = %v, want only %s", tenant, list.Jobs, jobID)
+		}
+		var stats QueueStats
+		res = request(http.MethodGet, "/queue", tenant)
+		json.NewDecoder(res.Body).Decode(&stats)
+		res.Body.Close()
+		if stats.Tenant != tenant || stats.TenantQueued != 1 || len(stats.Queue) != 1 || stats.Queue[0].String() != jobID {
+			t.Errorf("queue of %s = %+v, want only %s", tenant, stats, jobID)
+		}
+	}
+
+	header := http.Header{"X-API-Key": {secrets["acme"]}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, message := range []ControlMessage{
+		{ID: "1", Op: "subscribe", JobIDs: []string{jobIDs["acme"], jobIDs["beta"]}},
+		{ID: "2", Op: string(stop), JobID: jobIDs["beta"]},
+	} {
+		if err = conn.WriteJSON(message); err != nil {
+			t.Fatal(err)
+		}
+		frame := readFrame(t, conn)
+		if frame.Type != ErrorFrame || frame.Error != "Invalid JobID" || frame.ID != message.ID {
+			t.Errorf("%s of the job of beta by acme = %+v, want the Invalid JobID error", message.Op, frame)
+		}
+	}
+	if record, err := store.get(uuid.MustParse(jobIDs["beta"])); err != nil || record.Status != Queued {
+		t.Errorf("job of beta %s once stopped by acme, want %s", record.Status, Queued)
+	}
+}
+
+// TestDownloadArtifact checks the download of an artifact of a completed
+// export, whole or by range, and its attachment file name
+func TestDownloadArtifact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(store jobs.ArtifactStore) { artifactStore = store }(artifactStore)
+	artifactStore = newLocalArtifactStore(dir)
+
+	store := newMemoryStore()
+	manager := newTestManager(t, store, 0)
+	record := newJobRecord(uuid.New(), &JobRequest{Type: export.Name, Args: map[string]interface{}{
+		"from_date": "2021-Jan-01", "to_date": "2021-Jan-03", "table": "responses",
+	}}, "alice", "acme")
+	name := `responses "q1"; final.csv`
+	artifact, err := artifactStore.Put(record.JobID, name, "text/csv", strings.NewReader("id\n1\n2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Status = Completed
+	record.Checkpoint = map[string]interface{}{"artifacts": []jobs.Artifact{*artifact}}
+	if err = store.save(record); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/jobs/:jobID/artifacts/:name", func(c *gin.Context) {
+		c.Set(principalKey, &Principal{Role: Viewer, Tenant: "acme"})
+	}, manager.downloadArtifact)
+
+	tests := []struct {
+		name   string
+		ranges string // Range header, none if empty
+		code   int
+		body   string
+		header map[string]string
+	}{
+		{"whole", "", http.StatusOK, "id\n1\n2\n", map[string]string{"ETag": `"` + artifact.Checksum + `"`, "Content-Type": "text/csv"}},
+		{"range", "bytes=3-4", http.StatusPartialContent, "1\n", map[string]string{"Content-Range": "bytes 3-4/7"}},
+		{"suffix", "bytes=-2", http.StatusPartialContent, "2\n", map[string]string{"Content-Range": "bytes 5-6/7"}},
+		{"unsatisfiable", "bytes=7-", http.StatusRequestedRangeNotSatisfiable, "", map[string]string{"Content-Range": "bytes */7"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+record.JobID.String()+"/artifacts/"+url.PathEscape(name), nil)
+			if test.ranges != "" {
+				req.Header.Set("Range", test.ranges)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != test.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.code, w.Body.String())
+			}
+			if test.code != http.StatusRequestedRangeNotSatisfiable && w.Body.String() != test.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), test.body)
+			}
+			for key, value := range test.header {
+				if got := w.Header().Get(key); got != value {
+					t.Errorf("%s = %q, want %q", key, got, value)
+				}
+			}
+			if test.code == http.StatusRequestedRangeNotSatisfiable {
+				return
+			}
+			disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+			if err != nil || disposition != "attachment" || params["filename"] != name {
+				t.Errorf("Content-Disposition = %q, want an attachment named %q: %v", w.Header().Get("Content-Disposition"), name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// JobManager manages the list of submitted jobs
+// It has methods to handle different actions called on these jobs.
+type JobManager struct {
+	store     JobStore
+	scheduler *scheduler
+	events    *eventBus // Status and progress changes of the jobs
+	webhooks  *webhookDispatcher
+	logs      *jobLogs
+	traces    trace.TracerProvider // Provider of the tracers of the requests and of the jobs
+	tracer    trace.Tracer
+
+	mu   sync.RWMutex
+	jobs map[uuid.UUID]*jobActor // Live jobs built from the records in store
+
+	admission sync.Mutex // Serializes the quota checks along with the queuing of the jobs
+}
+
+func newJobManager(store JobStore, logs *jobLogs, webhooks *webhookDispatcher, traces trace.TracerProvider, workers int, typeLimits map[string]int, quotas *tenantQuotas, share *fairShare, aging time.Duration) *JobManager {
+	manager := &JobManager{
+		store:    store,
+		events:   newEventBus(),
+		webhooks: webhooks,
+		logs:     logs,
+		traces:   traces,
+		tracer:   traces.Tracer(serviceName),
+		jobs:     make(map[uuid.UUID]*jobActor),
+	}
+	manager.scheduler = newScheduler(workers, typeLimits, quotas, share, aging, func(jobID uuid.UUID) error {
+		return manager.perform(jobID, start)
+	})
+	return manager
+}
+
+// loadJobs builds the jobs for the records persisted in the store.
+// Jobs which were running when the process exited are queued again to
+// continue from their last checkpoint, jobs saved before they could be
+// queued are queued, halted jobs are loaded as halted and jobs in a
+// terminal status are only kept in the store
+func (manager *JobManager) loadJobs() error {
+	records, err := manager.store.list()
+	if err != nil {
+		return err
+	}
+	// Queued jobs are queued again in their submission order
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].SubmittedAt.Before(records[j].SubmittedAt)
+	})
+	for _, record := range records {
+		if isTerminal(record.Status) {
+			continue
+		}
+		interrupted := record.Status == Running
+		if interrupted {
+			// Job was interrupted, it is resumed once loaded
+			record.setStatus(Halted)
+			if err = manager.store.save(record); err != nil {
+				return err
+			}
+		}
+		job, err := buildJob(record, manager.checkpointer(record.JobID), manager.logs.logger(record.JobID, record.Type))
+		if err != nil {
+			log.Printf("Failed to load the job: %s\nError: %s", record.JobID.String(), err.Error())
+			continue
+		}
+		actor := manager.addJob(record, job)
+		if record.Status == Submitted {
+			// Process exited between saving the job and queuing it
+			if err = actor.perform(queue); err != nil {
+				log.Printf("Failed to queue the job: %s\nError: %s", record.JobID.String(), err.Error())
+				continue
+			}
+			log.Println("Queued submitted job:", record.JobID.String())
+		}
+		if interrupted {
+			if err = actor.perform(resume); err != nil {
+				log.Printf("Failed to resume the job: %s\nError: %s", record.JobID.String(), err.Error())
+				continue
+			}
+			log.Println("Queued interrupted job:", record.JobID.String())
+		}
+	}
+	return nil
+}
+
+// submit builds the job of a new record and queues it,
+// unless its tenant reached its quota of queued jobs.
+// The job starts a new trace as no request submitted it
+func (manager *JobManager) submit(record *JobRecord) error {
+	span := manager.startSubmitSpan(context.Background(), record)
+	defer span.End()
+	job, err := buildSubmittedJob(record, manager.checkpointer(record.JobID), manager.logs.logger(record.JobID, record.Type))
+	if err == nil {
+		err = manager.queueJob(record, job)
+	}
+	if err != nil {
+		failSpan(span, err)
+	}
+	return err
+}
+
+// startSubmitSpan starts the span submitting the job of the record,
+// the spans of the job are its children
+func (manager *JobManager) startSubmitSpan(ctx context.Context, record *JobRecord) trace.Span {
+	ctx, span := manager.tracer.Start(ctx, "job.submit", trace.WithAttributes(
+		attribute.String("job.id", record.JobID.String()),
+		attribute.String("job.type", record.Type),
+		attribute.String("job.tenant", tenantOf(record.Tenant)),
+	))
+	record.TraceParent = traceparentOf(ctx)
+	return span
+}
+
+// queueJob saves the record of a new job and queues the job, unless its
+// tenant reached its quota of queued jobs in which case a quotaError is
+// returned and nothing is saved
+func (manager *JobManager) queueJob(record *JobRecord, job jobs.Job) error {
+	manager.admission.Lock()
+	defer manager.admission.Unlock()
+	if err := manager.scheduler.admit(tenantOf(record.Tenant)); err != nil {
+		return err
+	}
+	if err := manager.store.save(record); err != nil {
+		return err
+	}
+	actor := manager.addJob(record, job)
+	if err := actor.perform(queue); err != nil {
+		actor.perform(stop)
+		return err
+	}
+	metrics.submitted.WithLabelValues(record.Type).Inc()
+	return nil
+}
+
+// addJob starts the actor owning the job and adds it to the live jobs
+func (manager *JobManager) addJob(record *JobRecord, job jobs.Job) *jobActor {
+	actor := newJobActor(job, record, manager.tracer, manager.logs.logger(record.JobID, record.Type), manager.statusSaver(record), manager.progressPublisher(record.JobID, tenantOf(record.Tenant)))
+	manager.mu.Lock()
+	manager.jobs[record.JobID] = actor
+	manager.mu.Unlock()
+	metrics.track(record.JobID, record.Type, record.Status)
+	queued := queuedJob{jobID: record.JobID, jobType: record.Type, tenant: tenantOf(record.Tenant), priority: record.Priority}
+	if len(record.Attempts) > 0 && record.Attempts[len(record.Attempts)-1].RetryAt != nil {
+		queued.notBefore = *record.Attempts[len(record.Attempts)-1].RetryAt
+	}
+	manager.scheduler.update(queued, record.Status)
+	// Run the actor once the scheduler knows the job, as the job
+	// can time out and change its status right away
+	actor.run()
+	return actor
+}
+
+func (manager *JobManager) getJob(jobID uuid.UUID) (*jobActor, bool) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	actor, ok := manager.jobs[jobID]
+	return actor, ok
+}
+
+func (manager *JobManager) removeJob(jobID uuid.UUID) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	delete(manager.jobs, jobID)
+}
+
+// perform executes the action on the job.
+// Jobs in a terminal status have no actor, the action is
+// only checked against the state machine for them
+func (manager *JobManager) perform(jobID uuid.UUID, action Action) error {
+	actor, ok := manager.getJob(jobID)
+	if ok {
+		return actor.perform(action)
+	}
+	return manager.unloaded(jobID, action)
+}
+
+// admitResume resumes the halted job of the tenant,
+// unless the tenant reached its quota of queued jobs
+func (manager *JobManager) admitResume(jobID uuid.UUID, tenant string) error {
+	actor, ok := manager.getJob(jobID)
+	if !ok {
+		return manager.unloaded(jobID, resume)
+	}
+	manager.admission.Lock()
+	defer manager.admission.Unlock()
+	if err := actor.exec(func(status string) error {
+		// Only halted jobs are queued by a resume
+		if status != Halted {
+			return nil
+		}
+		return manager.scheduler.admit(tenant)
+	}); err != nil {
+		return err
+	}
+	return actor.perform(resume)
+}
+
+// unloaded checks the action against the state machine for a job
+// without actor, the action fails as the job is not loaded
+func (manager *JobManager) unloaded(jobID uuid.UUID, action Action) error {
+	record, err := manager.store.get(jobID)
+	if err != nil {
+		return err
+	}
+	if _, err = nextStatus(record.Status, action); err != nil {
+		return err
+	}
+	return errors.New("Failed to " + string(action) + " the Job : Job is not loaded")
+}
+
+// reprioritize changes the priority of a queued or halted job.
+// It runs on the actor of the job so the job can't be queued
+// or started while its priority changes
+func (manager *JobManager) reprioritize(jobID uuid.UUID, priority int) error {
+	actor, ok := manager.getJob(jobID)
+	if !ok {
+		record, err := manager.store.get(jobID)
+		if err != nil {
+			return err
+		}
+		return errors.New("Failed to change the priority of the Job : Job is " + strings.ToLower(record.Status))
+	}
+	return actor.exec(func(status string) error {
+		if status != Queued && status != Halted {
+			return errors.New("Failed to change the priority of the Job : Job is " + strings.ToLower(status))
+		}
+		err := manager.store.update(jobID, func(record *JobRecord) error {
+			record.Priority = priority
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		manager.scheduler.reprioritize(jobID, priority)
+		return nil
+	})
+}
+
+// jobDetails returns the details of the job of the record, those
+// of a job which isn't live are read from its record and checkpoint
+func (manager *JobManager) jobDetails(record *JobRecord) (map[string]interface{}, error) {
+	var details map[string]interface{}
+	if actor, ok := manager.getJob(record.JobID); ok {
+		details = actor.fetchDetails()
+	} else {
+		details = storedDetails(record)
+	}
+	details["type"] = record.Type
+	details["submitted_at"] = record.SubmittedAt
+	details["priority"] = record.Priority
+	if record.Owner != "" {
+		details["owner"] = record.Owner
+	}
+	details["tenant"] = tenantOf(record.Tenant)
+	if position := manager.scheduler.position(record.JobID); position > 0 {
+		details["queue_position"] = position
+	}
+	if len(record.Labels) > 0 {
+		details["labels"] = record.Labels
+	}
+	if sc := trace.SpanContextFromContext(contextWithTraceparent(context.Background(), record.TraceParent)); sc.IsValid() {
+		details["trace_id"] = sc.TraceID().String()
+	}
+	if record.Timeout != "" {
+		details["timeout"] = record.Timeout
+	}
+	if record.Deadline != nil {
+		details["deadline"] = record.Deadline
+	}
+	if record.StartedAt != nil {
+		details["started_at"] = record.StartedAt
+	}
+	if record.Error != "" {
+		details["error"] = record.Error
+	}
+	if record.CleanError != "" {
+		details["clean_error"] = record.CleanError
+	}
+	if len(record.Attempts) > 0 {
+		details["attempts"] = record.Attempts
+	}
+	return details, nil
+}
+
+// statusSaver returns the function used by the actor of a job
+// to persist every status change in the job record and pass it to the scheduler.
+// Jobs reaching a terminal status are removed from the live jobs
+func (manager *JobManager) statusSaver(record *JobRecord) func(change statusChange) {
+	jobID, jobType, tenant := record.JobID, record.Type, tenantOf(record.Tenant)
+	return func(change statusChange) {
+		queued := queuedJob{jobID: jobID, jobType: jobType, tenant: tenant, notBefore: change.retryAt}
+		var deliveries []Delivery
+		var startedAt *time.Time
+		err := manager.store.update(jobID, func(record *JobRecord) error {
+			queued.priority = record.Priority
+			from := record.Status
+			record.setStatus(change.status)
+			record.Progress = &change.progress
+			// Deliveries are saved along with the transition so that none is lost
+			deliveries = manager.webhooks.deliveries(record, from, change)
+			record.addDeliveries(deliveries)
+			if change.status == Running && record.StartedAt == nil {
+				startedAt := time.Now()
+				record.StartedAt = &startedAt
+			}
+			if change.err != nil && change.status != TimedOut {
+				attempt := Attempt{
+					Number: len(record.Attempts) + 1,
+					At:     time.Now(),
+					Error:  change.err.Error(),
+					Class:  jobs.ErrorClass(change.err),
+				}
+				if !change.retryAt.IsZero() {
+					attempt.RetryAt = &change.retryAt
+				}
+				record.Attempts = append(record.Attempts, attempt)
+			}
+			if change.status == Failed || change.status == TimedOut {
+				record.Error = change.err.Error()
+			}
+			if change.cleanErr != nil {
+				record.CleanError = change.cleanErr.Error()
+			}
+			startedAt = record.StartedAt
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to save the job: %s\nError: %s", jobID.String(), err.Error())
+		} else {
+			manager.webhooks.enqueue(jobID, deliveries)
+		}
+		if isTerminal(change.status) {
+			manager.removeJob(jobID)
+			manager.logs.end(jobID)
+		}
+		manager.scheduler.update(queued, change.status)
+		metrics.transition(jobID, jobType, change, startedAt)
+		event := Event{
+			Type:     StatusEvent,
+			JobID:    jobID,
+			Status:   change.status,
+			Progress: &change.progress,
+			Tenant:   tenant,
+		}
+		if change.err != nil {
+			event.Error = change.err.Error()
+		}
+		manager.events.publish(event)
+	}
+}
+
+// progressPublisher returns the function used by the actor
+// of a job to publish its progress on the event bus
+func (manager *JobManager) progressPublisher(jobID uuid.UUID, tenant string) func(progress Progress) {
+	return func(progress Progress) {
+		manager.events.publish(Event{
+			Type:     ProgressEvent,
+			JobID:    jobID,
+			Status:   Running,
+			Progress: &progress,
+			Tenant:   tenant,
+		})
+	}
+}
+
+// checkpointer returns the function used by a job to persist its checkpoint
+func (manager *JobManager) checkpointer(jobID uuid.UUID) jobs.Checkpointer {
+	return func(state map[string]interface{}) error {
+		return manager.store.update(jobID, func(record *JobRecord) error {
+			record.Checkpoint = state
+			return nil
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestManager returns a manager of jobs kept in memory,
+// no job is started unless workers is positive
+func newTestManager(t *testing.T, store Store, workers int) *JobManager {
+	return newTracedManager(t, store, workers, trace.NewNoopTracerProvider())
+}
+
+// newTracedManager returns a manager of jobs kept in memory
+// whose requests and jobs are traced by the provider
+func newTracedManager(t *testing.T, store Store, workers int, traces trace.TracerProvider) *JobManager {
+	webhooks, err := newWebhookDispatcher(store, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(webhooks.stop)
+	return newJobManager(store, newJobLogs(store, false), webhooks, traces, workers, map[string]int{}, &tenantQuotas{tenants: map[string]TenantQuota{}}, &fairShare{}, 0)
+}
+
+// TestLoadJobs checks the status of the jobs loaded from the store after a restart
+func TestLoadJobs(t *testing.T) {
+	tests := []struct {
+		status string
+		loaded string // Status once loaded, empty if the job isn't live
+	}{
+		{Submitted, Queued},
+		{Queued, Queued},
+		{Running, Queued},
+		{Halted, Halted},
+		{Completed, ""},
+		{Stopped, ""},
+	}
+	store := newMemoryStore()
+	jobIDs := make([]uuid.UUID, len(tests))
+	for i, test := range tests {
+		record := &JobRecord{
+			JobID:       uuid.New(),
+			Type:        simple.Name,
+			Args:        map[string]interface{}{"message": "Doing Job"},
+			Status:      test.status,
+			SubmittedAt: time.Now().Add(time.Duration(i) * time.Second),
+		}
+		if err := store.save(record); err != nil {
+			t.Fatal(err)
+		}
+		jobIDs[i] = record.JobID
+	}
+	manager := newTestManager(t, store, 0)
+	if err := manager.loadJobs(); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		jobID := jobIDs[i]
+		actor, live := manager.getJob(jobID)
+		if live != (test.loaded != "") {
+			t.Errorf("job %s is live %v, want %v", jobID, live, test.loaded != "")
+			continue
+		}
+		if !live {
+			continue
+		}
+		if status := actor.fetchDetails()["status"]; status != test.loaded {
+			t.Errorf("job %s loaded as %v, want %s", jobID, status, test.loaded)
+		}
+		if record, err := manager.store.get(jobID); err != nil || record.Status != test.loaded {
+			t.Errorf("record of job %s saved as %s, want %s", jobID, record.Status, test.loaded)
+		}
+	}
+}
+
+// waitIdle waits for the scheduler to have no queued nor running job
+// and returns false if it didn't happen within 5 seconds
+func waitIdle(manager *JobManager) bool {
+	idle := func() bool {
+		manager.scheduler.mu.Lock()
+		defer manager.scheduler.mu.Unlock()
+		return len(manager.scheduler.queue) == 0 && len(manager.scheduler.running) == 0
+	}
+	for end := time.Now().Add(5 * time.Second); !idle() && time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+	}
+	return idle()
+}
+
+// startFailJob is a job which fails to start
+type startFailJob struct {
+	slowJob
+}
+
+func (job *startFailJob) Start() error {
+	return errors.New("Failed to open the source")
+}
+
+// TestStartFailure checks that a job which fails to start once dispatched
+// is failed, instead of being left queued without a place in the queue
+func TestStartFailure(t *testing.T) {
+	store := newMemoryStore()
+	manager := newTestManager(t, store, 1)
+	record := newJobRecord(uuid.New(), &JobRequest{Type: simple.Name}, "alice", defaultTenant)
+	if err := manager.queueJob(record, &startFailJob{}); err != nil {
+		t.Fatal(err)
+	}
+	// The job leaves the scheduler once its failure is saved
+	if !waitIdle(manager) {
+		t.Fatal("job left in the scheduler once it failed to start")
+	}
+	if _, live := manager.getJob(record.JobID); live {
+		t.Error("failed job is still live")
+	}
+	saved, err := store.get(record.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != Failed || saved.Error != "Failed to open the source" || len(saved.Attempts) != 1 {
+		t.Errorf("job saved as %s with error %q and %d attempts, want %s with the start error", saved.Status, saved.Error, len(saved.Attempts), Failed)
+	}
+}
+
+// stopJob is a job which records that it was stopped
+type stopJob struct {
+	slowJob
+	stopped chan struct{}
+}
+
+func (job *stopJob) Stop() error {
+	close(job.stopped)
+	return nil
+}
+
+// TestJobExpiry checks that a job running past its timeout, or reaching its
+// deadline while queued or halted, is stopped and saved as timed out,
+// and that it leaves the live jobs and the scheduler
+func TestJobExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  string
+		deadline time.Duration // From the submission, no deadline if 0
+		workers  int
+		halt     bool // Halt the job once running
+		started  bool
+		err      string
+	}{
+		{"timeout while running", "200ms", 0, 1, false, true, "Job exceeded its timeout"},
+		{"deadline while queued", "", 200 * time.Millisecond, 0, false, false, "Job exceeded its deadline"},
+		{"deadline while halted", "", 500 * time.Millisecond, 1, true, true, "Job exceeded its deadline"},
+		{"timeout before the deadline", "200ms", time.Hour, 1, false, true, "Job exceeded its timeout"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMemoryStore()
+			manager := newTestManager(t, store, test.workers)
+			request := &JobRequest{Type: simple.Name, Timeout: test.timeout}
+			if test.deadline > 0 {
+				deadline := time.Now().Add(test.deadline)
+				request.Deadline = &deadline
+			}
+			record := newJobRecord(uuid.New(), request, "alice", defaultTenant)
+			job := &stopJob{slowJob: slowJob{stepTime: time.Minute, started: make(chan struct{}, 1)}, stopped: make(chan struct{})}
+			if err := manager.queueJob(record, job); err != nil {
+				t.Fatal(err)
+			}
+			if test.halt {
+				select {
+				case <-job.started:
+				case <-time.After(5 * time.Second):
+					t.Fatal("job not started")
+				}
+				if err := manager.perform(record.JobID, halt); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			select {
+			case <-job.stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("job not stopped once expired")
+			}
+			var saved *JobRecord
+			for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+				var err error
+				if saved, err = store.get(record.JobID); err != nil {
+					t.Fatal(err)
+				}
+				if isTerminal(saved.Status) {
+					break
+				}
+			}
+			if saved.Status != TimedOut || saved.Error != test.err {
+				t.Fatalf("job saved as %s with error %q, want %s with %q", saved.Status, saved.Error, TimedOut, test.err)
+			}
+			if (saved.StartedAt != nil) != test.started || len(saved.Attempts) != 0 {
+				t.Errorf("job started at %v with %d attempts, want started = %v and no attempt", saved.StartedAt, len(saved.Attempts), test.started)
+			}
+			if !waitIdle(manager) {
+				t.Error("timed out job left in the scheduler")
+			}
+			if _, live := manager.getJob(record.JobID); live {
+				t.Error("timed out job is still live")
+			}
+		})
+	}
+}
+
+// failJob is a job whose every step fails with its error
+type failJob struct {
+	slowJob
+	err error
+}
+
+func (job *failJob) Step(ctx context.Context) (bool, error) {
+	job.steps++
+	return false, job.err
+}
+
+// TestJobRetry checks that a failed job is queued again until its retry
+// policy is used up, with its attempts saved in its record, and that
+// the errors of a class which isn't retried fail the job at once
+func TestJobRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int // Attempts until the job fails
+	}{
+		{"transient", jobs.Transient(errors.New("Source unreachable")), 3},
+		{"wrapped transient", fmt.Errorf("Failed to export 2021-Jan-02: %w", jobs.Transient(errors.New("Source unreachable"))), 3},
+		{"permanent", errors.New("No such table"), 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMemoryStore()
+			manager := newTestManager(t, store, 1)
+			record := newJobRecord(uuid.New(), &JobRequest{Type: simple.Name, Retry: &RetryPolicy{
+				MaxAttempts: 3, Backoff: "200ms", RetryOn: []string{jobs.TransientError},
+			}}, "alice", defaultTenant)
+			if err := manager.queueJob(record, &failJob{err: test.err}); err != nil {
+				t.Fatal(err)
+			}
+
+			var saved *JobRecord
+			retried := false
+			for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+				var err error
+				if saved, err = store.get(record.JobID); err != nil {
+					t.Fatal(err)
+				}
+				if isTerminal(saved.Status) {
+					break
+				}
+				// The attempt is saved along with the transition back to the queue
+				if len(saved.Attempts) == 1 && !retried {
+					retried = true
+					attempt := saved.Attempts[0]
+					if saved.Status != Queued || attempt.Number != 1 || attempt.Class != jobs.TransientError || attempt.RetryAt == nil || !attempt.RetryAt.After(attempt.At) {
+						t.Errorf("job saved as %s with the attempt %+v, want it queued until its retry", saved.Status, attempt)
+					}
+				}
+			}
+			if saved.Status != Failed || saved.Error != test.err.Error() {
+				t.Fatalf("job saved as %s with error %q, want %s with %q", saved.Status, saved.Error, Failed, test.err)
+			}
+			if retried != (test.attempts > 1) {
+				t.Errorf("job queued again = %v, want %v", retried, test.attempts > 1)
+			}
+			if len(saved.Attempts) != test.attempts {
+				t.Fatalf("%d attempts saved, want %d", len(saved.Attempts), test.attempts)
+			}
+			for i, attempt := range saved.Attempts {
+				last := i == len(saved.Attempts)-1
+				if attempt.Number != i+1 || attempt.Error != test.err.Error() || (attempt.RetryAt == nil) != last {
+					t.Errorf("attempt %d = %+v, want a retry unless it is the last one", i+1, attempt)
+				}
+				if i > 0 && attempt.At.Before(*saved.Attempts[i-1].RetryAt) {
+					t.Errorf("attempt %d at %s, before its retry at %s", i+1, attempt.At, saved.Attempts[i-1].RetryAt)
+				}
+			}
+			if !waitIdle(manager) {
+				t.Error("failed job left in the scheduler")
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+// Upper bounds of the histogram buckets, in seconds
+var (
+	jobBuckets     = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 10800, 21600, 86400}
+	waitBuckets    = []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 3600, 10800}
+	dayBuckets     = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+	requestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// trackedJob is the status of a live job, used for the job gauges
+type trackedJob struct {
+	jobType  string
+	status   string
+	queuedAt time.Time
+}
+
+// jobMetrics are the metrics of the jobs and of the HTTP API, kept in their
+// own registry. The job gauges are collected from the live jobs on every scrape
+type jobMetrics struct {
+	registry     *prometheus.Registry
+	submitted    *prometheus.CounterVec
+	transitions  *prometheus.CounterVec
+	failures     *prometheus.CounterVec
+	jobs         *prometheus.Desc
+	duration     *prometheus.HistogramVec
+	queueWait    *prometheus.HistogramVec
+	exportDay    *prometheus.HistogramVec
+	requests     *prometheus.CounterVec
+	requestTimes *prometheus.HistogramVec
+	handler      http.Handler
+
+	mu      sync.Mutex
+	tracked map[uuid.UUID]*trackedJob // Live jobs
+}
+
+// metrics are the metrics of the process, exposed on /metrics
+var metrics = newJobMetrics()
+
+func newJobMetrics() *jobMetrics {
+	m := &jobMetrics{
+		registry: prometheus.NewRegistry(),
+		submitted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jobmanager_jobs_submitted_total",
+			Help: "Number of jobs submitted, including the jobs created by the schedules.",
+		}, []string{"type"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jobmanager_job_transitions_total",
+			Help: "Number of transitions of the jobs by status reached.",
+		}, []string{"type", "status"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jobmanager_job_failures_total",
+			Help: "Number of failed attempts of the jobs, including the retried ones, by error class.",
+		}, []string{"type", "class"}),
+		jobs: prometheus.NewDesc("jobmanager_jobs", "Number of queued, running and halted jobs.", []string{"type", "status"}, nil),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jobmanager_job_duration_seconds",
+			Help:    "Time from the first start of the jobs to their end, by final status.",
+			Buckets: jobBuckets,
+		}, []string{"type", "status"}),
+		queueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jobmanager_job_queue_wait_seconds",
+			Help:    "Time the jobs waited in the queue before being started.",
+			Buckets: waitBuckets,
+		}, []string{"type"}),
+		exportDay: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jobmanager_export_day_duration_seconds",
+			Help:    "Time to export a day of rows by the export jobs.",
+			Buckets: dayBuckets,
+		}, []string{"format"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jobmanager_http_requests_total",
+			Help: "Number of HTTP requests by route and status code.",
+		}, []string{"method", "route", "code"}),
+		requestTimes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jobmanager_http_request_duration_seconds",
+			Help:    "Time to answer the HTTP requests by route.",
+			Buckets: requestBuckets,
+		}, []string{"method", "route"}),
+		tracked: make(map[uuid.UUID]*trackedJob),
+	}
+	m.registry.MustRegister(m.submitted, m.transitions, m.failures, m, m.duration,
+		m.queueWait, m.exportDay, m.requests, m.requestTimes)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// Describe describes the job gauges, collected by Collect
+func (m *jobMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.jobs
+}
+
+// Collect counts the live jobs by type and status for the job gauges
+func (m *jobMetrics) Collect(ch chan<- prometheus.Metric) {
+	type key struct{ jobType, status string }
+	counts := make(map[key]float64)
+	m.mu.Lock()
+	for _, job := range m.tracked {
+		if job.status == Queued || job.status == Running || job.status == Halted {
+			counts[key{job.jobType, job.status}]++
+		}
+	}
+	m.mu.Unlock()
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(m.jobs, prometheus.GaugeValue, count, k.jobType, k.status)
+	}
+}
+
+// track starts tracking a live job in its current status
+func (m *jobMetrics) track(jobID uuid.UUID, jobType string, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tracked[jobID] = &trackedJob{jobType: jobType, status: status, queuedAt: time.Now()}
+}
+
+// transition records the status change of a job. The job duration
+// is measured from startedAt, the first start of the job if not nil
+func (m *jobMetrics) transition(jobID uuid.UUID, jobType string, change statusChange, startedAt *time.Time) {
+	m.transitions.WithLabelValues(jobType, change.status).Inc()
+	if change.err != nil {
+		class := jobs.ErrorClass(change.err)
+		if change.status == TimedOut {
+			class = "timeout"
+		}
+		m.failures.WithLabelValues(jobType, class).Inc()
+	}
+	if isTerminal(change.status) && startedAt != nil {
+		m.duration.WithLabelValues(jobType, change.status).Observe(time.Since(*startedAt).Seconds())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.tracked[jobID]
+	if !ok {
+		job = &trackedJob{jobType: jobType}
+		m.tracked[jobID] = job
+	}
+	switch {
+	case isTerminal(change.status):
+		delete(m.tracked, jobID)
+	case change.status == Queued:
+		job.queuedAt = time.Now()
+	case change.status == Running && job.status == Queued:
+		m.queueWait.WithLabelValues(jobType).Observe(time.Since(job.queuedAt).Seconds())
+	}
+	job.status = change.status
+}
+
+// instrument is the middleware counting and timing the requests by route
+func (m *jobMetrics) instrument(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	route := routeOf(c)
+	m.requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	m.requestTimes.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+}
+
+// routeOf returns the route template matched by the request, e.g. /details/:jobID,
+// or unmatched so that unknown paths don't create new series
+func routeOf(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// serveMetrics godoc
+// @Summary Fetch the metrics of the jobs and of the HTTP API in the Prometheus text format
+// @Description Job processing backend API for Atlan Collect
+// @ID metrics
+// @Produce  plain
+// @Success 200 {string} string "Metrics in the Prometheus text exposition format"
+// @Router /metrics [get]
+func (m *jobMetrics) serveMetrics(c *gin.Context) {
+	m.handler.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+func TestServeMetrics(t *testing.T) {
+	m := newJobMetrics()
+	queued, failed := uuid.New(), uuid.New()
+	m.submitted.WithLabelValues(simple.Name).Inc()
+	m.submitted.WithLabelValues(export.Name).Inc()
+	m.track(queued, simple.Name, Queued)
+	m.track(failed, export.Name, Queued)
+	m.transition(failed, export.Name, statusChange{status: Failed, err: jobs.Transient(errors.New("Database unreachable"))}, nil)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	m.serveMetrics(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %s", contentType)
+	}
+	want := `# HELP jobmanager_job_failures_total Number of failed attempts of the jobs, including the retried ones, by error class.
+# TYPE jobmanager_job_failures_total counter
+jobmanager_job_failures_total{class="transient",type="Export"} 1
+# HELP jobmanager_job_transitions_total Number of transitions of the jobs by status reached.
+# TYPE jobmanager_job_transitions_total counter
+jobmanager_job_transitions_total{status="Failed",type="Export"} 1
+# HELP jobmanager_jobs Number of queued, running and halted jobs.
+# TYPE jobmanager_jobs gauge
+jobmanager_jobs{status="Queued",type="Simple"} 1
+# HELP jobmanager_jobs_submitted_total Number of jobs submitted, including the jobs created by the schedules.
+# TYPE jobmanager_jobs_submitted_total counter
+jobmanager_jobs_submitted_total{type="Export"} 1
+jobmanager_jobs_submitted_total{type="Simple"} 1
+`
+	if w.Body.String() != want {
+		t.Errorf("metrics =\n%s\nwant\n%s", w.Body.String(), want)
+	}
+}
+
+// TestInstrumentRoutes checks that the requests are counted by the template
+// of their route, whatever the values of its params
+func TestInstrumentRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newJobMetrics()
+	r := gin.New()
+	r.Use(m.instrument)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/details/:jobID", ok)
+	r.GET("/jobs/:jobID/artifacts/:name", ok)
+	r.GET("/files/*path", ok)
+	// Values repeating a segment of the path were mislabeled when the route was rebuilt from the path
+	for _, path := range []string{"/details/1", "/details/details", "/jobs/artifacts/artifacts/jobs", "/files/a/b", "/files/", "/unknown", "/details/1/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	tests := []struct {
+		route string
+		code  string
+		count float64
+	}{
+		{"/details/:jobID", "200", 2},
+		{"/jobs/:jobID/artifacts/:name", "200", 1},
+		{"/files/*path", "200", 2},
+		{"unmatched", "404", 2},
+	}
+	for _, test := range tests {
+		if count := testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, test.route, test.code)); count != test.count {
+			t.Errorf("requests of %s = %v, want %v", test.route, count, test.count)
+		}
+	}
+	if series := testutil.CollectAndCount(m.requests); series != len(tests) {
+		t.Errorf("request series = %d, want %d", series, len(tests))
+	}
+}
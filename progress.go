@@ -0,0 +1,83 @@
+package main
+
+import (
+	"time"
+
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+// progressWindow is the period over which the throughput of a job is measured
+const progressWindow = time.Minute
+
+// Progress represents how far along a job is.
+// Done, Total and Current are reported by the job, Total is 0 if unknown.
+// The other fields are computed by its actor while the job is running
+type Progress struct {
+	Done       int        `json:"done" example:"12"`
+	Total      int        `json:"total,omitempty" example:"30"`
+	Current    string     `json:"current,omitempty" example:"2020-Jan-14"` // Item being processed
+	Percentage float64    `json:"percentage,omitempty" example:"40"`
+	Throughput float64    `json:"throughput" example:"0.98"` // Units done per second
+	ETA        *time.Time `json:"eta,omitempty"`             // Estimated completion time
+}
+
+// progressSample is the number of units done by a job at some time
+type progressSample struct {
+	at   time.Time
+	done int
+}
+
+// progressTracker measures the throughput of a job from the samples
+// of its progress taken after every step while it is running
+type progressTracker struct {
+	samples []progressSample
+}
+
+// reset drops the samples, the time the job wasn't running
+// must not count in its throughput
+func (tracker *progressTracker) reset() {
+	tracker.samples = tracker.samples[:0]
+}
+
+// observe records the progress of the job, dropping
+// the samples older than the progress window
+func (tracker *progressTracker) observe(now time.Time, done int) {
+	tracker.samples = append(tracker.samples, progressSample{now, done})
+	i := 0
+	for i < len(tracker.samples)-2 && now.Sub(tracker.samples[i].at) > progressWindow {
+		i++
+	}
+	tracker.samples = tracker.samples[i:]
+}
+
+// throughput returns the units done per second over the progress window
+func (tracker *progressTracker) throughput() float64 {
+	if len(tracker.samples) < 2 {
+		return 0
+	}
+	first, last := tracker.samples[0], tracker.samples[len(tracker.samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.done-first.done) / elapsed
+}
+
+// complete fills the computed fields of the progress reported by the job,
+// the throughput and ETA are only known while the job is running
+func (tracker *progressTracker) complete(reported jobs.Progress, running bool, now time.Time) Progress {
+	progress := Progress{Done: reported.Done, Total: reported.Total, Current: reported.Current}
+	if progress.Total > 0 {
+		progress.Percentage = float64(progress.Done) * 100 / float64(progress.Total)
+	}
+	if !running {
+		return progress
+	}
+	progress.Throughput = tracker.throughput()
+	if progress.Total > 0 && progress.Throughput > 0 {
+		remaining := float64(progress.Total-progress.Done) / progress.Throughput
+		eta := now.Add(time.Duration(remaining * float64(time.Second)))
+		progress.ETA = &eta
+	}
+	return progress
+}
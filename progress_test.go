@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+func TestProgressTracker(t *testing.T) {
+	start := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+	type sample struct {
+		at   int // Seconds after start
+		done int
+	}
+	tests := []struct {
+		name       string
+		samples    []sample
+		progress   jobs.Progress
+		running    bool
+		now        int
+		percentage float64
+		throughput float64
+		eta        int // Seconds after start, -1 if unknown
+	}{
+		{"no sample", nil, jobs.Progress{Done: 0, Total: 10}, true, 0, 0, 0, -1},
+		{"single sample", []sample{{0, 0}}, jobs.Progress{Done: 0, Total: 10}, true, 0, 0, 0, -1},
+		{"zero elapsed time", []sample{{5, 2}, {5, 4}}, jobs.Progress{Done: 4, Total: 10}, true, 5, 40, 0, -1},
+		{"steady", []sample{{0, 0}, {10, 5}, {20, 10}}, jobs.Progress{Done: 10, Total: 20}, true, 20, 50, 0.5, 40},
+		{"unknown total", []sample{{0, 0}, {10, 5}, {20, 10}}, jobs.Progress{Done: 10}, true, 20, 0, 0.5, -1},
+		{"no progress", []sample{{0, 3}, {10, 3}}, jobs.Progress{Done: 3, Total: 10}, true, 10, 30, 0, -1},
+		{"done", []sample{{0, 0}, {10, 10}}, jobs.Progress{Done: 10, Total: 10}, true, 10, 100, 1, 10},
+		{"halted", []sample{{0, 0}, {10, 5}}, jobs.Progress{Done: 5, Total: 10}, false, 10, 50, 0, -1},
+		{"old samples dropped", []sample{{0, 0}, {70, 0}, {100, 30}, {130, 60}}, jobs.Progress{Done: 60, Total: 120}, true, 130, 50, 1, 190},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tracker progressTracker
+			for _, s := range test.samples {
+				tracker.observe(start.Add(time.Duration(s.at)*time.Second), s.done)
+			}
+			progress := tracker.complete(test.progress, test.running, start.Add(time.Duration(test.now)*time.Second))
+			if progress.Percentage != test.percentage {
+				t.Errorf("percentage = %v, want %v", progress.Percentage, test.percentage)
+			}
+			if progress.Throughput != test.throughput {
+				t.Errorf("throughput = %v, want %v", progress.Throughput, test.throughput)
+			}
+			switch {
+			case test.eta < 0 && progress.ETA != nil:
+				t.Errorf("eta = %s, want none", progress.ETA)
+			case test.eta >= 0 && progress.ETA == nil:
+				t.Errorf("eta = none, want %d seconds after the start", test.eta)
+			case test.eta >= 0 && !progress.ETA.Equal(start.Add(time.Duration(test.eta)*time.Second)):
+				t.Errorf("eta = %s, want %d seconds after the start", progress.ETA, test.eta)
+			}
+		})
+	}
+}
+
+// TestProgressTrackerReset checks that the time a job
+// was halted doesn't count in its throughput once resumed
+func TestProgressTrackerReset(t *testing.T) {
+	start := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+	var tracker progressTracker
+	tracker.observe(start, 0)
+	tracker.observe(start.Add(10*time.Second), 10)
+	if throughput := tracker.throughput(); throughput != 1 {
+		t.Fatalf("throughput = %v, want 1", throughput)
+	}
+	// Halted for an hour then resumed
+	resumed := start.Add(time.Hour)
+	tracker.reset()
+	tracker.observe(resumed, 10)
+	if throughput := tracker.throughput(); throughput != 0 {
+		t.Errorf("throughput right after resuming = %v, want 0", throughput)
+	}
+	tracker.observe(resumed.Add(5*time.Second), 20)
+	if throughput := tracker.throughput(); throughput != 2 {
+		t.Errorf("throughput after resuming = %v, want 2", throughput)
+	}
+}
+
+// TestHaltedJobThroughput checks the throughput published by the actor of a job
+func TestHaltedJobThroughput(t *testing.T) {
+	job := &slowJob{stepTime: 10 * time.Millisecond, started: make(chan struct{}, 1)}
+	actor := newTestActor(t, job)
+	defer actor.perform(stop)
+	if err := actor.perform(start); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if progress := actor.fetchDetails()["progress"].(Progress); progress.Throughput <= 0 {
+		t.Errorf("throughput while running = %v, want more than 0", progress.Throughput)
+	}
+	if err := actor.perform(halt); err != nil {
+		t.Fatal(err)
+	}
+	if progress := actor.fetchDetails()["progress"].(Progress); progress.Throughput != 0 || progress.ETA != nil {
+		t.Errorf("progress once halted = %+v, want no throughput nor ETA", progress)
+	}
+}
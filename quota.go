@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// TenantQuota caps the jobs of a tenant, a zero maximum is unlimited
+// MaxRunning jobs of the tenant are processed at once, the others wait in the queue
+// MaxQueued jobs of the tenant can wait in the queue, submitting more is rejected
+type TenantQuota struct {
+	MaxRunning int `json:"max_running" example:"2"`
+	MaxQueued  int `json:"max_queued" example:"20"`
+}
+
+// tenantQuotas are the quotas of the tenants,
+// the tenants without their own quota share the default one
+type tenantQuotas struct {
+	defaults TenantQuota
+	tenants  map[string]TenantQuota
+}
+
+// of returns the quota of the tenant
+func (quotas *tenantQuotas) of(tenant string) TenantQuota {
+	if quota, ok := quotas.tenants[tenant]; ok {
+		return quota
+	}
+	return quotas.defaults
+}
+
+// quotaError is returned when a tenant reached its quota of queued jobs
+type quotaError struct {
+	tenant string
+	limit  int
+}
+
+func (err *quotaError) Error() string {
+	return "Failed to queue the Job : tenant " + err.tenant + " reached its quota of " + strconv.Itoa(err.limit) + " queued jobs"
+}
+
+// parseTenantQuotas parses the per tenant quotas given as a comma
+// separated list of tenant=running:queued, on top of the default quota
+func parseTenantQuotas(value string, defaults TenantQuota) (*tenantQuotas, error) {
+	if defaults.MaxRunning < 0 || defaults.MaxQueued < 0 {
+		return nil, errors.New("Invalid tenant quota, expected positive numbers or 0 for unlimited")
+	}
+	quotas := &tenantQuotas{
+		defaults: defaults,
+		tenants:  make(map[string]TenantQuota),
+	}
+	if value == "" {
+		return quotas, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New("Invalid tenant quota, expected tenant=running:queued: " + item)
+		}
+		limits := strings.SplitN(parts[1], ":", 2)
+		if len(limits) != 2 {
+			return nil, errors.New("Invalid tenant quota, expected tenant=running:queued: " + item)
+		}
+		running, err := strconv.Atoi(limits[0])
+		if err != nil || running < 0 {
+			return nil, errors.New("Invalid tenant quota, expected positive numbers or 0 for unlimited: " + item)
+		}
+		queued, err := strconv.Atoi(limits[1])
+		if err != nil || queued < 0 {
+			return nil, errors.New("Invalid tenant quota, expected positive numbers or 0 for unlimited: " + item)
+		}
+		quotas.tenants[parts[0]] = TenantQuota{running, queued}
+	}
+	return quotas, nil
+}
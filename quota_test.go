@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestTenantQuotaDispatch checks that the jobs of a tenant
+// which reached its running quota are left in the queue
+func TestTenantQuotaDispatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		quotas     *tenantQuotas
+		running    []testJob
+		queued     []testJob
+		dispatched string
+	}{
+		{
+			name:       "tenant running quota",
+			quotas:     &tenantQuotas{tenants: map[string]TenantQuota{"acme": {MaxRunning: 1}}},
+			queued:     []testJob{{name: "a1", tenant: "acme"}, {name: "a2", tenant: "acme"}, {name: "b1", tenant: "beta"}},
+			dispatched: "a1,b1",
+		},
+		{
+			name:       "default tenant quota",
+			quotas:     &tenantQuotas{defaults: TenantQuota{MaxRunning: 1}, tenants: map[string]TenantQuota{"acme": {}}},
+			queued:     []testJob{{name: "b1", tenant: "beta"}, {name: "b2", tenant: "beta"}, {name: "a1", tenant: "acme"}, {name: "a2", tenant: "acme"}},
+			dispatched: "b1,a1,a2",
+		},
+		{
+			name:       "quota reached by the running jobs",
+			quotas:     &tenantQuotas{tenants: map[string]TenantQuota{"acme": {MaxRunning: 1}}},
+			running:    []testJob{{name: "a0", tenant: "acme"}},
+			queued:     []testJob{{name: "a1", tenant: "acme", priority: 9}, {name: "b1", tenant: "beta"}},
+			dispatched: "b1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, names := testScheduler(4, nil, test.quotas, &fairShare{}, 0, test.running, test.queued)
+			if got := jobNames(s.dispatch(), names); got != test.dispatched {
+				t.Errorf("dispatch = %s, want %s", got, test.dispatched)
+			}
+		})
+	}
+}
+
+func TestSchedulerAdmit(t *testing.T) {
+	quotas := &tenantQuotas{defaults: TenantQuota{MaxQueued: 2}, tenants: map[string]TenantQuota{"beta": {MaxQueued: 0}}}
+	s, _ := testScheduler(0, nil, quotas, &fairShare{}, 0, nil,
+		[]testJob{{name: "a1", tenant: "acme"}, {name: "a2", tenant: "acme"}, {name: "b1", tenant: "beta"}, {name: "b2", tenant: "beta"}, {name: "c1", tenant: "corp"}})
+	tests := []struct {
+		tenant   string
+		admitted bool
+	}{
+		{"acme", false},
+		{"beta", true},
+		{"corp", true},
+		{"new", true},
+	}
+	for _, test := range tests {
+		err := s.admit(test.tenant)
+		if (err == nil) != test.admitted {
+			t.Errorf("admit(%s) = %v, want admitted %v", test.tenant, err, test.admitted)
+		}
+		if _, ok := err.(*quotaError); err != nil && !ok {
+			t.Errorf("admit(%s) = %T, want a quotaError", test.tenant, err)
+		}
+	}
+}
+
+func TestParseTenantQuotas(t *testing.T) {
+	tests := []struct {
+		value   string
+		tenants map[string]TenantQuota
+		valid   bool
+	}{
+		{"", map[string]TenantQuota{}, true},
+		{"acme=2:10,beta=0:5", map[string]TenantQuota{"acme": {2, 10}, "beta": {0, 5}}, true},
+		{"acme=2", nil, false},
+		{"=1:1", nil, false},
+		{"acme=-1:1", nil, false},
+		{"acme=1:many", nil, false},
+	}
+	for _, test := range tests {
+		quotas, err := parseTenantQuotas(test.value, TenantQuota{MaxRunning: 1})
+		if (err == nil) != test.valid {
+			t.Errorf("parseTenantQuotas(%q) = %v, want valid %v", test.value, err, test.valid)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(quotas.tenants, test.tenants) {
+			t.Errorf("parseTenantQuotas(%q) = %v, want %v", test.value, quotas.tenants, test.tenants)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+const (
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = 5 * time.Minute
+	defaultMultiplier = 2
+)
+
+// RetryPolicy represents how a failed job is retried
+// MaxAttempts is the total number of attempts, including the first one
+// Backoff is the delay before the first retry, multiplied by Multiplier
+// for every following retry up to MaxBackoff
+// Jitter randomly varies the delays by the given fraction
+// RetryOn is the list of error classes retried, every error is retried if empty
+type RetryPolicy struct {
+	MaxAttempts int      `json:"max_attempts" example:"3"`
+	Backoff     string   `json:"backoff,omitempty" example:"1s"`
+	MaxBackoff  string   `json:"max_backoff,omitempty" example:"5m"`
+	Multiplier  float64  `json:"multiplier,omitempty" example:"2"`
+	Jitter      float64  `json:"jitter,omitempty" example:"0.1"`
+	RetryOn     []string `json:"retry_on,omitempty" example:"transient"`
+}
+
+// Attempt records a failed attempt of a job
+type Attempt struct {
+	Number  int        `json:"number"`
+	At      time.Time  `json:"at"`
+	Error   string     `json:"error"`
+	Class   string     `json:"class"`
+	RetryAt *time.Time `json:"retry_at,omitempty"` // Nil if the job wasn't retried
+}
+
+// validate checks the policy of a job request
+func (policy *RetryPolicy) validate() error {
+	if policy.MaxAttempts < 0 {
+		return errors.New("Invalid retry max_attempts")
+	}
+	for _, value := range []string{policy.Backoff, policy.MaxBackoff} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return errors.New("Invalid retry backoff: " + value)
+		}
+	}
+	if policy.Multiplier < 0 {
+		return errors.New("Invalid retry multiplier")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return errors.New("Invalid retry jitter, expected a number between 0 and 1")
+	}
+	for _, class := range policy.RetryOn {
+		if class != jobs.TransientError && class != jobs.PermanentError {
+			return errors.New("Invalid retry error class: " + class)
+		}
+	}
+	return nil
+}
+
+// retryDelay returns the delay before retrying the job after the
+// given failed attempt, false if the job shouldn't be retried
+func (policy *RetryPolicy) retryDelay(attempt int, err error) (time.Duration, bool) {
+	if policy == nil || attempt >= policy.MaxAttempts {
+		return 0, false
+	}
+	if len(policy.RetryOn) > 0 {
+		retryable := false
+		for _, class := range policy.RetryOn {
+			retryable = retryable || class == jobs.ErrorClass(err)
+		}
+		if !retryable {
+			return 0, false
+		}
+	}
+
+	backoff, maxBackoff, multiplier := defaultBackoff, defaultMaxBackoff, float64(defaultMultiplier)
+	if policy.Backoff != "" {
+		backoff, _ = time.ParseDuration(policy.Backoff)
+	}
+	if policy.MaxBackoff != "" {
+		maxBackoff, _ = time.ParseDuration(policy.MaxBackoff)
+	}
+	if policy.Multiplier > 0 {
+		multiplier = policy.Multiplier
+	}
+	delay := float64(backoff) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+	delay += delay * policy.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(delay), true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+func TestRetryDelay(t *testing.T) {
+	permanent := errors.New("syntax error")
+	temporary := jobs.Transient(errors.New("database is locked"))
+	tests := []struct {
+		name    string
+		policy  *RetryPolicy
+		attempt int
+		err     error
+		delay   time.Duration
+		retried bool
+	}{
+		{"no policy", nil, 1, permanent, 0, false},
+		{"defaults", &RetryPolicy{MaxAttempts: 3}, 1, permanent, time.Second, true},
+		{"defaults doubled", &RetryPolicy{MaxAttempts: 3}, 2, permanent, 2 * time.Second, true},
+		{"attempts exhausted", &RetryPolicy{MaxAttempts: 3}, 3, permanent, 0, false},
+		{"backoff", &RetryPolicy{MaxAttempts: 5, Backoff: "10s", Multiplier: 3}, 3, permanent, 90 * time.Second, true},
+		{"max backoff", &RetryPolicy{MaxAttempts: 10, Backoff: "1m", MaxBackoff: "5m"}, 6, permanent, 5 * time.Minute, true},
+		{"default max backoff", &RetryPolicy{MaxAttempts: 20}, 15, permanent, defaultMaxBackoff, true},
+		{"retry on transient", &RetryPolicy{MaxAttempts: 3, RetryOn: []string{jobs.TransientError}}, 1, temporary, time.Second, true},
+		{"permanent not retried", &RetryPolicy{MaxAttempts: 3, RetryOn: []string{jobs.TransientError}}, 1, permanent, 0, false},
+		{"retry on both", &RetryPolicy{MaxAttempts: 3, RetryOn: []string{jobs.TransientError, jobs.PermanentError}}, 1, permanent, time.Second, true},
+	}
+	for _, test := range tests {
+		delay, retried := test.policy.retryDelay(test.attempt, test.err)
+		if delay != test.delay || retried != test.retried {
+			t.Errorf("%s: retryDelay(%d) = %s, %v, want %s, %v", test.name, test.attempt, delay, retried, test.delay, test.retried)
+		}
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 2, Backoff: "10s", Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		delay, retried := policy.retryDelay(1, errors.New("failed"))
+		if !retried || delay < 8*time.Second || delay > 12*time.Second {
+			t.Fatalf("retryDelay = %s, %v, want 10s +- 20%%", delay, retried)
+		}
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy RetryPolicy
+		valid  bool
+	}{
+		{RetryPolicy{MaxAttempts: 3, Backoff: "1s", MaxBackoff: "1m", Multiplier: 2, Jitter: 0.1, RetryOn: []string{jobs.TransientError}}, true},
+		{RetryPolicy{}, true},
+		{RetryPolicy{MaxAttempts: -1}, false},
+		{RetryPolicy{Backoff: "soon"}, false},
+		{RetryPolicy{MaxBackoff: "-1s"}, false},
+		{RetryPolicy{Multiplier: -2}, false},
+		{RetryPolicy{Jitter: 1.5}, false},
+		{RetryPolicy{RetryOn: []string{"sometimes"}}, false},
+	}
+	for _, test := range tests {
+		if err := test.policy.validate(); (err == nil) != test.valid {
+			t.Errorf("validate(%+v) = %v, want valid %v", test.policy, err, test.valid)
+		}
+	}
+}
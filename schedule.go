@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// Catch up policies for the ticks missed while the server was down
+const (
+	CatchUpAll    string = "all"    // Run every missed tick
+	CatchUpLatest string = "latest" // Run only the most recent missed tick
+	CatchUpNone   string = "none"   // Skip the missed ticks
+)
+
+const (
+	maxScheduleRuns = 100         // Number of runs kept in the history of a schedule
+	catchUpGrace    = time.Minute // Ticks noticed within this delay are not considered missed
+)
+
+// relativeDate matches the relative date expressions of the args templates,
+// e.g. today, today-1d or today+2w
+var relativeDate = regexp.MustCompile(`^today(?:([+-])(\d+)([dwmy]))?$`)
+
+// ScheduleRequest represents the request to create a recurring job schedule
+// Cron is a standard cron expression, or a descriptor like @daily
+// Args of the job can use relative dates like today-1d, resolved at each tick
+// The deadline of the job request is ignored, use timeout instead
+type ScheduleRequest struct {
+	JobRequest
+	Cron    string `json:"cron" example:"0 2 * * *"`
+	CatchUp string `json:"catch_up" example:"latest"`
+}
+
+// Schedule is a recurring job, materialized into a new job at every tick
+type Schedule struct {
+	ScheduleID uuid.UUID `json:"scheduleID" example:"9e3e9c1c-2d2a-4a3f-8b9a-3c1f0d7e6a51"`
+	ScheduleRequest
+	Owner     string        `json:"owner,omitempty" example:"alice"` // User who created the schedule, owner of its jobs
+	Tenant    string        `json:"tenant,omitempty" example:"acme"` // Tenant of the user, tenant of its jobs
+	CreatedAt time.Time     `json:"created_at"`
+	LastTick  time.Time     `json:"last_tick"` // Latest tick handled, run or skipped
+	Runs      []ScheduleRun `json:"runs"`
+}
+
+// ScheduleRun records the job created for a tick of a schedule
+type ScheduleRun struct {
+	Tick  time.Time `json:"tick"`
+	JobID uuid.UUID `json:"jobID"`
+	Error string    `json:"error,omitempty"`
+}
+
+func newSchedule(scheduleRequest *ScheduleRequest, owner string, tenant string) (*Schedule, error) {
+	if _, err := cron.ParseStandard(scheduleRequest.Cron); err != nil {
+		return nil, errors.New("Invalid cron expression")
+	}
+	switch scheduleRequest.CatchUp {
+	case "":
+		scheduleRequest.CatchUp = CatchUpLatest
+	case CatchUpAll, CatchUpLatest, CatchUpNone:
+	default:
+		return nil, errors.New("Invalid catch_up policy")
+	}
+	now := time.Now()
+	schedule := &Schedule{
+		ScheduleID:      uuid.New(),
+		ScheduleRequest: *scheduleRequest,
+		Owner:           owner,
+		Tenant:          tenant,
+		CreatedAt:       now,
+		LastTick:        now,
+		Runs:            []ScheduleRun{},
+	}
+	// Check that the template builds a valid job
+	record, err := schedule.jobRecord(now)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = buildSubmittedJob(record, nil, nil); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// dueTicks returns the ticks of the schedule to run at the given time,
+// along with the latest tick passed, according to the catch up policy
+func (schedule *Schedule) dueTicks(now time.Time) ([]time.Time, time.Time) {
+	cronSchedule, err := cron.ParseStandard(schedule.Cron)
+	if err != nil {
+		return nil, schedule.LastTick
+	}
+	keep := 1
+	if schedule.CatchUp == CatchUpAll {
+		keep = maxScheduleRuns
+	}
+	ticks := []time.Time{}
+	for tick := cronSchedule.Next(schedule.LastTick); !tick.After(now); tick = cronSchedule.Next(tick) {
+		ticks = append(ticks, tick)
+		if len(ticks) > keep {
+			ticks = ticks[1:]
+		}
+	}
+	if len(ticks) == 0 {
+		return nil, schedule.LastTick
+	}
+	latest := ticks[len(ticks)-1]
+	if schedule.CatchUp == CatchUpNone && now.Sub(latest) > catchUpGrace {
+		return nil, latest
+	}
+	return ticks, latest
+}
+
+// jobRecord materializes the job of the schedule for the tick
+func (schedule *Schedule) jobRecord(tick time.Time) (*JobRecord, error) {
+	args, err := resolveArgs(schedule.Args, tick)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{"schedule": schedule.ScheduleID.String()}
+	for key, value := range schedule.Labels {
+		labels[key] = value
+	}
+	record := newJobRecord(uuid.New(), &JobRequest{
+		Type:        schedule.Type,
+		Args:        args,
+		Labels:      labels,
+		Priority:    schedule.Priority,
+		Timeout:     schedule.Timeout,
+		Retry:       schedule.Retry,
+		CallbackURL: schedule.CallbackURL,
+	}, schedule.Owner, schedule.Tenant)
+	return record, nil
+}
+
+// resolveArgs replaces the relative dates of the args template
+// with the dates relative to the tick
+func resolveArgs(template map[string]interface{}, tick time.Time) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	for key, value := range template {
+		expr, ok := value.(string)
+		if !ok {
+			args[key] = value
+			continue
+		}
+		match := relativeDate.FindStringSubmatch(expr)
+		if match == nil {
+			args[key] = value
+			continue
+		}
+		date := time.Date(tick.Year(), tick.Month(), tick.Day(), 0, 0, 0, 0, tick.Location())
+		if match[1] != "" {
+			n, err := strconv.Atoi(match[2])
+			if err != nil {
+				return nil, errors.New("Invalid relative date: " + expr)
+			}
+			if match[1] == "-" {
+				n = -n
+			}
+			switch match[3] {
+			case "d":
+				date = date.AddDate(0, 0, n)
+			case "w":
+				date = date.AddDate(0, 0, 7*n)
+			case "m":
+				date = date.AddDate(0, n, 0)
+			case "y":
+				date = date.AddDate(n, 0, 0)
+			}
+		}
+		args[key] = date.Format(timeLayout)
+	}
+	return args, nil
+}
+
+// scheduleRunner materializes the schedules into the job manager
+type scheduleRunner struct {
+	store   ScheduleStore
+	manager *JobManager
+}
+
+func newScheduleRunner(store ScheduleStore, manager *JobManager) *scheduleRunner {
+	runner := &scheduleRunner{
+		store:   store,
+		manager: manager,
+	}
+	go runner.loop()
+	return runner
+}
+
+func (runner *scheduleRunner) loop() {
+	ticker := time.NewTicker(time.Second)
+	for now := range ticker.C {
+		schedules, err := runner.store.listSchedules()
+		if err != nil {
+			log.Println("Failed to list the schedules: ", err.Error())
+			continue
+		}
+		for _, schedule := range schedules {
+			runner.run(schedule, now)
+		}
+	}
+}
+
+// run creates the jobs for the due ticks of the schedule and records them
+func (runner *scheduleRunner) run(schedule *Schedule, now time.Time) {
+	ticks, latest := schedule.dueTicks(now)
+	if latest.Equal(schedule.LastTick) {
+		return
+	}
+	// The ticks are claimed before the jobs are submitted, so that a tick
+	// is never run twice: if the schedule can't be saved or the process
+	// exits before the runs are recorded, the ticks are skipped instead
+	err := runner.store.updateSchedule(schedule.ScheduleID, func(stored *Schedule) error {
+		stored.LastTick = latest
+		return nil
+	})
+	if err != nil {
+		if err != errScheduleNotFound {
+			log.Printf("Failed to save the schedule: %s\nError: %s", schedule.ScheduleID.String(), err.Error())
+		}
+		return
+	}
+	runs := []ScheduleRun{}
+	for _, tick := range ticks {
+		run := ScheduleRun{Tick: tick}
+		record, err := schedule.jobRecord(tick)
+		if err == nil {
+			run.JobID = record.JobID
+			err = runner.manager.submit(record)
+		}
+		if err != nil {
+			log.Printf("Failed to run the schedule: %s\nError: %s", schedule.ScheduleID.String(), err.Error())
+			run.Error = err.Error()
+		} else {
+			log.Printf("Schedule %s created job %s", schedule.ScheduleID.String(), run.JobID.String())
+		}
+		runs = append(runs, run)
+	}
+	if len(runs) == 0 {
+		return
+	}
+	err = runner.store.updateSchedule(schedule.ScheduleID, func(stored *Schedule) error {
+		stored.Runs = append(stored.Runs, runs...)
+		if len(stored.Runs) > maxScheduleRuns {
+			stored.Runs = stored.Runs[len(stored.Runs)-maxScheduleRuns:]
+		}
+		return nil
+	})
+	if err != nil && err != errScheduleNotFound {
+		log.Printf("Failed to save the schedule: %s\nError: %s", schedule.ScheduleID.String(), err.Error())
+	}
+}
+
+// list returns the schedules of the tenant sorted by creation time
+func (runner *scheduleRunner) list(tenant string) ([]*Schedule, error) {
+	stored, err := runner.store.listSchedules()
+	if err != nil {
+		return nil, err
+	}
+	schedules := []*Schedule{}
+	for _, schedule := range stored {
+		if tenantOf(schedule.Tenant) == tenant {
+			schedules = append(schedules, schedule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	return schedules, nil
+}
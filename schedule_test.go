@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+func TestDueTicks(t *testing.T) {
+	lastTick := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+	hour := func(h int) time.Time { return lastTick.Add(time.Duration(h) * time.Hour) }
+	tests := []struct {
+		name    string
+		cron    string
+		catchUp string
+		now     time.Time
+		first   time.Time // First tick to run, zero if none
+		count   int
+		latest  time.Time
+	}{
+		{"no tick passed", "0 * * * *", CatchUpLatest, hour(0).Add(30 * time.Minute), time.Time{}, 0, hour(0)},
+		{"tick on time", "0 * * * *", CatchUpNone, hour(1), hour(1), 1, hour(1)},
+		{"latest after a downtime", "0 * * * *", CatchUpLatest, hour(5).Add(10 * time.Minute), hour(5), 1, hour(5)},
+		{"all after a downtime", "0 * * * *", CatchUpAll, hour(5).Add(10 * time.Minute), hour(1), 5, hour(5)},
+		{"none after a downtime", "0 * * * *", CatchUpNone, hour(5).Add(10 * time.Minute), time.Time{}, 0, hour(5)},
+		{"none within the grace", "0 * * * *", CatchUpNone, hour(5).Add(catchUpGrace), hour(5), 1, hour(5)},
+		{"none after the grace", "0 * * * *", CatchUpNone, hour(5).Add(catchUpGrace + time.Second), time.Time{}, 0, hour(5)},
+		{"all capped to the runs kept", "0 * * * *", CatchUpAll, hour(150), hour(150 - maxScheduleRuns + 1), maxScheduleRuns, hour(150)},
+		{"descriptor", "@daily", CatchUpAll, hour(49), hour(24), 2, hour(48)},
+		{"invalid cron", "every hour", CatchUpAll, hour(5), time.Time{}, 0, hour(0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := &Schedule{ScheduleRequest: ScheduleRequest{Cron: test.cron, CatchUp: test.catchUp}, LastTick: lastTick}
+			ticks, latest := schedule.dueTicks(test.now)
+			if len(ticks) != test.count {
+				t.Fatalf("dueTicks = %d ticks, want %d", len(ticks), test.count)
+			}
+			if test.count > 0 && !ticks[0].Equal(test.first) {
+				t.Errorf("first tick = %s, want %s", ticks[0], test.first)
+			}
+			if !latest.Equal(test.latest) {
+				t.Errorf("latest tick = %s, want %s", latest, test.latest)
+			}
+		})
+	}
+}
+
+func TestResolveArgs(t *testing.T) {
+	tests := []struct {
+		tick time.Time
+		expr interface{}
+		want interface{}
+	}{
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), "today", "2021-Mar-31"},
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), "today-1d", "2021-Mar-30"},
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), "today+1d", "2021-Apr-01"},
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), "today-2w", "2021-Mar-17"},
+		{time.Date(2021, time.March, 15, 2, 0, 0, 0, time.UTC), "today-1m", "2021-Feb-15"},
+		// AddDate normalizes the day past the end of the month
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), "today-1m", "2021-Mar-03"},
+		{time.Date(2021, time.January, 31, 2, 0, 0, 0, time.UTC), "today+1m", "2021-Mar-03"},
+		{time.Date(2020, time.February, 29, 2, 0, 0, 0, time.UTC), "today+1y", "2021-Mar-01"},
+		{time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), "today-1d", "2020-Dec-31"},
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), "yesterday", "yesterday"},
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), "today-1", "today-1"},
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), "2021-Jan-01", "2021-Jan-01"},
+		{time.Date(2021, time.March, 31, 2, 0, 0, 0, time.UTC), 5.0, 5.0},
+	}
+	for _, test := range tests {
+		args, err := resolveArgs(map[string]interface{}{"date": test.expr}, test.tick)
+		if err != nil {
+			t.Errorf("resolveArgs(%v) at %s = %v", test.expr, test.tick, err)
+			continue
+		}
+		if args["date"] != test.want {
+			t.Errorf("resolveArgs(%v) at %s = %v, want %v", test.expr, test.tick.Format(timeLayout), args["date"], test.want)
+		}
+	}
+}
+
+// TestScheduleRunHistory checks that a schedule only keeps its latest runs
+func TestScheduleRunHistory(t *testing.T) {
+	store := newMemoryStore()
+	lastTick := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+	schedule := &Schedule{
+		ScheduleID: uuid.New(),
+		ScheduleRequest: ScheduleRequest{
+			JobRequest: JobRequest{Type: simple.Name, Args: map[string]interface{}{"message": "Doing Job"}},
+			Cron:       "0 * * * *",
+			CatchUp:    CatchUpAll,
+		},
+		LastTick: lastTick,
+	}
+	for i := 0; i < maxScheduleRuns-2; i++ {
+		schedule.Runs = append(schedule.Runs, ScheduleRun{Tick: lastTick.Add(-time.Duration(i) * time.Hour), JobID: uuid.New()})
+	}
+	if err := store.saveSchedule(schedule); err != nil {
+		t.Fatal(err)
+	}
+	runner := &scheduleRunner{store: store, manager: newTestManager(t, store, 0)}
+	runner.run(schedule, lastTick.Add(5*time.Hour))
+	stored, err := store.getSchedule(schedule.ScheduleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Runs) != maxScheduleRuns {
+		t.Fatalf("%d runs kept, want %d", len(stored.Runs), maxScheduleRuns)
+	}
+	ticks := []time.Time{}
+	for _, run := range stored.Runs[maxScheduleRuns-5:] {
+		if run.Error != "" {
+			t.Errorf("run of %s failed: %s", run.Tick, run.Error)
+		}
+		ticks = append(ticks, run.Tick)
+	}
+	want := []time.Time{}
+	for h := 1; h <= 5; h++ {
+		want = append(want, lastTick.Add(time.Duration(h)*time.Hour))
+	}
+	if !reflect.DeepEqual(ticks, want) {
+		t.Errorf("last runs = %v, want %v", ticks, want)
+	}
+	if !stored.LastTick.Equal(want[4]) {
+		t.Errorf("last tick = %s, want %s", stored.LastTick, want[4])
+	}
+}
+
+// failingScheduleStore fails to save the schedules while failing is set
+type failingScheduleStore struct {
+	Store
+	failing bool
+}
+
+func (store *failingScheduleStore) updateSchedule(scheduleID uuid.UUID, fn func(schedule *Schedule) error) error {
+	if store.failing {
+		return errors.New("Failed to write the schedule")
+	}
+	return store.Store.updateSchedule(scheduleID, fn)
+}
+
+// TestScheduleClaimsTicks checks that the ticks are saved before their
+// jobs are submitted, so that no job is created for the ticks which
+// can't be saved and a tick is never run twice
+func TestScheduleClaimsTicks(t *testing.T) {
+	store := &failingScheduleStore{Store: newMemoryStore(), failing: true}
+	lastTick := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+	schedule := &Schedule{
+		ScheduleID: uuid.New(),
+		ScheduleRequest: ScheduleRequest{
+			JobRequest: JobRequest{Type: simple.Name, Args: map[string]interface{}{"message": "Doing Job"}},
+			Cron:       "0 * * * *",
+			CatchUp:    CatchUpAll,
+		},
+		LastTick: lastTick,
+	}
+	if err := store.saveSchedule(schedule); err != nil {
+		t.Fatal(err)
+	}
+	runner := &scheduleRunner{store: store, manager: newTestManager(t, store, 0)}
+	now := lastTick.Add(2 * time.Hour)
+	runner.run(schedule, now)
+	if records, err := store.list(); err != nil || len(records) != 0 {
+		t.Fatalf("jobs = %d, %v, want no job while the schedule can't be saved", len(records), err)
+	}
+
+	store.failing = false
+	for i := 0; i < 2; i++ {
+		stored, err := store.getSchedule(schedule.ScheduleID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner.run(stored, now)
+	}
+	records, err := store.list()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("jobs = %d, %v, want a job per tick", len(records), err)
+	}
+	stored, err := store.getSchedule(schedule.ScheduleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.LastTick.Equal(now) || len(stored.Runs) != 2 {
+		t.Errorf("last tick = %s, %d runs, want %s and 2 runs", stored.LastTick, len(stored.Runs), now)
+	}
+}
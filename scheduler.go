@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+)
+
+// queuedJob is a job waiting in the scheduler queue for a worker
+type queuedJob struct {
+	jobID     uuid.UUID
+	jobType   string
+	tenant    string
+	priority  int
+	queuedAt  time.Time
+	notBefore time.Time // Earliest time the job can be started, used to delay retries
+}
+
+// effectivePriority is the priority of the job raised by one
+// for every aging interval spent in the queue, so that
+// low priority jobs are eventually started
+func (job queuedJob) effectivePriority(now time.Time, aging time.Duration) int {
+	if aging <= 0 {
+		return job.priority
+	}
+	return job.priority + int(now.Sub(job.queuedAt)/aging)
+}
+
+// scheduler starts the queued jobs by priority, in FIFO order for equal
+// priorities, sharing the workers between the tenants according to their
+// weights. It runs at most workers jobs at once, at most typeLimits[type]
+// jobs of each type and at most the running quota of each tenant
+type scheduler struct {
+	workers    int
+	typeLimits map[string]int
+	quotas     *tenantQuotas
+	share      *fairShare
+	aging      time.Duration
+	startJob   func(jobID uuid.UUID) error // Starts a queued job
+
+	mu      sync.Mutex
+	queue   []queuedJob
+	running map[uuid.UUID]queuedJob // Every job holding a worker
+	wake    chan struct{}
+}
+
+// QueueStats represents the state of the scheduler queue and workers
+// The tenant fields and the queue only cover the jobs of the tenant of the caller
+type QueueStats struct {
+	Workers       int            `json:"workers" example:"4"`
+	Running       int            `json:"running" example:"4"`
+	Queued        int            `json:"queued" example:"2"`
+	TypeLimits    map[string]int `json:"type_limits"`
+	TypeRunning   map[string]int `json:"type_running"`
+	TypeQueued    map[string]int `json:"type_queued"`
+	Tenant        string         `json:"tenant" example:"acme"`
+	TenantQuota   TenantQuota    `json:"tenant_quota"`
+	TenantRunning int            `json:"tenant_running" example:"1"`
+	TenantQueued  int            `json:"tenant_queued" example:"1"`
+	Queue         []uuid.UUID    `json:"queue"`
+}
+
+func newScheduler(workers int, typeLimits map[string]int, quotas *tenantQuotas, share *fairShare, aging time.Duration, startJob func(jobID uuid.UUID) error) *scheduler {
+	s := &scheduler{
+		workers:    workers,
+		typeLimits: typeLimits,
+		quotas:     quotas,
+		share:      share,
+		aging:      aging,
+		startJob:   startJob,
+		queue:      []queuedJob{},
+		running:    make(map[uuid.UUID]queuedJob),
+		wake:       make(chan struct{}, 1),
+	}
+	go s.loop()
+	return s
+}
+
+// parseTypeLimits parses the per type concurrency limits
+// given as a comma separated list of Type=limit
+func parseTypeLimits(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	if value == "" {
+		return limits, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid type limit, expected Type=limit: " + item)
+		}
+		if _, ok := jobs.Lookup(parts[0]); !ok {
+			return nil, errors.New("Invalid type limit, unknown job type: " + item)
+		}
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil || limit <= 0 {
+			return nil, errors.New("Invalid type limit, expected a positive number: " + item)
+		}
+		limits[parts[0]] = limit
+	}
+	return limits, nil
+}
+
+// update tracks the status change of a job,
+// it is called by the job manager on every transition
+func (s *scheduler) update(job queuedJob, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch status {
+	case Queued:
+		// A retried job is queued while it still holds its worker
+		delete(s.running, job.jobID)
+		if s.queueIndex(job.jobID) < 0 {
+			job.queuedAt = time.Now()
+			s.queue = append(s.queue, job)
+		}
+		if delay := time.Until(job.notBefore); delay > 0 {
+			time.AfterFunc(delay, s.notify)
+		}
+	case Running:
+		s.running[job.jobID] = job
+	default:
+		if i := s.queueIndex(job.jobID); i >= 0 {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		}
+		delete(s.running, job.jobID)
+	}
+	s.notify()
+}
+
+// release frees the worker reserved for the job
+func (s *scheduler) release(jobID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, jobID)
+	s.notify()
+}
+
+// reprioritize changes the priority of a queued job,
+// the time it already spent in the queue still counts for aging
+func (s *scheduler) reprioritize(jobID uuid.UUID, priority int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.queueIndex(jobID); i >= 0 {
+		s.queue[i].priority = priority
+		s.notify()
+	}
+}
+
+// position returns the position of the job in the dispatch order
+// of the queue starting at 1, or 0 if the job isn't queued
+func (s *scheduler) position(jobID uuid.UUID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, job := range s.ordered() {
+		if job.jobID == jobID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// admit returns a quotaError if the tenant can't queue another job
+func (s *scheduler) admit(tenant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quota := s.quotas.of(tenant)
+	if quota.MaxQueued <= 0 {
+		return nil
+	}
+	queued := 0
+	for _, job := range s.queue {
+		if job.tenant == tenant {
+			queued++
+		}
+	}
+	if queued >= quota.MaxQueued {
+		return &quotaError{tenant, quota.MaxQueued}
+	}
+	return nil
+}
+
+// stats returns the state of the queue and workers,
+// the queued jobs are only listed for the given tenant
+func (s *scheduler) stats(tenant string) QueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := QueueStats{
+		Workers:     s.workers,
+		Running:     len(s.running),
+		Queued:      len(s.queue),
+		TypeLimits:  s.typeLimits,
+		TypeRunning: make(map[string]int),
+		TypeQueued:  make(map[string]int),
+		Tenant:      tenant,
+		TenantQuota: s.quotas.of(tenant),
+		Queue:       []uuid.UUID{},
+	}
+	for _, job := range s.running {
+		stats.TypeRunning[job.jobType]++
+		if job.tenant == tenant {
+			stats.TenantRunning++
+		}
+	}
+	for _, job := range s.ordered() {
+		stats.TypeQueued[job.jobType]++
+		if job.tenant == tenant {
+			stats.TenantQueued++
+			stats.Queue = append(stats.Queue, job.jobID)
+		}
+	}
+	return stats
+}
+
+// byPriority returns the queued jobs sorted by effective priority, s.mu must be held
+func (s *scheduler) byPriority() []queuedJob {
+	now := time.Now()
+	sorted := append([]queuedJob{}, s.queue...)
+	sort.Slice(sorted, func(i, j int) bool {
+		pi, pj := sorted[i].effectivePriority(now, s.aging), sorted[j].effectivePriority(now, s.aging)
+		if pi != pj {
+			return pi > pj
+		}
+		return sorted[i].queuedAt.Before(sorted[j].queuedAt)
+	})
+	return sorted
+}
+
+// ordered returns the queued jobs in their dispatch order, s.mu must be held.
+// With fair sharing the order is projected from the running jobs,
+// assuming none of them finishes and ignoring the limits
+func (s *scheduler) ordered() []queuedJob {
+	sorted := s.byPriority()
+	if !s.share.enabled {
+		return sorted
+	}
+	u := newUsage(s.running)
+	ordered := make([]queuedJob, 0, len(sorted))
+	for len(sorted) > 0 {
+		i := s.share.next(sorted, u, func(queuedJob) bool { return true })
+		u.add(sorted[i])
+		ordered = append(ordered, sorted[i])
+		sorted = append(sorted[:i], sorted[i+1:]...)
+	}
+	return ordered
+}
+
+func (s *scheduler) queueIndex(jobID uuid.UUID) int {
+	for i, job := range s.queue {
+		if job.jobID == jobID {
+			return i
+		}
+	}
+	return -1
+}
+
+// notify wakes up the scheduler loop
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop dispatches the queued jobs whenever the queue or the workers change.
+// Jobs are started outside of the update calls, as those are made
+// from the job actors which can't wait on themselves
+func (s *scheduler) loop() {
+	for range s.wake {
+		for _, job := range s.dispatch() {
+			if err := s.startJob(job.jobID); err != nil {
+				// Job left the queue before it could be started, or failed to start
+				log.Printf("Failed to start the job: %s\nError: %s", job.jobID.String(), err.Error())
+				s.release(job.jobID)
+			}
+		}
+	}
+}
+
+// dispatch removes the jobs to be started from the queue and reserves
+// their workers. While workers are available, the next job is picked by
+// fair share among the queued jobs, skipping the types which reached
+// their limit, the tenants which reached their quota and the retried
+// jobs still waiting for their backoff
+func (s *scheduler) dispatch() []queuedJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := newUsage(s.running)
+	now := time.Now()
+	eligible := func(job queuedJob) bool {
+		limit, limited := s.typeLimits[job.jobType]
+		quota := s.quotas.of(job.tenant).MaxRunning
+		return !(limited && u.types[job.jobType] >= limit) &&
+			!(quota > 0 && u.tenants[job.tenant] >= quota) && !now.Before(job.notBefore)
+	}
+	dispatched := []queuedJob{}
+	remaining := s.byPriority()
+	for len(s.running) < s.workers {
+		i := s.share.next(remaining, u, eligible)
+		if i < 0 {
+			break
+		}
+		job := remaining[i]
+		remaining = append(remaining[:i], remaining[i+1:]...)
+		s.running[job.jobID] = job
+		u.add(job)
+		dispatched = append(dispatched, job)
+	}
+	s.queue = remaining
+	return dispatched
+}
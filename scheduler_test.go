@@ -0,0 +1,199 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+// testJob describes a job of the scheduler tests, named for readability
+type testJob struct {
+	name     string
+	tenant   string
+	jobType  string
+	priority int
+	age      time.Duration // Time spent in the queue
+	delayed  bool          // Waiting for its retry backoff
+}
+
+// testScheduler returns a scheduler without its loop, so that the tests dispatch the jobs,
+// along with the names of the jobs by ID
+func testScheduler(workers int, typeLimits map[string]int, quotas *tenantQuotas, share *fairShare, aging time.Duration, running []testJob, queued []testJob) (*scheduler, map[uuid.UUID]string) {
+	s := &scheduler{
+		workers:    workers,
+		typeLimits: typeLimits,
+		quotas:     quotas,
+		share:      share,
+		aging:      aging,
+		queue:      []queuedJob{},
+		running:    make(map[uuid.UUID]queuedJob),
+		wake:       make(chan struct{}, 1),
+	}
+	names := make(map[uuid.UUID]string)
+	now := time.Now()
+	for k, list := range [][]testJob{running, queued} {
+		for i, job := range list {
+			queuedJob := queuedJob{
+				jobID:    uuid.New(),
+				jobType:  job.jobType,
+				tenant:   job.tenant,
+				priority: job.priority,
+				// Queued one millisecond apart in the order of the list
+				queuedAt: now.Add(-job.age - time.Duration(len(list)-i)*time.Millisecond),
+			}
+			if queuedJob.jobType == "" {
+				queuedJob.jobType = simple.Name
+			}
+			if queuedJob.tenant == "" {
+				queuedJob.tenant = defaultTenant
+			}
+			if job.delayed {
+				queuedJob.notBefore = now.Add(time.Hour)
+			}
+			names[queuedJob.jobID] = job.name
+			if k == 0 {
+				s.running[queuedJob.jobID] = queuedJob
+			} else {
+				s.queue = append(s.queue, queuedJob)
+			}
+		}
+	}
+	return s, names
+}
+
+func jobNames(jobs []queuedJob, names map[uuid.UUID]string) string {
+	list := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, names[job.jobID])
+	}
+	return strings.Join(list, ",")
+}
+
+var noQuotas = &tenantQuotas{tenants: map[string]TenantQuota{}}
+
+func TestSchedulerDispatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		workers    int
+		typeLimits map[string]int
+		quotas     *tenantQuotas
+		aging      time.Duration
+		running    []testJob
+		queued     []testJob
+		dispatched string
+	}{
+		{
+			name:       "FIFO",
+			workers:    2,
+			queued:     []testJob{{name: "a"}, {name: "b"}, {name: "c"}},
+			dispatched: "a,b",
+		},
+		{
+			name:       "by priority then FIFO",
+			workers:    3,
+			queued:     []testJob{{name: "a"}, {name: "b", priority: 5}, {name: "c", priority: 5}, {name: "d"}},
+			dispatched: "b,c,a",
+		},
+		{
+			name:       "free workers only",
+			workers:    2,
+			running:    []testJob{{name: "r"}},
+			queued:     []testJob{{name: "a"}, {name: "b"}},
+			dispatched: "a",
+		},
+		{
+			name:       "aging raises the priority",
+			workers:    1,
+			aging:      time.Minute,
+			queued:     []testJob{{name: "old", age: 10 * time.Minute}, {name: "high", priority: 5}},
+			dispatched: "old",
+		},
+		{
+			name:       "aging disabled",
+			workers:    1,
+			queued:     []testJob{{name: "old", age: 10 * time.Minute}, {name: "high", priority: 5}},
+			dispatched: "high",
+		},
+		{
+			name:       "type limit",
+			workers:    3,
+			typeLimits: map[string]int{export.Name: 1},
+			queued:     []testJob{{name: "e1", jobType: export.Name}, {name: "e2", jobType: export.Name}, {name: "s1"}},
+			dispatched: "e1,s1",
+		},
+		{
+			name:       "type limit reached by the running jobs",
+			workers:    3,
+			typeLimits: map[string]int{export.Name: 1},
+			running:    []testJob{{name: "e0", jobType: export.Name}},
+			queued:     []testJob{{name: "e1", jobType: export.Name, priority: 9}, {name: "s1"}},
+			dispatched: "s1",
+		},
+		{
+			name:       "retry backoff",
+			workers:    2,
+			queued:     []testJob{{name: "retried", priority: 5, delayed: true}, {name: "a"}},
+			dispatched: "a",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quotas := test.quotas
+			if quotas == nil {
+				quotas = noQuotas
+			}
+			s, names := testScheduler(test.workers, test.typeLimits, quotas, &fairShare{}, test.aging, test.running, test.queued)
+			if got := jobNames(s.dispatch(), names); got != test.dispatched {
+				t.Errorf("dispatch = %s, want %s", got, test.dispatched)
+			}
+			if len(s.running) > test.workers {
+				t.Errorf("%d jobs hold a worker, want at most %d", len(s.running), test.workers)
+			}
+		})
+	}
+}
+
+func TestParseTypeLimits(t *testing.T) {
+	tests := []struct {
+		value  string
+		limits map[string]int
+		valid  bool
+	}{
+		{"", map[string]int{}, true},
+		{"Export=2,Simple=1", map[string]int{export.Name: 2, simple.Name: 1}, true},
+		{"Export", nil, false},
+		{"Unknown=1", nil, false},
+		{"Export=0", nil, false},
+		{"Export=two", nil, false},
+	}
+	for _, test := range tests {
+		limits, err := parseTypeLimits(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("parseTypeLimits(%q) = %v, want valid %v", test.value, err, test.valid)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(limits, test.limits) {
+			t.Errorf("parseTypeLimits(%q) = %v, want %v", test.value, limits, test.limits)
+		}
+	}
+}
+
+func TestSchedulerReprioritize(t *testing.T) {
+	s, names := testScheduler(1, nil, noQuotas, &fairShare{}, 0, nil, []testJob{{name: "a", priority: 5}, {name: "b"}, {name: "c"}})
+	for _, job := range s.queue {
+		if names[job.jobID] == "c" {
+			s.reprioritize(job.jobID, 9)
+			if position := s.position(job.jobID); position != 1 {
+				t.Errorf("position of c = %d, want 1", position)
+			}
+		}
+	}
+	if got := jobNames(s.ordered(), names); got != "c,a,b" {
+		t.Errorf("ordered = %s, want c,a,b", got)
+	}
+}
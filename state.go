@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is an operation which changes the status of a job
+type Action string
+
+// Different actions of the job state machine
+const (
+	queue    Action = "queue"    // Job is waiting for a worker
+	start    Action = "start"    // Worker picks up the job
+	halt     Action = "halt"     // Pause the job processing
+	resume   Action = "resume"   // Queue a halted job again
+	stop     Action = "stop"     // Stop the job before it finishes
+	complete Action = "complete" // Job finished its work
+	fail     Action = "fail"     // Job failed with an error, or failed to start
+	retry    Action = "retry"    // Queue a failed job for another attempt
+	timeout  Action = "timeout"  // Job exceeded its timeout or deadline
+)
+
+// stateTransitions is the transition table of the job state machine.
+// It maps every status to the status reached by each of the allowed actions,
+// terminal status don't allow any action
+var stateTransitions = map[string]map[Action]string{
+	Submitted: {
+		queue:   Queued,
+		stop:    Stopped,
+		timeout: TimedOut,
+	},
+	Queued: {
+		start:   Running,
+		fail:    Failed,
+		stop:    Stopped,
+		timeout: TimedOut,
+	},
+	Running: {
+		halt:     Halted,
+		stop:     Stopped,
+		complete: Completed,
+		fail:     Failed,
+		retry:    Queued,
+		timeout:  TimedOut,
+	},
+	Halted: {
+		resume:  Queued,
+		stop:    Stopped,
+		timeout: TimedOut,
+	},
+	Completed: {},
+	Failed:    {},
+	Stopped:   {},
+	TimedOut:  {},
+}
+
+// nextStatus returns the status reached by performing the action on a job
+// in the given status, or an error if the transition isn't allowed
+func nextStatus(status string, action Action) (string, error) {
+	next, ok := stateTransitions[status][action]
+	if !ok {
+		return "", fmt.Errorf("Failed to %s the Job : Job is %s", action, strings.ToLower(status))
+	}
+	return next, nil
+}
+
+// isTerminal returns true if no action is allowed in the status
+func isTerminal(status string) bool {
+	return len(stateTransitions[status]) == 0
+}
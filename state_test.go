@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestNextStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		action Action
+		next   string // Empty if the transition isn't allowed
+	}{
+		{Submitted, queue, Queued},
+		{Submitted, start, ""},
+		{Submitted, stop, Stopped},
+		{Queued, start, Running},
+		{Queued, halt, ""},
+		{Queued, fail, Failed},
+		{Queued, timeout, TimedOut},
+		{Running, halt, Halted},
+		{Running, complete, Completed},
+		{Running, fail, Failed},
+		{Running, retry, Queued},
+		{Running, resume, ""},
+		{Running, stop, Stopped},
+		{Halted, resume, Queued},
+		{Halted, start, ""},
+		{Halted, stop, Stopped},
+		{Completed, stop, ""},
+		{Failed, retry, ""},
+		{Stopped, resume, ""},
+		{TimedOut, timeout, ""},
+	}
+	for _, test := range tests {
+		next, err := nextStatus(test.status, test.action)
+		if test.next == "" {
+			if err == nil {
+				t.Errorf("nextStatus(%s, %s) = %s, want an error", test.status, test.action, next)
+			}
+			continue
+		}
+		if err != nil || next != test.next {
+			t.Errorf("nextStatus(%s, %s) = %s, %v, want %s", test.status, test.action, next, err, test.next)
+		}
+	}
+}
+
+func TestNextStatusError(t *testing.T) {
+	_, err := nextStatus(Completed, halt)
+	if err == nil || err.Error() != "Failed to halt the Job : Job is completed" {
+		t.Errorf("nextStatus(Completed, halt) = %v", err)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	for status := range stateTransitions {
+		want := status == Completed || status == Failed || status == Stopped || status == TimedOut
+		if isTerminal(status) != want {
+			t.Errorf("isTerminal(%s) = %v, want %v", status, !want, want)
+		}
+	}
+}
@@ -0,0 +1,835 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	errJobNotFound      = errors.New("Job not found")
+	errScheduleNotFound = errors.New("Schedule not found")
+	errWebhookNotFound  = errors.New("Webhook not found")
+	errAPIKeyNotFound   = errors.New("API key not found")
+)
+
+// JobRecord is the persisted representation of a submitted job
+type JobRecord struct {
+	JobID       uuid.UUID              `json:"jobID"`
+	Type        string                 `json:"type"`
+	Args        map[string]interface{} `json:"args"`
+	Labels      map[string]string      `json:"labels,omitempty"`
+	Owner       string                 `json:"owner,omitempty"`  // User who submitted the job
+	Tenant      string                 `json:"tenant,omitempty"` // Tenant of the user, the default tenant if empty
+	Priority    int                    `json:"priority"`
+	Status      string                 `json:"status"`
+	SubmittedAt time.Time              `json:"submitted_at"`
+	Transitions []Transition           `json:"transitions"`
+	Timeout     string                 `json:"timeout,omitempty"`
+	Deadline    *time.Time             `json:"deadline,omitempty"`
+	StartedAt   *time.Time             `json:"started_at,omitempty"` // First time the job was started, the timeout counts from it
+	Retry       *RetryPolicy           `json:"retry,omitempty"`
+	Attempts    []Attempt              `json:"attempts,omitempty"`    // Failed attempts of the job
+	Error       string                 `json:"error,omitempty"`       // Error which caused the job to fail or time out
+	CleanError  string                 `json:"clean_error,omitempty"` // Error of the rollback of a stopped job
+	Checkpoint  map[string]interface{} `json:"checkpoint,omitempty"`  // State saved by the job to continue after a restart
+	Progress    *Progress              `json:"progress,omitempty"`    // Progress of the job at its last transition
+	CallbackURL string                 `json:"callback_url,omitempty"`
+	TraceParent string                 `json:"trace_parent,omitempty"` // W3C traceparent of the submit span, the spans of the job belong to its trace
+	Deliveries  []Delivery             `json:"deliveries,omitempty"`   // Webhook deliveries of the job transitions
+}
+
+// Transition records a change in the status of a job
+type Transition struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+func newJobRecord(jobID uuid.UUID, jobRequest *JobRequest, owner string, tenant string) *JobRecord {
+	return &JobRecord{
+		JobID:       jobID,
+		Type:        jobRequest.Type,
+		Args:        jobRequest.Args,
+		Labels:      jobRequest.Labels,
+		Owner:       owner,
+		Tenant:      tenant,
+		Priority:    jobRequest.Priority,
+		Timeout:     jobRequest.Timeout,
+		Deadline:    jobRequest.Deadline,
+		Retry:       jobRequest.Retry,
+		CallbackURL: jobRequest.CallbackURL,
+		Status:      Submitted,
+		SubmittedAt: time.Now(),
+		Transitions: []Transition{},
+	}
+}
+
+// setStatus updates the status of the record, keeping track of the transition.
+// It returns false if the status didn't change
+func (record *JobRecord) setStatus(status string) bool {
+	if record.Status == status {
+		return false
+	}
+	record.Transitions = append(record.Transitions, Transition{
+		From: record.Status,
+		To:   status,
+		At:   time.Now(),
+	})
+	record.Status = status
+	return true
+}
+
+// JobStore is the common interface for the storage backends
+// that persist the job records
+type JobStore interface {
+	save(record *JobRecord) error                                   // Create or update a job record
+	get(jobID uuid.UUID) (*JobRecord, error)                        // Fetch a job record, errJobNotFound if it doesn't exist
+	update(jobID uuid.UUID, fn func(record *JobRecord) error) error // Atomically modify a job record, saved only if fn returns nil
+	delete(jobID uuid.UUID) error                                   // Remove a job record
+	list() ([]*JobRecord, error)                                    // Fetch all the job records
+	close() error                                                   // Release any resources held by the store
+}
+
+// ScheduleStore is the common interface for the storage backends
+// that persist the recurring job schedules
+type ScheduleStore interface {
+	saveSchedule(schedule *Schedule) error                                        // Create or update a schedule
+	getSchedule(scheduleID uuid.UUID) (*Schedule, error)                          // Fetch a schedule, errScheduleNotFound if it doesn't exist
+	updateSchedule(scheduleID uuid.UUID, fn func(schedule *Schedule) error) error // Atomically modify a schedule, saved only if fn returns nil
+	deleteSchedule(scheduleID uuid.UUID) error                                    // Remove a schedule
+	listSchedules() ([]*Schedule, error)                                          // Fetch all the schedules
+}
+
+// WebhookStore is the common interface for the storage backends
+// that persist the global webhook subscriptions
+type WebhookStore interface {
+	saveWebhook(webhook *Webhook) error               // Create or update a webhook
+	getWebhook(webhookID uuid.UUID) (*Webhook, error) // Fetch a webhook, errWebhookNotFound if it doesn't exist
+	deleteWebhook(webhookID uuid.UUID) error          // Remove a webhook
+	listWebhooks() ([]*Webhook, error)                // Fetch all the webhooks
+	// Fetch the secret signing the payloads, generated and saved on first use
+	webhookSecret(generate func() (string, error)) (string, error)
+}
+
+// APIKeyStore is the common interface for the storage backends
+// that persist the API keys, which are only kept hashed
+type APIKeyStore interface {
+	saveAPIKey(key *APIKey) error           // Create an API key
+	getAPIKey(hash string) (*APIKey, error) // Fetch the API key of the hash, errAPIKeyNotFound if it doesn't exist
+	deleteAPIKey(keyID uuid.UUID) error     // Remove an API key, errAPIKeyNotFound if it doesn't exist
+	listAPIKeys() ([]*APIKey, error)        // Fetch all the API keys
+}
+
+// LogStore is the common interface for the storage backends
+// that persist the log lines of the jobs, only the last
+// maxJobLogLines lines of a job are kept
+type LogStore interface {
+	appendLogs(jobID uuid.UUID, entries []*LogEntry) error       // Append log lines to the job at once, their Seq are set to the next sequence numbers of the job
+	listLogs(jobID uuid.UUID, after uint64) ([]*LogEntry, error) // Fetch the kept log lines of the job following the sequence number
+}
+
+// Store persists the jobs, their schedules and logs, the webhooks and the API keys
+type Store interface {
+	JobStore
+	ScheduleStore
+	WebhookStore
+	APIKeyStore
+	LogStore
+}
+
+// memoryStore keeps the job records, schedules, webhooks, API keys and job logs in memory.
+// Everything is lost when the process exits, useful for tests
+type memoryStore struct {
+	mu        sync.Mutex
+	records   map[uuid.UUID][]byte
+	schedules map[uuid.UUID][]byte
+	webhooks  map[uuid.UUID][]byte
+	apiKeys   map[string][]byte      // By hash
+	secret    string                 // Secret signing the webhook payloads, empty until generated
+	logs      map[uuid.UUID][][]byte // Kept log lines of the jobs, oldest first
+	logSeqs   map[uuid.UUID]uint64   // Sequence number of the last log line of the jobs
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		records:   make(map[uuid.UUID][]byte),
+		schedules: make(map[uuid.UUID][]byte),
+		webhooks:  make(map[uuid.UUID][]byte),
+		apiKeys:   make(map[string][]byte),
+		logs:      make(map[uuid.UUID][][]byte),
+		logSeqs:   make(map[uuid.UUID]uint64),
+	}
+}
+
+func (store *memoryStore) save(record *JobRecord) error {
+	// Keep records marshalled so that callers never share them
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.records[record.JobID] = buf
+	return nil
+}
+
+func (store *memoryStore) get(jobID uuid.UUID) (*JobRecord, error) {
+	store.mu.Lock()
+	buf, ok := store.records[jobID]
+	store.mu.Unlock()
+	if !ok {
+		return nil, errJobNotFound
+	}
+	return unmarshalRecord(buf)
+}
+
+func (store *memoryStore) update(jobID uuid.UUID, fn func(record *JobRecord) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	buf, ok := store.records[jobID]
+	if !ok {
+		return errJobNotFound
+	}
+	record, err := unmarshalRecord(buf)
+	if err != nil {
+		return err
+	}
+	if err = fn(record); err != nil {
+		return err
+	}
+	if buf, err = json.Marshal(record); err != nil {
+		return err
+	}
+	store.records[jobID] = buf
+	return nil
+}
+
+func (store *memoryStore) delete(jobID uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.records, jobID)
+	return nil
+}
+
+func (store *memoryStore) list() ([]*JobRecord, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	records := make([]*JobRecord, 0, len(store.records))
+	for _, buf := range store.records {
+		record, err := unmarshalRecord(buf)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (store *memoryStore) close() error {
+	return nil
+}
+
+func (store *memoryStore) saveSchedule(schedule *Schedule) error {
+	buf, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.schedules[schedule.ScheduleID] = buf
+	return nil
+}
+
+func (store *memoryStore) getSchedule(scheduleID uuid.UUID) (*Schedule, error) {
+	store.mu.Lock()
+	buf, ok := store.schedules[scheduleID]
+	store.mu.Unlock()
+	if !ok {
+		return nil, errScheduleNotFound
+	}
+	return unmarshalSchedule(buf)
+}
+
+func (store *memoryStore) updateSchedule(scheduleID uuid.UUID, fn func(schedule *Schedule) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	buf, ok := store.schedules[scheduleID]
+	if !ok {
+		return errScheduleNotFound
+	}
+	schedule, err := unmarshalSchedule(buf)
+	if err != nil {
+		return err
+	}
+	if err = fn(schedule); err != nil {
+		return err
+	}
+	if buf, err = json.Marshal(schedule); err != nil {
+		return err
+	}
+	store.schedules[scheduleID] = buf
+	return nil
+}
+
+func (store *memoryStore) deleteSchedule(scheduleID uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.schedules, scheduleID)
+	return nil
+}
+
+func (store *memoryStore) listSchedules() ([]*Schedule, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	schedules := make([]*Schedule, 0, len(store.schedules))
+	for _, buf := range store.schedules {
+		schedule, err := unmarshalSchedule(buf)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+func (store *memoryStore) saveWebhook(webhook *Webhook) error {
+	buf, err := json.Marshal(webhook)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.webhooks[webhook.WebhookID] = buf
+	return nil
+}
+
+func (store *memoryStore) getWebhook(webhookID uuid.UUID) (*Webhook, error) {
+	store.mu.Lock()
+	buf, ok := store.webhooks[webhookID]
+	store.mu.Unlock()
+	if !ok {
+		return nil, errWebhookNotFound
+	}
+	return unmarshalWebhook(buf)
+}
+
+func (store *memoryStore) deleteWebhook(webhookID uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.webhooks, webhookID)
+	return nil
+}
+
+func (store *memoryStore) listWebhooks() ([]*Webhook, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	webhooks := make([]*Webhook, 0, len(store.webhooks))
+	for _, buf := range store.webhooks {
+		webhook, err := unmarshalWebhook(buf)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+func (store *memoryStore) webhookSecret(generate func() (string, error)) (string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.secret == "" {
+		secret, err := generate()
+		if err != nil {
+			return "", err
+		}
+		store.secret = secret
+	}
+	return store.secret, nil
+}
+
+func (store *memoryStore) saveAPIKey(key *APIKey) error {
+	buf, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.apiKeys[key.Hash] = buf
+	return nil
+}
+
+func (store *memoryStore) getAPIKey(hash string) (*APIKey, error) {
+	store.mu.Lock()
+	buf, ok := store.apiKeys[hash]
+	store.mu.Unlock()
+	if !ok {
+		return nil, errAPIKeyNotFound
+	}
+	return unmarshalAPIKey(buf)
+}
+
+func (store *memoryStore) deleteAPIKey(keyID uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for hash, buf := range store.apiKeys {
+		key, err := unmarshalAPIKey(buf)
+		if err != nil {
+			return err
+		}
+		if key.KeyID == keyID {
+			delete(store.apiKeys, hash)
+			return nil
+		}
+	}
+	return errAPIKeyNotFound
+}
+
+func (store *memoryStore) listAPIKeys() ([]*APIKey, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	keys := make([]*APIKey, 0, len(store.apiKeys))
+	for _, buf := range store.apiKeys {
+		key, err := unmarshalAPIKey(buf)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (store *memoryStore) appendLogs(jobID uuid.UUID, entries []*LogEntry) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	lines := store.logs[jobID]
+	seq := store.logSeqs[jobID]
+	for _, entry := range entries {
+		seq++
+		entry.Seq = seq
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, buf)
+	}
+	store.logSeqs[jobID] = seq
+	if len(lines) > maxJobLogLines {
+		lines = lines[len(lines)-maxJobLogLines:]
+	}
+	store.logs[jobID] = lines
+	return nil
+}
+
+func (store *memoryStore) listLogs(jobID uuid.UUID, after uint64) ([]*LogEntry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	entries := []*LogEntry{}
+	for _, buf := range store.logs[jobID] {
+		entry, err := unmarshalLogEntry(buf)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Seq > after {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+var (
+	jobsBucket      = []byte("jobs")
+	schedulesBucket = []byte("schedules")
+	webhooksBucket  = []byte("webhooks")
+	apiKeysBucket   = []byte("api_keys") // By hash
+	logsBucket      = []byte("logs")     // A bucket per job holding its log lines by sequence number
+	settingsBucket  = []byte("settings") // Settings of the server by name
+)
+
+var webhookSecretKey = []byte("webhook_secret") // Key of the generated webhook secret in settingsBucket
+
+// boltStore persists the job records, schedules, webhooks, API keys and job logs in an embedded BoltDB file
+type boltStore struct {
+	db *bolt.DB
+}
+
+func newBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{jobsBucket, schedulesBucket, webhooksBucket, apiKeysBucket, logsBucket, settingsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db}, nil
+}
+
+func (store *boltStore) save(record *JobRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put(record.JobID[:], buf)
+	})
+}
+
+func (store *boltStore) get(jobID uuid.UUID) (*JobRecord, error) {
+	var record *JobRecord
+	err := store.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(jobsBucket).Get(jobID[:])
+		if buf == nil {
+			return errJobNotFound
+		}
+		var err error
+		record, err = unmarshalRecord(buf)
+		return err
+	})
+	return record, err
+}
+
+func (store *boltStore) update(jobID uuid.UUID, fn func(record *JobRecord) error) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		buf := bucket.Get(jobID[:])
+		if buf == nil {
+			return errJobNotFound
+		}
+		record, err := unmarshalRecord(buf)
+		if err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+		if buf, err = json.Marshal(record); err != nil {
+			return err
+		}
+		return bucket.Put(jobID[:], buf)
+	})
+}
+
+func (store *boltStore) delete(jobID uuid.UUID) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete(jobID[:])
+	})
+}
+
+func (store *boltStore) list() ([]*JobRecord, error) {
+	records := []*JobRecord{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, buf []byte) error {
+			record, err := unmarshalRecord(buf)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (store *boltStore) close() error {
+	return store.db.Close()
+}
+
+func (store *boltStore) saveSchedule(schedule *Schedule) error {
+	buf, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Put(schedule.ScheduleID[:], buf)
+	})
+}
+
+func (store *boltStore) getSchedule(scheduleID uuid.UUID) (*Schedule, error) {
+	var schedule *Schedule
+	err := store.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(schedulesBucket).Get(scheduleID[:])
+		if buf == nil {
+			return errScheduleNotFound
+		}
+		var err error
+		schedule, err = unmarshalSchedule(buf)
+		return err
+	})
+	return schedule, err
+}
+
+func (store *boltStore) updateSchedule(scheduleID uuid.UUID, fn func(schedule *Schedule) error) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schedulesBucket)
+		buf := bucket.Get(scheduleID[:])
+		if buf == nil {
+			return errScheduleNotFound
+		}
+		schedule, err := unmarshalSchedule(buf)
+		if err != nil {
+			return err
+		}
+		if err = fn(schedule); err != nil {
+			return err
+		}
+		if buf, err = json.Marshal(schedule); err != nil {
+			return err
+		}
+		return bucket.Put(scheduleID[:], buf)
+	})
+}
+
+func (store *boltStore) deleteSchedule(scheduleID uuid.UUID) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Delete(scheduleID[:])
+	})
+}
+
+func (store *boltStore) listSchedules() ([]*Schedule, error) {
+	schedules := []*Schedule{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).ForEach(func(_, buf []byte) error {
+			schedule, err := unmarshalSchedule(buf)
+			if err != nil {
+				return err
+			}
+			schedules = append(schedules, schedule)
+			return nil
+		})
+	})
+	return schedules, err
+}
+
+func (store *boltStore) saveWebhook(webhook *Webhook) error {
+	buf, err := json.Marshal(webhook)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).Put(webhook.WebhookID[:], buf)
+	})
+}
+
+func (store *boltStore) getWebhook(webhookID uuid.UUID) (*Webhook, error) {
+	var webhook *Webhook
+	err := store.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(webhooksBucket).Get(webhookID[:])
+		if buf == nil {
+			return errWebhookNotFound
+		}
+		var err error
+		webhook, err = unmarshalWebhook(buf)
+		return err
+	})
+	return webhook, err
+}
+
+func (store *boltStore) deleteWebhook(webhookID uuid.UUID) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).Delete(webhookID[:])
+	})
+}
+
+func (store *boltStore) listWebhooks() ([]*Webhook, error) {
+	webhooks := []*Webhook{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).ForEach(func(_, buf []byte) error {
+			webhook, err := unmarshalWebhook(buf)
+			if err != nil {
+				return err
+			}
+			webhooks = append(webhooks, webhook)
+			return nil
+		})
+	})
+	return webhooks, err
+}
+
+func (store *boltStore) webhookSecret(generate func() (string, error)) (string, error) {
+	var secret string
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(settingsBucket)
+		if buf := bucket.Get(webhookSecretKey); buf != nil {
+			secret = string(buf)
+			return nil
+		}
+		var err error
+		if secret, err = generate(); err != nil {
+			return err
+		}
+		return bucket.Put(webhookSecretKey, []byte(secret))
+	})
+	return secret, err
+}
+
+func (store *boltStore) saveAPIKey(key *APIKey) error {
+	buf, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiKeysBucket).Put([]byte(key.Hash), buf)
+	})
+}
+
+func (store *boltStore) getAPIKey(hash string) (*APIKey, error) {
+	var key *APIKey
+	err := store.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(apiKeysBucket).Get([]byte(hash))
+		if buf == nil {
+			return errAPIKeyNotFound
+		}
+		var err error
+		key, err = unmarshalAPIKey(buf)
+		return err
+	})
+	return key, err
+}
+
+func (store *boltStore) deleteAPIKey(keyID uuid.UUID) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(apiKeysBucket)
+		var hash []byte
+		err := bucket.ForEach(func(k, buf []byte) error {
+			key, err := unmarshalAPIKey(buf)
+			if err != nil {
+				return err
+			}
+			if key.KeyID == keyID {
+				hash = k
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if hash == nil {
+			return errAPIKeyNotFound
+		}
+		return bucket.Delete(hash)
+	})
+}
+
+func (store *boltStore) listAPIKeys() ([]*APIKey, error) {
+	keys := []*APIKey{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiKeysBucket).ForEach(func(_, buf []byte) error {
+			key, err := unmarshalAPIKey(buf)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	return keys, err
+}
+
+func (store *boltStore) appendLogs(jobID uuid.UUID, entries []*LogEntry) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(logsBucket).CreateBucketIfNotExists(jobID[:])
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Seq, err = bucket.NextSequence(); err != nil {
+				return err
+			}
+			buf, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put(logKey(entry.Seq), buf); err != nil {
+				return err
+			}
+			// Every appended line drops the oldest kept line once the job has enough
+			if entry.Seq > maxJobLogLines {
+				if err = bucket.Delete(logKey(entry.Seq - maxJobLogLines)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (store *boltStore) listLogs(jobID uuid.UUID, after uint64) ([]*LogEntry, error) {
+	entries := []*LogEntry{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(logsBucket).Bucket(jobID[:])
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		for k, buf := cursor.Seek(logKey(after + 1)); k != nil; k, buf = cursor.Next() {
+			entry, err := unmarshalLogEntry(buf)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// logKey is the key of a log line, big endian so that the lines are sorted by sequence number
+func logKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func unmarshalRecord(buf []byte) (*JobRecord, error) {
+	record := &JobRecord{}
+	if err := json.Unmarshal(buf, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func unmarshalSchedule(buf []byte) (*Schedule, error) {
+	schedule := &Schedule{}
+	if err := json.Unmarshal(buf, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func unmarshalWebhook(buf []byte) (*Webhook, error) {
+	webhook := &Webhook{}
+	if err := json.Unmarshal(buf, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func unmarshalAPIKey(buf []byte) (*APIKey, error) {
+	key := &APIKey{}
+	if err := json.Unmarshal(buf, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func unmarshalLogEntry(buf []byte) (*LogEntry, error) {
+	entry := &LogEntry{}
+	if err := json.Unmarshal(buf, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+// testStores runs the test against every store backend
+func testStores(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryStore())
+	})
+	t.Run("bolt", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "store")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		store, err := newBoltStore(filepath.Join(dir, "jobs.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.close()
+		test(t, store)
+	})
+}
+
+func testRecord(status string) *JobRecord {
+	at := time.Date(2021, time.January, 2, 15, 4, 5, 0, time.UTC)
+	return &JobRecord{
+		JobID:       uuid.New(),
+		Type:        export.Name,
+		Args:        map[string]interface{}{"from_date": "2021-Jan-01", "to_date": "2021-Jan-05", "table": "responses"},
+		Labels:      map[string]string{"team": "data"},
+		Owner:       "alice",
+		Tenant:      "acme",
+		Priority:    3,
+		Status:      status,
+		SubmittedAt: at,
+		Transitions: []Transition{{From: Submitted, To: Queued, At: at}},
+		Retry:       &RetryPolicy{MaxAttempts: 3, RetryOn: []string{jobs.TransientError}},
+		Checkpoint:  map[string]interface{}{"cur_date": "2021-Jan-03", "rows": 12.0},
+		Progress:    &Progress{Done: 1, Total: 3},
+	}
+}
+
+func TestJobStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		records := []*JobRecord{testRecord(Queued), testRecord(Completed)}
+		for _, record := range records {
+			if err := store.save(record); err != nil {
+				t.Fatalf("save = %v", err)
+			}
+		}
+		for _, record := range records {
+			got, err := store.get(record.JobID)
+			if err != nil || !reflect.DeepEqual(got, record) {
+				t.Errorf("get = %+v, %v, want %+v", got, err, record)
+			}
+		}
+		if _, err := store.get(uuid.New()); err != errJobNotFound {
+			t.Errorf("get of a missing job = %v, want errJobNotFound", err)
+		}
+
+		jobID := records[0].JobID
+		err := store.update(jobID, func(record *JobRecord) error {
+			record.setStatus(Running)
+			return nil
+		})
+		if got, _ := store.get(jobID); err != nil || got.Status != Running || len(got.Transitions) != 2 {
+			t.Errorf("update = %v, record %+v", err, got)
+		}
+		failed := errors.New("failed")
+		err = store.update(jobID, func(record *JobRecord) error {
+			record.Status = Failed
+			return failed
+		})
+		if got, _ := store.get(jobID); err != failed || got.Status != Running {
+			t.Errorf("failed update = %v, status %s, want the record unchanged", err, got.Status)
+		}
+		if err = store.update(uuid.New(), func(*JobRecord) error { return nil }); err != errJobNotFound {
+			t.Errorf("update of a missing job = %v, want errJobNotFound", err)
+		}
+
+		list, err := store.list()
+		if err != nil || len(list) != 2 {
+			t.Errorf("list = %d records, %v, want 2", len(list), err)
+		}
+		if err = store.delete(jobID); err != nil {
+			t.Errorf("delete = %v", err)
+		}
+		if _, err = store.get(jobID); err != errJobNotFound {
+			t.Errorf("get of a deleted job = %v, want errJobNotFound", err)
+		}
+	})
+}
+
+func TestScheduleStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		at := time.Date(2021, time.January, 2, 2, 0, 0, 0, time.UTC)
+		schedule := &Schedule{
+			ScheduleID: uuid.New(),
+			ScheduleRequest: ScheduleRequest{
+				JobRequest: JobRequest{Type: simple.Name, Args: map[string]interface{}{"message": "Hello"}},
+				Cron:       "0 2 * * *",
+				CatchUp:    "latest",
+			},
+			Owner:     "alice",
+			Tenant:    "acme",
+			CreatedAt: at,
+			LastTick:  at,
+			Runs:      []ScheduleRun{{Tick: at, JobID: uuid.New()}},
+		}
+		if err := store.saveSchedule(schedule); err != nil {
+			t.Fatalf("saveSchedule = %v", err)
+		}
+		got, err := store.getSchedule(schedule.ScheduleID)
+		if err != nil || !reflect.DeepEqual(got, schedule) {
+			t.Errorf("getSchedule = %+v, %v, want %+v", got, err, schedule)
+		}
+		next := at.Add(24 * time.Hour)
+		err = store.updateSchedule(schedule.ScheduleID, func(schedule *Schedule) error {
+			schedule.LastTick = next
+			return nil
+		})
+		if got, _ = store.getSchedule(schedule.ScheduleID); err != nil || !got.LastTick.Equal(next) {
+			t.Errorf("updateSchedule = %v, last tick %s", err, got.LastTick)
+		}
+		if schedules, err := store.listSchedules(); err != nil || len(schedules) != 1 {
+			t.Errorf("listSchedules = %d schedules, %v, want 1", len(schedules), err)
+		}
+		if err = store.deleteSchedule(schedule.ScheduleID); err != nil {
+			t.Errorf("deleteSchedule = %v", err)
+		}
+		if _, err = store.getSchedule(schedule.ScheduleID); err != errScheduleNotFound {
+			t.Errorf("getSchedule of a deleted schedule = %v, want errScheduleNotFound", err)
+		}
+	})
+}
+
+func TestWebhookStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		at := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+		webhook := &Webhook{
+			WebhookID:      uuid.New(),
+			WebhookRequest: WebhookRequest{URL: "https://example.com/hooks", Statuses: []string{Completed}},
+			Tenant:         "acme",
+			CreatedAt:      at,
+		}
+		if err := store.saveWebhook(webhook); err != nil {
+			t.Fatalf("saveWebhook = %v", err)
+		}
+		if got, err := store.getWebhook(webhook.WebhookID); err != nil || !reflect.DeepEqual(got, webhook) {
+			t.Errorf("getWebhook = %+v, %v, want %+v", got, err, webhook)
+		}
+		if err := store.deleteWebhook(webhook.WebhookID); err != nil {
+			t.Errorf("deleteWebhook = %v", err)
+		}
+		if webhooks, err := store.listWebhooks(); err != nil || len(webhooks) != 0 {
+			t.Errorf("listWebhooks = %d webhooks, %v, want none", len(webhooks), err)
+		}
+		secret, err := store.webhookSecret(newWebhookSecret)
+		if err != nil || secret == "" {
+			t.Fatalf("webhookSecret = %q, %v, want a generated secret", secret, err)
+		}
+		if again, err := store.webhookSecret(newWebhookSecret); err != nil || again != secret {
+			t.Errorf("webhookSecret = %q, %v, want the saved secret %q", again, err, secret)
+		}
+	})
+}
+
+// TestWebhookSecretReopened checks that the generated webhook secret
+// is kept by the bolt store when the server restarts
+func TestWebhookSecretReopened(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secrets := []string{}
+	for i := 0; i < 2; i++ {
+		store, err := newBoltStore(filepath.Join(dir, "jobs.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret, err := store.webhookSecret(newWebhookSecret)
+		store.close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets = append(secrets, secret)
+	}
+	if secrets[0] != secrets[1] {
+		t.Errorf("secret after a restart = %q, want %q", secrets[1], secrets[0])
+	}
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		at := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+		key := &APIKey{KeyID: uuid.New(), Owner: "alice", Role: Submitter, Tenant: "acme", Hash: hashAPIKey("secret"), CreatedAt: at}
+		if err := store.saveAPIKey(key); err != nil {
+			t.Fatalf("saveAPIKey = %v", err)
+		}
+		if got, err := store.getAPIKey(hashAPIKey("secret")); err != nil || !reflect.DeepEqual(got, key) {
+			t.Errorf("getAPIKey = %+v, %v, want %+v", got, err, key)
+		}
+		if _, err := store.getAPIKey(hashAPIKey("other")); err != errAPIKeyNotFound {
+			t.Errorf("getAPIKey of another secret = %v, want errAPIKeyNotFound", err)
+		}
+		if err := store.deleteAPIKey(key.KeyID); err != nil {
+			t.Errorf("deleteAPIKey = %v", err)
+		}
+		if err := store.deleteAPIKey(key.KeyID); err != errAPIKeyNotFound {
+			t.Errorf("deleteAPIKey of a deleted key = %v, want errAPIKeyNotFound", err)
+		}
+	})
+}
+
+func TestLogStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		jobID := uuid.New()
+		tests := []struct {
+			lines int    // Lines appended in one batch
+			after uint64 // Sequence number listed after
+			first uint64 // First sequence number listed, 0 if none
+			count int
+		}{
+			{3, 0, 1, 3},
+			{2, 3, 4, 2},
+			{0, 5, 0, 0},
+			{maxJobLogLines, 0, 6, maxJobLogLines},
+			{10, maxJobLogLines, maxJobLogLines + 1, 15},
+		}
+		for _, test := range tests {
+			entries := make([]*LogEntry, test.lines)
+			for i := range entries {
+				entries[i] = &LogEntry{At: time.Now(), Level: InfoLevel, Message: "Line", Fields: map[string]interface{}{"i": float64(i)}}
+			}
+			if err := store.appendLogs(jobID, entries); err != nil {
+				t.Fatalf("appendLogs = %v", err)
+			}
+			listed, err := store.listLogs(jobID, test.after)
+			if err != nil {
+				t.Fatalf("listLogs = %v", err)
+			}
+			if len(listed) != test.count || test.count > 0 && listed[0].Seq != test.first {
+				t.Errorf("after appending %d lines, listLogs(%d) = %d lines, want %d from %d", test.lines, test.after, len(listed), test.count, test.first)
+			}
+			for i := 1; i < len(listed); i++ {
+				if listed[i].Seq != listed[i-1].Seq+1 {
+					t.Fatalf("listLogs returned seq %d after %d", listed[i].Seq, listed[i-1].Seq)
+				}
+			}
+		}
+		if listed, err := store.listLogs(uuid.New(), 0); err != nil || len(listed) != 0 {
+			t.Errorf("listLogs of another job = %d lines, %v, want none", len(listed), err)
+		}
+	})
+}
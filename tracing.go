@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the service in the exported spans, and of the tracer of the jobs
+const serviceName = "job-manager"
+
+// propagator propagates the span contexts in the W3C traceparent header,
+// between processes and to the jobs saved in the store
+var propagator = propagation.TraceContext{}
+
+// newTracerProvider returns the provider of the tracers exporting the
+// spans with the exporter of the given kind, otlp or file. Tracing is
+// disabled if kind is empty, the spans are then neither identified nor exported
+func newTracerProvider(kind string, endpoint string, headers string, path string) (trace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	switch kind {
+	case "":
+		return trace.NewNoopTracerProvider(), nil
+	case "otlp":
+		target, err := url.Parse(endpoint)
+		if err != nil || target.Host == "" {
+			return nil, errors.New("Invalid OTLP endpoint, expected an URL like http://localhost:4318: " + endpoint)
+		}
+		options := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(target.Host),
+			otlptracehttp.WithURLPath(strings.TrimSuffix(target.Path, "/") + "/v1/traces"),
+		}
+		if target.Scheme == "http" {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		if headers != "" {
+			values := make(map[string]string)
+			for _, item := range strings.Split(headers, ",") {
+				parts := strings.SplitN(item, "=", 2)
+				if len(parts) != 2 || parts[0] == "" {
+					return nil, errors.New("Invalid OTLP header, expected key=value: " + item)
+				}
+				values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+			options = append(options, otlptracehttp.WithHeaders(values))
+		}
+		// The exporter connects on the first export, it doesn't fail here
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+		if err != nil {
+			return nil, err
+		}
+	case "file":
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.New("Failed to open the trace file: " + err.Error())
+		}
+		if exporter, err = stdouttrace.New(stdouttrace.WithWriter(file)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Invalid trace exporter, expected otlp or file: " + kind)
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(traceResource())), nil
+}
+
+// traceResource describes the process emitting the spans
+func traceResource() *resource.Resource {
+	return resource.NewSchemaless(attribute.String("service.name", serviceName))
+}
+
+// traceparentOf returns the W3C traceparent header identifying
+// the span of ctx, empty if tracing is disabled
+func traceparentOf(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// contextWithTraceparent returns a context whose spans are children of the
+// span identified by the traceparent header, ctx if the header isn't valid
+func contextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
+
+// failSpan marks the span as failed with the error
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs/export"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// noParent is the span ID of the parent of the root spans in the trace file
+const noParent = "0000000000000000"
+
+// tracedSpan is a span read back from the trace file of the stdouttrace exporter
+type tracedSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+	SpanKind    int
+	StartTime   time.Time
+	EndTime     time.Time
+	Attributes  []struct {
+		Key   string
+		Value struct{ Value interface{} }
+	}
+	Status   struct{ Code, Description string }
+	Resource []struct {
+		Key   string
+		Value struct{ Value interface{} }
+	}
+	values map[string]interface{}
+}
+
+// newTraceFile returns a provider exporting the spans to a temporary
+// file with the file exporter, and the path of the file
+func newTraceFile(t *testing.T) (*sdktrace.TracerProvider, string) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "traces.jsonl")
+	traces, err := newTracerProvider("file", "", "", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := traces.(*sdktrace.TracerProvider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return provider, path
+}
+
+// readTrace flushes the ended spans of the provider until
+// count spans are written to the file and returns them by name
+func readTrace(t *testing.T, provider *sdktrace.TracerProvider, path string, count int) map[string][]tracedSpan {
+	var spans []tracedSpan
+	for end := time.Now().Add(10 * time.Second); len(spans) < count && time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if err := provider.ForceFlush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans = nil
+		decoder := json.NewDecoder(file)
+		for {
+			var s tracedSpan
+			if err := decoder.Decode(&s); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("trace file isn't a list of JSON spans: %v", err)
+			}
+			spans = append(spans, s)
+		}
+		file.Close()
+	}
+	byName := make(map[string][]tracedSpan)
+	names := []string{}
+	for _, s := range spans {
+		s.values = make(map[string]interface{})
+		for _, attribute := range s.Attributes {
+			s.values[attribute.Key] = attribute.Value.Value
+		}
+		resource := map[string]interface{}{}
+		for _, attribute := range s.Resource {
+			resource[attribute.Key] = attribute.Value.Value
+		}
+		if resource["service.name"] != serviceName {
+			t.Errorf("%s resource = %v, want the service.name", s.Name, resource)
+		}
+		byName[s.Name] = append(byName[s.Name], s)
+		names = append(names, s.Name)
+	}
+	if len(spans) != count {
+		t.Fatalf("spans = %v, want %d spans", names, count)
+	}
+	return byName
+}
+
+// TestJobTrace runs an export job traced with the file exporter and checks
+// the tree of its spans: the submit span is the parent of the wait
+// in the queue and of the run, which is the parent of the export steps
+func TestJobTrace(t *testing.T) {
+	_, restore := exportEnv(t, "acme")
+	defer restore()
+	provider, path := newTraceFile(t)
+
+	store := newMemoryStore()
+	manager := newTracedManager(t, store, 1, provider)
+	record := newJobRecord(uuid.New(), &JobRequest{Type: export.Name, Args: map[string]interface{}{
+		"from_date": "2021-Jan-01", "to_date": "2021-Jan-04", "table": "responses", "format": export.CSVFormat,
+	}}, "alice", "acme")
+	if err := manager.submit(record); err != nil {
+		t.Fatal(err)
+	}
+
+	// job.submit, job.queue_wait, job.run, two export.day and export.save
+	spans := readTrace(t, provider, path, 6)
+	if saved, err := store.get(record.JobID); err != nil || saved.Status != Completed {
+		t.Fatalf("job = %+v, %v, want it completed", saved, err)
+	}
+	counts := make(map[string]int)
+	for name, list := range spans {
+		counts[name] = len(list)
+	}
+	want := map[string]int{"job.submit": 1, "job.queue_wait": 1, "job.run": 1, "export.day": 2, "export.save": 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Fatalf("spans = %v, want %v", counts, want)
+	}
+	submit, run := spans["job.submit"][0], spans["job.run"][0]
+	parents := map[string]string{
+		"job.submit":     noParent,
+		"job.queue_wait": submit.SpanContext.SpanID,
+		"job.run":        submit.SpanContext.SpanID,
+		"export.day":     run.SpanContext.SpanID,
+		"export.save":    run.SpanContext.SpanID,
+	}
+	for name, list := range spans {
+		for _, s := range list {
+			if s.SpanContext.TraceID != submit.SpanContext.TraceID {
+				t.Errorf("%s trace = %s, want %s", name, s.SpanContext.TraceID, submit.SpanContext.TraceID)
+			}
+			if s.Parent.SpanID != parents[name] {
+				t.Errorf("%s parent = %q, want %q", name, s.Parent.SpanID, parents[name])
+			}
+			if s.SpanKind != int(trace.SpanKindInternal) || s.Status.Code != "Unset" {
+				t.Errorf("%s kind = %d, status = %+v, want an internal span without error", name, s.SpanKind, s.Status)
+			}
+			if s.StartTime.IsZero() || s.EndTime.Before(s.StartTime) {
+				t.Errorf("%s ends at %s before its start at %s", name, s.EndTime, s.StartTime)
+			}
+			if name != "export.day" && name != "export.save" && s.values["job.id"] != record.JobID.String() {
+				t.Errorf("%s job.id = %v, want %s", name, s.values["job.id"], record.JobID)
+			}
+		}
+	}
+	if record.TraceParent != "00-"+submit.SpanContext.TraceID+"-"+submit.SpanContext.SpanID+"-01" {
+		t.Errorf("record traceparent = %s, want the submit span", record.TraceParent)
+	}
+
+	// JSON numbers are decoded as float64
+	attributes := []struct {
+		span   tracedSpan
+		values map[string]interface{}
+	}{
+		{submit, map[string]interface{}{"job.id": record.JobID.String(), "job.type": export.Name, "job.tenant": "acme"}},
+		{spans["job.queue_wait"][0], map[string]interface{}{"job.id": record.JobID.String(), "job.type": export.Name}},
+		{run, map[string]interface{}{"job.id": record.JobID.String(), "job.type": export.Name, "job.attempt": float64(1), "job.status": Completed}},
+		{spans["export.save"][0], map[string]interface{}{"export.format": export.CSVFormat}},
+	}
+	for _, test := range attributes {
+		if !reflect.DeepEqual(test.span.values, test.values) {
+			t.Errorf("%s attributes = %v, want %v", test.span.Name, test.span.values, test.values)
+		}
+	}
+	days := map[string]interface{}{}
+	for _, day := range spans["export.day"] {
+		days[day.values["export.date"].(string)] = day.values["export.rows"]
+		if day.values["export.format"] != export.CSVFormat {
+			t.Errorf("export.day format = %v, want %s", day.values["export.format"], export.CSVFormat)
+		}
+	}
+	if want := map[string]interface{}{"2021-Jan-02": float64(3), "2021-Jan-03": float64(1)}; !reflect.DeepEqual(days, want) {
+		t.Errorf("rows by export.day = %v, want %v", days, want)
+	}
+}
+
+// TestRequestTrace submits a job with a traceparent header and checks
+// that the server span of the request continues the trace of the
+// caller and is the parent of the submit span of the job
+func TestRequestTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider, path := newTraceFile(t)
+	store := newMemoryStore()
+	manager := newTracedManager(t, store, 0, provider)
+	server := httptest.NewServer(initRouter(manager, &scheduleRunner{store: store, manager: manager}, manager.webhooks, &authenticator{store: store}))
+	defer server.Close()
+	key, secret, err := newAPIKey(&APIKeyRequest{Owner: "alice", Role: Submitter}, "")
+	if err == nil {
+		err = store.saveAPIKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traceID, callerID := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/submit", strings.NewReader(`{"Type": "`+simple.Name+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", secret)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+callerID+"-01")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("submit status = %d, want 200", res.StatusCode)
+	}
+
+	spans := readTrace(t, provider, path, 2)
+	request, submit := spans["/submit"], spans["job.submit"]
+	if len(request) != 1 || len(submit) != 1 {
+		t.Fatalf("spans = %v, want the request and its job.submit", spans)
+	}
+	if request[0].SpanContext.TraceID != traceID || request[0].Parent.SpanID != callerID {
+		t.Errorf("request span = %+v, want a child of the caller span", request[0].SpanContext)
+	}
+	if request[0].SpanKind != int(trace.SpanKindServer) || request[0].values["http.route"] != "/submit" || request[0].values["http.status_code"] != float64(http.StatusOK) {
+		t.Errorf("request span kind = %d, attributes = %v, want a server span of /submit", request[0].SpanKind, request[0].values)
+	}
+	if submit[0].SpanContext.TraceID != traceID || submit[0].Parent.SpanID != request[0].SpanContext.SpanID {
+		t.Errorf("submit span = %+v, parent %s, want a child of the request span", submit[0].SpanContext, submit[0].Parent.SpanID)
+	}
+	records, err := store.list()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("records = %v, %v, want the submitted job", records, err)
+	}
+	if details, err := manager.jobDetails(records[0]); err != nil || details["trace_id"] != traceID {
+		t.Errorf("details = %v, %v, want the trace_id %s", details, err, traceID)
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status of the webhook deliveries
+const (
+	DeliveryPending   string = "pending"   // Waiting for its next attempt
+	DeliveryDelivered string = "delivered" // Receiver answered with a 2xx status
+	DeliveryFailed    string = "failed"    // Every attempt failed
+)
+
+const (
+	webhookTimeout   = 10 * time.Second // Maximum time for the receiver to answer
+	webhookWorkers   = 4                // Number of deliveries sent at once
+	maxJobDeliveries = 100              // Number of deliveries kept in the log of a job
+)
+
+// webhookAllowPrivate allows the payloads to be sent to the loopback, link-local and private
+// addresses, which are refused by default as the URLs are chosen by the API users
+var webhookAllowPrivate = false
+
+// webhookRetry is the retry policy of the webhook deliveries,
+// the last attempt is made about half an hour after the transition
+var webhookRetry = &RetryPolicy{
+	MaxAttempts: 8,
+	Backoff:     "1s",
+	MaxBackoff:  "10m",
+	Multiplier:  4,
+	Jitter:      0.1,
+}
+
+// WebhookRequest represents the request to subscribe to the transitions of every job
+// Secret signs the payloads, the secret of the server is used if empty
+// Statuses are the statuses of the transitions sent, every transition is sent if empty
+type WebhookRequest struct {
+	URL      string   `json:"url" example:"https://example.com/hooks/jobs"`
+	Secret   string   `json:"secret,omitempty" example:"s3cr3t"`
+	Statuses []string `json:"statuses" example:"Completed,Failed"`
+}
+
+// Webhook is a subscription to the transitions of the jobs of a tenant,
+// its secret is never returned by the API
+type Webhook struct {
+	WebhookID uuid.UUID `json:"webhookID" example:"3f1c2b9e-6a0d-4c55-9d2e-8b7a1f4e5c6d"`
+	WebhookRequest
+	Tenant    string    `json:"tenant,omitempty" example:"acme"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookPayload is the JSON body sent for a transition of a job
+type WebhookPayload struct {
+	DeliveryID uuid.UUID         `json:"deliveryID"`
+	Event      string            `json:"event" example:"transition"`
+	JobID      uuid.UUID         `json:"jobID"`
+	Type       string            `json:"type" example:"Export"`
+	From       string            `json:"from" example:"Running"`
+	Status     string            `json:"status" example:"Completed"`
+	Error      string            `json:"error,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	At         time.Time         `json:"at"`
+}
+
+// Delivery records the delivery of a transition to a webhook or to the callback URL of the job
+type Delivery struct {
+	DeliveryID    uuid.UUID         `json:"deliveryID"`
+	WebhookID     *uuid.UUID        `json:"webhookID,omitempty"` // Nil for the callback URL of the job
+	URL           string            `json:"url"`
+	Payload       json.RawMessage   `json:"payload"`
+	Status        string            `json:"status"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Attempts      []DeliveryAttempt `json:"attempts"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+}
+
+// DeliveryAttempt records an attempt to deliver a payload
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// pendingDelivery is a delivery waiting for its next attempt
+type pendingDelivery struct {
+	jobID    uuid.UUID
+	delivery Delivery
+	inFlight bool
+}
+
+// webhookDispatcher delivers the job transitions to the webhooks and the
+// callback URLs of the jobs. Deliveries are saved in the job records along with
+// the transitions, so pending deliveries are sent again after a restart
+type webhookDispatcher struct {
+	store  Store
+	secret string // Signs the payloads of the callback URLs and the webhooks without secret
+	client *http.Client
+
+	mu       sync.Mutex
+	webhooks map[uuid.UUID]*Webhook
+	pending  map[uuid.UUID]*pendingDelivery // Pending deliveries by deliveryID
+	wake     chan struct{}
+	done     chan struct{} // Closed by stop to end the loop
+	stopped  chan struct{} // Closed once the loop ended
+}
+
+// newWebhookDispatcher returns the dispatcher signing the payloads with the secret,
+// which is required as no payload is ever sent unsigned
+func newWebhookDispatcher(store Store, secret string) (*webhookDispatcher, error) {
+	if secret == "" {
+		return nil, errors.New("A secret is required to sign the webhook payloads")
+	}
+	dispatcher := &webhookDispatcher{
+		store:    store,
+		secret:   secret,
+		client:   newWebhookClient(),
+		webhooks: make(map[uuid.UUID]*Webhook),
+		pending:  make(map[uuid.UUID]*pendingDelivery),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	webhooks, err := store.listWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		dispatcher.webhooks[webhook.WebhookID] = webhook
+	}
+	records, err := store.list()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		dispatcher.enqueue(record.JobID, record.Deliveries)
+	}
+	go dispatcher.loop()
+	return dispatcher, nil
+}
+
+// newWebhookSecret returns a random secret signing the payloads,
+// used when the server isn't given one
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// newWebhookClient returns the client sending the payloads. The addresses are checked
+// once resolved, when dialing, so that neither a DNS name nor a redirect can reach
+// an internal address. Proxies are ignored as they would dial in place of the client
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: controlWebhookDial}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: webhookWorkers,
+		},
+	}
+}
+
+// controlWebhookDial refuses the connections to the internal addresses
+func controlWebhookDial(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+		return errors.New("Refused to send the payload to the internal address: " + host)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the 100.64.0.0/10 range of the carrier-grade NATs,
+// which net.IP.IsPrivate doesn't report (RFC 6598)
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isInternalIP returns true if the address isn't a public unicast address,
+// unless the internal addresses are allowed
+func isInternalIP(ip net.IP) bool {
+	if webhookAllowPrivate {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// validateWebhookURL checks that the URL can receive the payloads, the URLs naming
+// an internal address are refused here while the DNS names are checked when dialing
+func validateWebhookURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Invalid webhook URL: " + value)
+	}
+	internal := u.Hostname() == "localhost" && !webhookAllowPrivate
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		internal = isInternalIP(ip)
+	}
+	if internal {
+		return errors.New("Invalid webhook URL, internal addresses are not allowed: " + value)
+	}
+	return nil
+}
+
+func newWebhook(webhookRequest *WebhookRequest, tenant string) (*Webhook, error) {
+	if err := validateWebhookURL(webhookRequest.URL); err != nil {
+		return nil, err
+	}
+	for _, status := range webhookRequest.Statuses {
+		if _, ok := stateTransitions[status]; !ok {
+			return nil, errors.New("Invalid webhook status: " + status)
+		}
+	}
+	return &Webhook{
+		WebhookID:      uuid.New(),
+		WebhookRequest: *webhookRequest,
+		Tenant:         tenant,
+		CreatedAt:      time.Now(),
+	}, nil
+}
+
+// subscribe saves the webhook, it receives the following transitions
+func (dispatcher *webhookDispatcher) subscribe(webhook *Webhook) error {
+	if err := dispatcher.store.saveWebhook(webhook); err != nil {
+		return err
+	}
+	dispatcher.mu.Lock()
+	dispatcher.webhooks[webhook.WebhookID] = webhook
+	dispatcher.mu.Unlock()
+	return nil
+}
+
+// unsubscribe removes the webhook, its pending deliveries fail
+func (dispatcher *webhookDispatcher) unsubscribe(webhookID uuid.UUID) error {
+	if err := dispatcher.store.deleteWebhook(webhookID); err != nil {
+		return err
+	}
+	dispatcher.mu.Lock()
+	delete(dispatcher.webhooks, webhookID)
+	dispatcher.mu.Unlock()
+	return nil
+}
+
+// list returns the webhooks of the tenant sorted by creation time, without their secret
+func (dispatcher *webhookDispatcher) list(tenant string) []Webhook {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	webhooks := make([]Webhook, 0, len(dispatcher.webhooks))
+	for _, webhook := range dispatcher.webhooks {
+		if tenantOf(webhook.Tenant) == tenant {
+			webhooks = append(webhooks, webhook.public())
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks
+}
+
+// public returns a copy of the webhook without its secret
+func (webhook Webhook) public() Webhook {
+	webhook.Secret = ""
+	return webhook
+}
+
+func (webhook *Webhook) match(status string) bool {
+	if len(webhook.Statuses) == 0 {
+		return true
+	}
+	for _, s := range webhook.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// deliveries creates the deliveries of the transition of the job
+// to its callback URL and the matching webhooks of its tenant
+func (dispatcher *webhookDispatcher) deliveries(record *JobRecord, from string, change statusChange) []Delivery {
+	now := time.Now()
+	newDelivery := func(webhookID *uuid.UUID, target string) Delivery {
+		delivery := Delivery{
+			DeliveryID:    uuid.New(),
+			WebhookID:     webhookID,
+			URL:           target,
+			Status:        DeliveryPending,
+			CreatedAt:     now,
+			Attempts:      []DeliveryAttempt{},
+			NextAttemptAt: &now,
+		}
+		payload := WebhookPayload{
+			DeliveryID: delivery.DeliveryID,
+			Event:      "transition",
+			JobID:      record.JobID,
+			Type:       record.Type,
+			From:       from,
+			Status:     change.status,
+			Labels:     record.Labels,
+			At:         now,
+		}
+		if change.err != nil {
+			payload.Error = change.err.Error()
+		}
+		delivery.Payload, _ = json.Marshal(payload)
+		return delivery
+	}
+
+	deliveries := []Delivery{}
+	if record.CallbackURL != "" {
+		deliveries = append(deliveries, newDelivery(nil, record.CallbackURL))
+	}
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	for _, webhook := range dispatcher.webhooks {
+		if tenantOf(webhook.Tenant) == tenantOf(record.Tenant) && webhook.match(change.status) {
+			webhookID := webhook.WebhookID
+			deliveries = append(deliveries, newDelivery(&webhookID, webhook.URL))
+		}
+	}
+	return deliveries
+}
+
+// addDeliveries appends the deliveries to the log of the job,
+// dropping the oldest finished deliveries beyond maxJobDeliveries
+func (record *JobRecord) addDeliveries(deliveries []Delivery) {
+	record.Deliveries = append(record.Deliveries, deliveries...)
+	for i := 0; len(record.Deliveries) > maxJobDeliveries && i < len(record.Deliveries); {
+		if record.Deliveries[i].Status == DeliveryPending {
+			i++
+			continue
+		}
+		record.Deliveries = append(record.Deliveries[:i], record.Deliveries[i+1:]...)
+	}
+}
+
+// enqueue schedules the pending deliveries of the job, once saved
+func (dispatcher *webhookDispatcher) enqueue(jobID uuid.UUID, deliveries []Delivery) {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	for _, delivery := range deliveries {
+		if delivery.Status == DeliveryPending {
+			dispatcher.pending[delivery.DeliveryID] = &pendingDelivery{jobID: jobID, delivery: delivery}
+		}
+	}
+	dispatcher.notify()
+}
+
+// notify wakes up the dispatcher loop
+func (dispatcher *webhookDispatcher) notify() {
+	select {
+	case dispatcher.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop sends the due deliveries whenever deliveries are enqueued
+// and every second for the retries, until the dispatcher is stopped
+func (dispatcher *webhookDispatcher) loop() {
+	defer close(dispatcher.stopped)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dispatcher.wake:
+		case <-ticker.C:
+		case <-dispatcher.done:
+			return
+		}
+		dispatcher.dispatch()
+	}
+}
+
+// stop ends the loop and waits for it. The deliveries in flight are
+// left to finish, the pending ones are sent again after a restart
+func (dispatcher *webhookDispatcher) stop() {
+	close(dispatcher.done)
+	<-dispatcher.stopped
+}
+
+// dispatch starts sending the due deliveries, in the order of their
+// creation, while fewer than webhookWorkers deliveries are in flight
+func (dispatcher *webhookDispatcher) dispatch() {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	now := time.Now()
+	inFlight := 0
+	due := []*pendingDelivery{}
+	for _, pending := range dispatcher.pending {
+		if pending.inFlight {
+			inFlight++
+		} else if !now.Before(*pending.delivery.NextAttemptAt) {
+			due = append(due, pending)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].delivery.CreatedAt.Before(due[j].delivery.CreatedAt)
+	})
+	for _, pending := range due {
+		if inFlight >= webhookWorkers {
+			return
+		}
+		inFlight++
+		pending.inFlight = true
+		secret, ok := dispatcher.signingSecret(pending.delivery)
+		go dispatcher.deliver(pending.jobID, pending.delivery, secret, ok)
+	}
+}
+
+// signingSecret returns the secret of the delivery, false if its webhook
+// was deleted. dispatcher.mu must be held
+func (dispatcher *webhookDispatcher) signingSecret(delivery Delivery) (string, bool) {
+	if delivery.WebhookID == nil {
+		return dispatcher.secret, true
+	}
+	webhook, ok := dispatcher.webhooks[*delivery.WebhookID]
+	if !ok {
+		return "", false
+	}
+	if webhook.Secret != "" {
+		return webhook.Secret, true
+	}
+	return dispatcher.secret, true
+}
+
+// deliver makes an attempt to send the delivery and records it,
+// the delivery is retried with backoff until webhookRetry is exhausted.
+// Deliveries of deleted webhooks fail without being sent
+func (dispatcher *webhookDispatcher) deliver(jobID uuid.UUID, delivery Delivery, secret string, subscribed bool) {
+	attempt := DeliveryAttempt{At: time.Now()}
+	var err error
+	if subscribed {
+		err = dispatcher.send(delivery, secret, &attempt)
+	} else {
+		attempt.Error = "Webhook deleted"
+	}
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.NextAttemptAt = nil
+	if !subscribed {
+		delivery.Status = DeliveryFailed
+	} else if err == nil {
+		delivery.Status = DeliveryDelivered
+	} else if delay, ok := webhookRetry.retryDelay(len(delivery.Attempts), err); ok {
+		next := time.Now().Add(delay)
+		delivery.NextAttemptAt = &next
+		log.Printf("Failed to deliver the webhook: %s, retrying in %s\nError: %s", delivery.DeliveryID.String(), delay.Round(time.Second), err.Error())
+	} else {
+		delivery.Status = DeliveryFailed
+		log.Printf("Failed to deliver the webhook: %s, giving up\nError: %s", delivery.DeliveryID.String(), err.Error())
+	}
+
+	err = dispatcher.store.update(jobID, func(record *JobRecord) error {
+		for i := range record.Deliveries {
+			if record.Deliveries[i].DeliveryID == delivery.DeliveryID {
+				record.Deliveries[i] = delivery
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errJobNotFound {
+		log.Printf("Failed to save the webhook delivery: %s\nError: %s", delivery.DeliveryID.String(), err.Error())
+	}
+
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	if delivery.Status == DeliveryPending && err != errJobNotFound {
+		dispatcher.pending[delivery.DeliveryID] = &pendingDelivery{jobID: jobID, delivery: delivery}
+	} else {
+		delete(dispatcher.pending, delivery.DeliveryID)
+	}
+	dispatcher.notify()
+}
+
+// send posts the payload of the delivery, signed with the secret.
+// The signature is the hex encoded HMAC-SHA256 of the timestamp
+// and the payload joined by a dot
+func (dispatcher *webhookDispatcher) send(delivery Delivery, secret string, attempt *DeliveryAttempt) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return err
+	}
+	timestamp := strconv.FormatInt(attempt.At.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", delivery.DeliveryID.String())
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+sign(secret, timestamp, delivery.Payload))
+	res, err := dispatcher.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return err
+	}
+	res.Body.Close()
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		err = fmt.Errorf("Webhook receiver answered %s", res.Status)
+		attempt.Error = err.Error()
+		return err
+	}
+	return nil
+}
+
+func sign(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/hooks", true},
+		{"http://93.184.216.34:8080/hooks", true},
+		{"ftp://example.com/hooks", false},
+		{"https:///hooks", false},
+		{"http://localhost/hooks", false},
+		{"http://127.0.0.1/hooks", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.1/hooks", false},
+		{"http://172.16.3.4/hooks", false},
+		{"http://192.168.1.1/hooks", false},
+		{"http://100.64.0.1/hooks", false},
+		{"http://100.127.255.254/hooks", false},
+		{"http://100.128.0.1/hooks", true},
+		{"http://[::ffff:100.100.100.200]/hooks", false},
+		{"http://0.0.0.0/hooks", false},
+		{"http://[::1]/hooks", false},
+		{"http://[fe80::1]/hooks", false},
+		{"http://[fd00::1]/hooks", false},
+		{"http://[::ffff:127.0.0.1]/hooks", false},
+	}
+	for _, test := range tests {
+		if err := validateWebhookURL(test.url); (err == nil) != test.valid {
+			t.Errorf("validateWebhookURL(%q) = %v, want valid %v", test.url, err, test.valid)
+		}
+	}
+}
+
+func TestValidateWebhookURLAllowPrivate(t *testing.T) {
+	webhookAllowPrivate = true
+	defer func() { webhookAllowPrivate = false }()
+	for _, url := range []string{"http://localhost/hooks", "http://10.0.0.1/hooks"} {
+		if err := validateWebhookURL(url); err != nil {
+			t.Errorf("validateWebhookURL(%q) = %v, want nil", url, err)
+		}
+	}
+}
+
+func TestControlWebhookDial(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1::]:443", true},
+		{"127.0.0.1:80", false},
+		{"169.254.169.254:80", false},
+		{"10.1.2.3:443", false},
+		{"100.100.100.200:80", false},
+		{"100.63.255.255:443", true},
+		{"[::1]:80", false},
+		{"[::]:80", false},
+		{"224.0.0.1:80", false},
+	}
+	for _, test := range tests {
+		if err := controlWebhookDial("tcp", test.address, nil); (err == nil) != test.allowed {
+			t.Errorf("controlWebhookDial(%q) = %v, want allowed %v", test.address, err, test.allowed)
+		}
+	}
+}
+
+// TestWebhookClientRefusesInternal checks that the addresses resolved from a name are checked
+func TestWebhookClientRefusesInternal(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	res, err := newWebhookClient().Get("http://localhost:" + port + "/hooks")
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("expected the request to localhost to be refused")
+	}
+}
+
+// TestWebhookSignature checks that every payload is signed,
+// with the secret of its webhook or the secret of the server
+func TestWebhookSignature(t *testing.T) {
+	if _, err := newWebhookDispatcher(newMemoryStore(), ""); err == nil {
+		t.Error("newWebhookDispatcher without secret succeeded, want an error")
+	}
+	signatures := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures <- r.Header.Get("X-Webhook-Signature")
+	}))
+	defer server.Close()
+	dispatcher, err := newWebhookDispatcher(newMemoryStore(), "server secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dispatcher.stop)
+	dispatcher.client = server.Client()
+	webhookID := uuid.New()
+	dispatcher.webhooks[webhookID] = &Webhook{WebhookID: webhookID, WebhookRequest: WebhookRequest{URL: server.URL, Secret: "own secret"}}
+	otherID := uuid.New()
+	dispatcher.webhooks[otherID] = &Webhook{WebhookID: otherID, WebhookRequest: WebhookRequest{URL: server.URL}}
+	tests := []struct {
+		name      string
+		webhookID *uuid.UUID
+		secret    string
+	}{
+		{"callback", nil, "server secret"},
+		{"webhook with a secret", &webhookID, "own secret"},
+		{"webhook without secret", &otherID, "server secret"},
+	}
+	for _, test := range tests {
+		delivery := Delivery{DeliveryID: uuid.New(), WebhookID: test.webhookID, URL: server.URL, Payload: []byte(`{"event":"transition"}`)}
+		dispatcher.mu.Lock()
+		secret, _ := dispatcher.signingSecret(delivery)
+		dispatcher.mu.Unlock()
+		attempt := DeliveryAttempt{At: time.Unix(1609556645, 0)}
+		if err := dispatcher.send(delivery, secret, &attempt); err != nil {
+			t.Fatalf("%s: send = %v", test.name, err)
+		}
+		want := "sha256=" + sign(test.secret, "1609556645", delivery.Payload)
+		if got := <-signatures; got != want {
+			t.Errorf("%s: signature = %q, want %q", test.name, got, want)
+		}
+	}
+}
+
+// TestWebhookRetries checks that a delivery is retried with backoff while the
+// receiver fails, and that its attempts are saved in the job record
+func TestWebhookRetries(t *testing.T) {
+	defer func(policy *RetryPolicy) { webhookRetry = policy }(webhookRetry)
+	webhookRetry = &RetryPolicy{MaxAttempts: 4, Backoff: "100ms", Multiplier: 4}
+
+	var mu sync.Mutex
+	var received []time.Time
+	statuses := []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(statuses[len(received)])
+		received = append(received, time.Now())
+	}))
+	defer server.Close()
+
+	store := newMemoryStore()
+	dispatcher, err := newWebhookDispatcher(store, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dispatcher.stop)
+	dispatcher.client = server.Client()
+	record := &JobRecord{JobID: uuid.New(), Type: simple.Name, Status: Completed, CallbackURL: server.URL}
+	deliveries := dispatcher.deliveries(record, Running, statusChange{status: Completed})
+	record.addDeliveries(deliveries)
+	if err = store.save(record); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.enqueue(record.JobID, deliveries)
+
+	var delivery Delivery
+	for end := time.Now().Add(10 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		saved, err := store.get(record.JobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivery = saved.Deliveries[0]; delivery.Status != DeliveryPending {
+			break
+		}
+	}
+	if delivery.Status != DeliveryDelivered || delivery.NextAttemptAt != nil {
+		t.Fatalf("delivery = %s, next attempt %v, want %s", delivery.Status, delivery.NextAttemptAt, DeliveryDelivered)
+	}
+	if len(delivery.Attempts) != len(statuses) {
+		t.Fatalf("attempts = %+v, want %d", delivery.Attempts, len(statuses))
+	}
+	for i, attempt := range delivery.Attempts {
+		if attempt.StatusCode != statuses[i] || (attempt.Error == "") != (statuses[i] == http.StatusOK) {
+			t.Errorf("attempt %d = %+v, want status %d", i+1, attempt, statuses[i])
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// Backoff of 100ms then 400ms, within the 10% of slack of the timers
+	for i, backoff := range []time.Duration{100 * time.Millisecond, 400 * time.Millisecond} {
+		if gap := received[i+1].Sub(received[i]); gap < backoff*9/10 {
+			t.Errorf("retry %d sent after %s, want a backoff of %s", i+1, gap, backoff)
+		}
+	}
+}
+
+// TestDispatcherStop checks that the loop of a stopped dispatcher
+// ends, and that it sends no delivery afterwards
+func TestDispatcherStop(t *testing.T) {
+	sent := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent <- struct{}{}
+	}))
+	defer server.Close()
+	store := newMemoryStore()
+	dispatcher, err := newWebhookDispatcher(store, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.client = server.Client()
+	stopped := make(chan struct{})
+	go func() {
+		dispatcher.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher loop not stopped")
+	}
+
+	record := &JobRecord{JobID: uuid.New(), Type: simple.Name, Status: Completed, CallbackURL: server.URL}
+	deliveries := dispatcher.deliveries(record, Running, statusChange{status: Completed})
+	record.addDeliveries(deliveries)
+	if err = store.save(record); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.enqueue(record.JobID, deliveries)
+	// Past the tick of the loop
+	select {
+	case <-sent:
+		t.Error("delivery sent by a stopped dispatcher")
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+// TestAddDeliveries checks that the oldest finished deliveries are dropped
+// beyond maxJobDeliveries, while the pending ones are kept
+func TestAddDeliveries(t *testing.T) {
+	delivery := func(n int, status string) Delivery {
+		return Delivery{DeliveryID: uuid.New(), Status: status, CreatedAt: time.Unix(int64(n), 0)}
+	}
+	record := &JobRecord{}
+	record.addDeliveries([]Delivery{delivery(0, DeliveryPending)})
+	for n := 1; n < maxJobDeliveries; n++ {
+		record.addDeliveries([]Delivery{delivery(n, DeliveryDelivered)})
+	}
+	if len(record.Deliveries) != maxJobDeliveries {
+		t.Fatalf("deliveries = %d, want %d", len(record.Deliveries), maxJobDeliveries)
+	}
+	record.addDeliveries([]Delivery{delivery(maxJobDeliveries, DeliveryFailed), delivery(maxJobDeliveries+1, DeliveryPending)})
+	if len(record.Deliveries) != maxJobDeliveries {
+		t.Fatalf("deliveries = %d, want %d", len(record.Deliveries), maxJobDeliveries)
+	}
+	first, second, last := record.Deliveries[0], record.Deliveries[1], record.Deliveries[maxJobDeliveries-1]
+	if first.CreatedAt.Unix() != 0 || second.CreatedAt.Unix() != 3 || last.CreatedAt.Unix() != maxJobDeliveries+1 {
+		t.Errorf("deliveries kept from %d, %d to %d, want the pending 0 then 3 to %d",
+			first.CreatedAt.Unix(), second.CreatedAt.Unix(), last.CreatedAt.Unix(), maxJobDeliveries+1)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Types of the frames sent on the control channel
+const (
+	AckFrame   string = "ack"   // Command succeeded
+	ErrorFrame string = "error" // Command failed
+	EventFrame string = "event" // Event of a subscribed job
+	LogFrame   string = "log"   // Log line of a subscribed job
+)
+
+const (
+	wsPingInterval = 30 * time.Second   // Delay between the pings keeping the connection open
+	wsReadTimeout  = 2 * wsPingInterval // Connection is closed if the client doesn't answer the pings
+	wsWriteTimeout = 10 * time.Second   // Maximum time to write a frame
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// ControlMessage represents a command sent by a client on the control channel
+// Op is one of subscribe, unsubscribe, halt, resume or stop
+// JobIDs are the jobs to subscribe or unsubscribe to
+// JobID is the job to halt, resume or stop
+// ID is echoed in the acknowledgement or the error of the command
+type ControlMessage struct {
+	ID     string   `json:"id" example:"1"`
+	Op     string   `json:"op" example:"halt"`
+	JobIDs []string `json:"jobIDs,omitempty"`
+	JobID  string   `json:"jobID,omitempty" example:"55e75f6c-24f8-49b5-9e62-a268db7370e9"`
+
+	invalid bool // Message isn't valid JSON
+}
+
+// ControlFrame represents a frame sent to a client on the control channel
+type ControlFrame struct {
+	Type  string    `json:"type" example:"ack"`
+	ID    string    `json:"id,omitempty" example:"1"`
+	JobID string    `json:"jobID,omitempty" example:"55e75f6c-24f8-49b5-9e62-a268db7370e9"`
+	Error string    `json:"error,omitempty"`
+	Event *Event    `json:"event,omitempty"`
+	Log   *LogEntry `json:"log,omitempty"`
+}
+
+// controlChannel is a WebSocket connection of a client, which receives
+// the events and the log lines of the jobs it subscribed to and controls
+// jobs with the same code as the HTTP routes. Frames are only written by
+// the goroutine running serve, as the connection supports a single writer
+type controlChannel struct {
+	manager   *JobManager
+	principal *Principal // User who opened the channel
+	conn      *websocket.Conn
+	jobs      map[uuid.UUID]*followedLog // Subscribed jobs along with their log subscription
+	lastID    uint64                     // ID of the last event received from the bus
+	messages  chan ControlMessage
+	lines     chan logLine // Log lines of the subscribed jobs, passed to serve
+	quit      chan struct{}
+}
+
+// followedLog is the log subscription of a subscribed job
+type followedLog struct {
+	sub     *logSubscription // Nil once the job ended
+	lastSeq uint64           // Sequence number of the last line received
+}
+
+// logLine is a log line received by a log subscription,
+// entry is nil once the subscription is closed
+type logLine struct {
+	sub   *logSubscription
+	entry *LogEntry
+}
+
+// controlSocket godoc
+// @Summary Open a WebSocket control channel to subscribe to and control jobs
+// @Description Job processing backend API for Atlan Collect
+// @Description Clients send ControlMessage frames and receive ControlFrame frames
+// @ID control-socket
+// @Success 101 {object} main.ControlFrame
+// @Failure 401 {object} main.httpError
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /ws [get]
+func (manager *JobManager) controlSocket(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already responded with the error
+		log.Println("Failed to open the control channel: ", err.Error())
+		return
+	}
+	channel := &controlChannel{
+		manager:   manager,
+		principal: principalOf(c),
+		conn:      conn,
+		jobs:      make(map[uuid.UUID]*followedLog),
+		messages:  make(chan ControlMessage),
+		lines:     make(chan logLine),
+		quit:      make(chan struct{}),
+	}
+	channel.serve()
+}
+
+// serve handles the connection until it is closed.
+// quit is closed once serve exits, so that read
+// and the log followers stop too
+func (channel *controlChannel) serve() {
+	defer channel.conn.Close()
+	closed := make(chan struct{})
+	defer close(channel.quit)
+	defer func() {
+		for _, followed := range channel.jobs {
+			if followed.sub != nil {
+				channel.manager.logs.unsubscribe(followed.sub)
+			}
+		}
+	}()
+	go channel.read(closed, channel.quit)
+
+	// Only the events following the connection are sent
+	sub := channel.manager.events.subscribe(uuid.Nil, channel.principal.Tenant)
+	channel.lastID = sub.after
+	defer func() { channel.manager.events.unsubscribe(sub) }()
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+		case message := <-channel.messages:
+			err = channel.write(channel.handle(message))
+		case event, ok := <-sub.events:
+			if !ok {
+				// Dropped for lagging behind, resume after the last event received
+				var missed []Event
+				missed, sub = channel.manager.events.resume(uuid.Nil, channel.principal.Tenant, channel.lastID)
+				for i := 0; i < len(missed) && err == nil; i++ {
+					err = channel.forward(missed[i])
+				}
+			} else {
+				err = channel.forward(event)
+			}
+		case line := <-channel.lines:
+			if line.entry == nil {
+				err = channel.resumeLogs(line.sub)
+			} else {
+				err = channel.forwardLog(line.sub, *line.entry)
+			}
+		case <-ping.C:
+			err = channel.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		}
+		if err != nil {
+			log.Println("Failed to write on the control channel: ", err.Error())
+			return
+		}
+	}
+}
+
+// read passes the messages of the client to serve until quit is closed,
+// closed is closed once the connection is closed
+func (channel *controlChannel) read(closed chan<- struct{}, quit <-chan struct{}) {
+	defer close(closed)
+	channel.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	channel.conn.SetPongHandler(func(string) error {
+		return channel.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	})
+	for {
+		_, buf, err := channel.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var message ControlMessage
+		if err := json.Unmarshal(buf, &message); err != nil {
+			message = ControlMessage{invalid: true}
+		}
+		select {
+		case channel.messages <- message:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// forward sends the event to the client if it subscribed to its job
+func (channel *controlChannel) forward(event Event) error {
+	channel.lastID = event.ID
+	if _, ok := channel.jobs[event.JobID]; !ok {
+		return nil
+	}
+	return channel.write(ControlFrame{Type: EventFrame, JobID: event.JobID.String(), Event: &event})
+}
+
+// followLogs subscribes to the log lines of the job following the last line
+// received, it returns the lines missed since then along with the subscription
+func (channel *controlChannel) followLogs(jobID uuid.UUID, followed *followedLog) ([]*LogEntry, error) {
+	missed, sub, err := channel.manager.logs.subscribe(jobID, followed.lastSeq)
+	if err != nil {
+		return nil, err
+	}
+	followed.sub = sub
+	go channel.receiveLogs(sub)
+	return missed, nil
+}
+
+// receiveLogs passes the lines of the log subscription to serve until the
+// subscription is closed, by an unsubscribe, because the job ended
+// or because serve lagged behind, or until serve exits
+func (channel *controlChannel) receiveLogs(sub *logSubscription) {
+	for entry := range sub.entries {
+		entry := entry
+		select {
+		case channel.lines <- logLine{sub, &entry}:
+		case <-channel.quit:
+			return
+		}
+	}
+	select {
+	case channel.lines <- logLine{sub: sub}:
+	case <-channel.quit:
+	}
+}
+
+// forwardLog sends the log line to the client if the subscription is still current
+func (channel *controlChannel) forwardLog(sub *logSubscription, entry LogEntry) error {
+	followed, ok := channel.jobs[sub.jobID]
+	if !ok || followed.sub != sub {
+		return nil
+	}
+	followed.lastSeq = entry.Seq
+	return channel.write(ControlFrame{Type: LogFrame, JobID: sub.jobID.String(), Log: &entry})
+}
+
+// resumeLogs handles a closed log subscription. A job which is still
+// subscribed and didn't end was dropped for lagging behind, its lines
+// are followed again after the last line sent
+func (channel *controlChannel) resumeLogs(sub *logSubscription) error {
+	followed, ok := channel.jobs[sub.jobID]
+	if !ok || followed.sub != sub {
+		return nil
+	}
+	followed.sub = nil
+	missed, err := channel.followLogs(sub.jobID, followed)
+	if err != nil {
+		log.Printf("Failed to follow the logs of the job: %s\nError: %s", sub.jobID.String(), err.Error())
+		return nil
+	}
+	if record, err := channel.manager.store.get(sub.jobID); err != nil || isTerminal(record.Status) {
+		// Every line of an ended job is saved, the missed ones are the last
+		channel.manager.logs.unsubscribe(followed.sub)
+		followed.sub = nil
+	}
+	for _, entry := range missed {
+		followed.lastSeq = entry.Seq
+		if err = channel.write(ControlFrame{Type: LogFrame, JobID: sub.jobID.String(), Log: entry}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (channel *controlChannel) write(frame ControlFrame) error {
+	channel.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return channel.conn.WriteJSON(frame)
+}
+
+// handle executes the command of the client and returns its acknowledgement
+func (channel *controlChannel) handle(message ControlMessage) ControlFrame {
+	fail := func(jobID string, err error) ControlFrame {
+		return ControlFrame{Type: ErrorFrame, ID: message.ID, JobID: jobID, Error: err.Error()}
+	}
+	if message.invalid {
+		return fail("", errors.New("Invalid message format"))
+	}
+	switch message.Op {
+	case "subscribe", "unsubscribe":
+		// Every job is checked before changing the subscriptions
+		records := make([]*JobRecord, 0, len(message.JobIDs))
+		for _, jobID := range message.JobIDs {
+			record, _, err := channel.manager.lookupJob(jobID, channel.principal)
+			if err != nil {
+				return fail(jobID, err)
+			}
+			records = append(records, record)
+		}
+		for _, record := range records {
+			if message.Op == "subscribe" {
+				channel.subscribe(record)
+			} else {
+				channel.unsubscribe(record.JobID)
+			}
+		}
+	case string(halt), string(resume), string(stop):
+		status, err := channel.manager.control(message.JobID, Action(message.Op), channel.principal)
+		if status != http.StatusOK {
+			return fail(message.JobID, err)
+		}
+		if err != nil {
+			// The job is stopped but failed to clean
+			return ControlFrame{Type: AckFrame, ID: message.ID, JobID: message.JobID, Error: err.Error()}
+		}
+	default:
+		return fail("", errors.New("Invalid op: "+message.Op))
+	}
+	return ControlFrame{Type: AckFrame, ID: message.ID, JobID: message.JobID}
+}
+
+// subscribe sends the events and the log lines of the job published from now on,
+// an ended job logs no more lines
+func (channel *controlChannel) subscribe(record *JobRecord) {
+	jobID := record.JobID
+	if _, ok := channel.jobs[jobID]; ok {
+		return
+	}
+	followed := &followedLog{}
+	channel.jobs[jobID] = followed
+	if isTerminal(record.Status) {
+		return
+	}
+	// Only the lines following the subscription are sent
+	kept, err := channel.followLogs(jobID, followed)
+	if err != nil {
+		log.Printf("Failed to follow the logs of the job: %s\nError: %s", jobID.String(), err.Error())
+		return
+	}
+	if len(kept) > 0 {
+		followed.lastSeq = kept[len(kept)-1].Seq
+	}
+}
+
+func (channel *controlChannel) unsubscribe(jobID uuid.UUID) {
+	if followed, ok := channel.jobs[jobID]; ok && followed.sub != nil {
+		channel.manager.logs.unsubscribe(followed.sub)
+	}
+	delete(channel.jobs, jobID)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/psinghal20/atlan-assignment/jobs/simple"
+)
+
+// TestControlChannelReadQuits checks that read stops once serve quit,
+// even while it waits to pass a message nobody receives anymore
+func TestControlChannelReadQuits(t *testing.T) {
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	defer server.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn := <-conns
+	defer conn.Close()
+
+	channel := &controlChannel{conn: conn, messages: make(chan ControlMessage)}
+	closed := make(chan struct{})
+	quit := make(chan struct{})
+	go channel.read(closed, quit)
+	if err = client.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribe"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Let read block on the message before serve quits
+	time.Sleep(50 * time.Millisecond)
+	close(quit)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("read didn't return once serve quit")
+	}
+}
+
+// readFrame returns the next frame sent on the control channel
+func readFrame(t *testing.T, conn *websocket.Conn) ControlFrame {
+	var frame ControlFrame
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+// TestControlChannelFrames checks the event and log frames of the subscribed jobs
+func TestControlChannelFrames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStore()
+	manager := newTestManager(t, store, 0)
+	jobA, jobB := uuid.New(), uuid.New()
+	for _, jobID := range []uuid.UUID{jobA, jobB} {
+		if err := store.save(&JobRecord{JobID: jobID, Type: simple.Name, Status: Halted}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loggerA, loggerB := manager.logs.logger(jobA, simple.Name), manager.logs.logger(jobB, simple.Name)
+	r := gin.New()
+	r.GET("/ws", func(c *gin.Context) {
+		c.Set(principalKey, &Principal{Role: Operator, Tenant: defaultTenant})
+	}, manager.controlSocket)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	command := func(op string, jobID uuid.UUID) {
+		if err := conn.WriteJSON(ControlMessage{ID: op, Op: op, JobIDs: []string{jobID.String()}}); err != nil {
+			t.Fatal(err)
+		}
+		if frame := readFrame(t, conn); frame.Type != AckFrame || frame.ID != op {
+			t.Fatalf("%s answered %+v, want an ack", op, frame)
+		}
+	}
+	expectLog := func(jobID uuid.UUID, message string, seq uint64) {
+		frame := readFrame(t, conn)
+		if frame.Type != LogFrame || frame.JobID != jobID.String() || frame.Log == nil {
+			t.Fatalf("frame = %+v, want the log line %q of job %s", frame, message, jobID)
+		}
+		if frame.Log.Message != message || frame.Log.Seq != seq {
+			t.Errorf("log line = %d %q, want %d %q", frame.Log.Seq, frame.Log.Message, seq, message)
+		}
+	}
+
+	// Only the lines following the subscription are sent
+	loggerA.Info("Before")
+	command("subscribe", jobA)
+	loggerA.Info("After", "n", 1)
+	expectLog(jobA, "After", 2)
+
+	manager.events.publish(Event{Type: StatusEvent, JobID: jobA, Status: Queued, Tenant: defaultTenant})
+	if frame := readFrame(t, conn); frame.Type != EventFrame || frame.Event == nil || frame.Event.Status != Queued {
+		t.Fatalf("frame = %+v, want the status event", frame)
+	}
+
+	// Lines missed while dropped for lagging behind are sent once resumed
+	manager.logs.end(jobA)
+	loggerA.Info("Missed")
+	manager.logs.list(jobA, 0)
+	loggerA.Info("Resumed")
+	expectLog(jobA, "Missed", 3)
+	expectLog(jobA, "Resumed", 4)
+
+	// No more lines once unsubscribed
+	command("unsubscribe", jobA)
+	command("subscribe", jobB)
+	loggerA.Info("Unsubscribed")
+	manager.logs.list(jobA, 0)
+	loggerB.Info("Other job")
+	expectLog(jobB, "Other job", 1)
+
+	// Nor once the job ended
+	if err := store.update(jobB, func(record *JobRecord) error {
+		record.setStatus(Stopped)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	loggerB.Info("Last")
+	manager.logs.end(jobB)
+	expectLog(jobB, "Last", 2)
+	command("subscribe", jobA)
+	loggerB.Info("Ended")
+	manager.logs.list(jobB, 0)
+	loggerA.Info("Subscribed again")
+	expectLog(jobA, "Subscribed again", 6)
+}